@@ -8,6 +8,14 @@ DB_NAME = "attendance.db"
 
 GROUP, FIO = range(2)
 
+# Тема студента в текущем учебном периоде. Столбца users.topic больше нет:
+# назначения хранятся в topic_members (студент, тема, период)
+ACTIVE_TOPIC_JOIN = """
+    LEFT JOIN topic_members tm ON tm.student_id = users.id
+        AND tm.term_id = (SELECT id FROM terms WHERE active = 1 LIMIT 1)
+    LEFT JOIN topics t ON t.id = tm.topic_id
+"""
+
 logging.basicConfig(
     format='%(asctime)s - %(name)s - %(levelname)s - %(message)s',
     level=logging.INFO
@@ -88,28 +96,12 @@ async def get_fio(update: Update, context: ContextTypes.DEFAULT_TYPE):
     
     try:
         # Ищем пользователя по ФИО в базе данных
-        # Пробуем разные варианты названий полей
-        queries = [
-            "SELECT topic FROM users WHERE name = ?",
-            "SELECT topic FROM users WHERE Name = ?", 
-            "SELECT Topic FROM users WHERE name = ?",
-            "SELECT topic FROM users WHERE full_name = ?",
-            "SELECT course_topic FROM users WHERE name = ?"
-        ]
-        
-        topic = None
-        used_query = ""
-        
-        for query in queries:
-            try:
-                cursor.execute(query, (fio,))
-                result = cursor.fetchone()
-                if result:
-                    topic = result[0]
-                    used_query = query
-                    break
-            except sqlite3.Error:
-                continue
+        cursor.execute(
+            f"SELECT t.title FROM users {ACTIVE_TOPIC_JOIN} WHERE users.name = ? AND t.title IS NOT NULL",
+            (fio,)
+        )
+        result = cursor.fetchone()
+        topic = result[0] if result else None
         
         if topic:
             # Сохраняем telegram_id для этого пользователя
@@ -169,7 +161,7 @@ async def show_my_topic(update: Update, context: ContextTypes.DEFAULT_TYPE):
     
     try:
         # Ищем пользователя по telegram_id
-        cursor.execute("SELECT name, topic FROM users WHERE telegram_id = ?", (user_id,))
+        cursor.execute(f"SELECT users.name, t.title FROM users {ACTIVE_TOPIC_JOIN} WHERE users.telegram_id = ?", (user_id,))
         user_data = cursor.fetchone()
         
         if user_data:
@@ -226,7 +218,7 @@ async def debug_info(update: Update, context: ContextTypes.DEFAULT_TYPE):
             message += f"  {col[1]} ({col[2]})\n"
         
         # Показываем первые 5 записей
-        cursor.execute("SELECT name, topic FROM users LIMIT 5")
+        cursor.execute(f"SELECT users.name, t.title FROM users {ACTIVE_TOPIC_JOIN} LIMIT 5")
         users = cursor.fetchall()
         
         message += "\n📝 Примеры записей:\n"
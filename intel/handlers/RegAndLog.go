@@ -2,8 +2,10 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -12,6 +14,9 @@ import (
 	"proj/intel/services"
 
 	"proj/utils"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
@@ -21,12 +26,62 @@ var (
 func LoadTemplates() {
 	// Получаем абсолютный путь к папке с шаблонами
 	wd, _ := os.Getwd()
-	templateDir := filepath.Join(wd, "intel", "handlers", "templates")
+	loadTemplates(filepath.Join(wd, "intel", "handlers", "templates"))
+}
 
-	// Загружаем все шаблоны из папки
-	templates = template.Must(template.ParseGlob(filepath.Join(templateDir, "*.html")))
+// loadTemplates - загружает все шаблоны из папки; csrfToken подменяется на каждый запрос в render
+func loadTemplates(templateDir string) {
+	templates = template.Must(template.New("").Funcs(template.FuncMap{
+		"csrfToken":     func() string { return "" },
+		"impersonation": func() *utils.Claims { return nil },
+	}).ParseGlob(filepath.Join(templateDir, "*.html")))
 }
+
+// render - выполняет шаблон с CSRF-токеном текущей сессии и данными режима просмотра.
+// Исходный набор шаблонов не выполняется напрямую, поэтому его можно клонировать
+func render(w http.ResponseWriter, r *http.Request, name string, data interface{}) error {
+	t, err := templates.Clone()
+	if err != nil {
+		return err
+	}
+	token := utils.CSRFToken(r)
+	// Для баннера режима просмотра: claims, если администратор действует от имени пользователя
+	var impersonation *utils.Claims
+	if claims, err := utils.GetUserFromCookie(r); err == nil && claims.Impersonated() {
+		impersonation = claims
+	}
+	t.Funcs(template.FuncMap{
+		"csrfToken":     func() string { return token },
+		"impersonation": func() *utils.Claims { return impersonation },
+	})
+	return t.ExecuteTemplate(w, name, data)
+}
+
+// startSession - создаёт серверную сессию и выставляет cookie с токеном
+func startSession(w http.ResponseWriter, r *http.Request, user *models.User) error {
+	session, err := services.CreateSession(user.ID, r.UserAgent(), utils.ClientIP(r))
+	if err != nil {
+		return err
+	}
+	return utils.SetJWTCookie(w, session.ID, user.ID, user.Email, user.Role)
+}
+
+// finishLogin - все проверки пройдены: сбрасываем счётчик ошибок и создаём сессию
+func finishLogin(w http.ResponseWriter, r *http.Request, user *models.User) error {
+	if err := services.ClearLoginFailures(user.Email); err != nil {
+		log.Printf("Ошибка сброса счётчика попыток: %v", err)
+	}
+	utils.ClearMFACookie(w)
+	// Теперь передаем роль в JWT
+	return startSession(w, r, user)
+}
+
 func logout(w http.ResponseWriter, r *http.Request) {
+	if claims, err := utils.GetUserFromCookie(r); err == nil {
+		if err := services.RevokeSession(claims.SessionID()); err != nil {
+			log.Printf("Ошибка отзыва сессии: %v", err)
+		}
+	}
 	utils.ClearJWTCookie(w)
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
@@ -35,52 +90,175 @@ func redirect(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/dashboard/", http.StatusSeeOther)
 }
 
+type registerPageData struct {
+	Name        string
+	Group       string
+	Email       string
+	Code        string
+	Error       string
+	RequireCode bool
+	Domains     []string
+	Groups      []models.Groupfromcur // подсказки для поля группы
+}
+
 func register(w http.ResponseWriter, r *http.Request) {
+	settings := services.GetRegistrationSettings()
+	data := registerPageData{
+		RequireCode: settings.RequireCode,
+		Domains:     strings.Split(settings.AllowedDomains, ","),
+	}
+	if settings.AllowedDomains == "" {
+		data.Domains = nil
+	}
+	if groups, err := services.ListGroups(); err == nil {
+		data.Groups = groups
+	}
+
 	if r.Method == http.MethodPost {
 		// получаем данные из формы регистрации
-		name := r.FormValue("full_name")
-		group := r.FormValue("group")
-		password := r.FormValue("password")
-		email := r.FormValue("email")
-		// делаем шаблон пользователя
-		user := &models.User{
-			Name:     name,
-			Group:    group,
-			Email:    email,
-			Password: password,
+		data.Name = r.FormValue("full_name")
+		data.Group = r.FormValue("group")
+		data.Email = r.FormValue("email")
+		data.Code = r.FormValue("code")
+
+		if strings.TrimSpace(data.Group) == "" && strings.TrimSpace(data.Code) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			data.Error = "Укажите группу или код приглашения"
+			render(w, r, "Register.html", data)
+			return
 		}
+
 		// добавляем пользователя в БД
-		services.Add(user)
+		user, err := services.RegisterStudent(services.Registration{
+			Name:     data.Name,
+			Group:    data.Group,
+			Email:    data.Email,
+			Password: r.FormValue("password"),
+			Code:     data.Code,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrCodeRequired), errors.Is(err, services.ErrCodeInvalid),
+				errors.Is(err, services.ErrDomainNotAllowed), errors.Is(err, services.ErrEmailTaken),
+				errors.Is(err, services.ErrPasswordTooShort), errors.Is(err, services.ErrGroupUnknown):
+				w.WriteHeader(http.StatusBadRequest)
+				data.Error = err.Error()
+			default:
+				log.Printf("Ошибка регистрации %s: %v", data.Email, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				data.Error = "Ошибка регистрации, попробуйте позже"
+			}
+			render(w, r, "Register.html", data)
+			return
+		}
 
-		if err := utils.SetJWTCookie(w, user.ID, user.Email, user.Role); err != nil {
+		// Адрес подтверждается по ссылке из письма; вход работает и до подтверждения
+		if err := services.SendVerificationEmail(user); err != nil {
+			log.Printf("Ошибка отправки письма подтверждения %s: %v", user.Email, err)
+		}
+
+		if err := startSession(w, r, user); err != nil {
 			http.Error(w, "Ошибка создания сессии", http.StatusInternalServerError)
 			return
 		}
 
+		// Неодобренную учётную запись middleware отправит на страницу ожидания
 		http.Redirect(w, r, "/dashboard/", http.StatusSeeOther)
-
+		return
 	}
 
 	// загрузка шаблонов
-	templates.ExecuteTemplate(w, "Register.html", nil)
+	render(w, r, "Register.html", data)
+}
+
+type loginPageData struct {
+	Email   string
+	Error   string
+	SSOName string // кнопка входа через провайдера, если он настроен
+}
+
+// renderLogin - страница входа; кнопка единого входа показывается, только если он настроен
+func renderLogin(w http.ResponseWriter, r *http.Request, data loginPageData) {
+	data.SSOName = services.OIDCProviderName()
+	render(w, r, "Login.html", data)
+}
+
+// completeLogin - первый фактор пройден (пароль или провайдер входа):
+// дальше 2FA по политике роли, затем сессия
+func completeLogin(w http.ResponseWriter, r *http.Request, user *models.User) {
+	// Второй шаг: код 2FA или обязательное подключение 2FA
+	enrolled := services.TwoFactorEnabled(user.ID)
+	if enrolled || services.TwoFactorRequired(user.Role) {
+		if err := utils.SetMFACookie(w, user.ID); err != nil {
+			http.Error(w, "Ошибка создания сессии", http.StatusInternalServerError)
+			return
+		}
+		if enrolled {
+			http.Redirect(w, r, "/login/2fa", http.StatusFound)
+		} else {
+			http.Redirect(w, r, "/login/2fa/setup", http.StatusFound)
+		}
+		return
+	}
+
+	if err := finishLogin(w, r, user); err != nil {
+		http.Error(w, "Ошибка создания сессии", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
 }
 
 func login(w http.ResponseWriter, r *http.Request) {
-	var db = services.GetDB()
 	if r.Method == http.MethodPost {
 		fmt.Println("зашли")
-		email := r.FormValue("email")
+		email := strings.TrimSpace(r.FormValue("email"))
 		password := r.FormValue("password")
+		ip := utils.ClientIP(r)
 
-		var user models.User
-		result := db.Where("email=? and password=?", email, password).First(&user)
-		if result.Error == nil && user.ID != 0 {
-			// Теперь передаем роль в JWT
-			utils.SetJWTCookie(w, user.ID, user.Email, user.Role)
-			http.Redirect(w, r, "/dashboard", http.StatusFound)
+		// Ограничение попыток: по учётной записи и по IP
+		if err := services.CheckLoginAllowed(email, ip); err != nil {
+			var throttled *services.ThrottleError
+			if errors.As(err, &throttled) {
+				log.Printf("Вход для %s с %s ограничен: %v", email, ip, err)
+				w.Header().Set("Retry-After", strconv.Itoa(int(throttled.RetryAfter.Seconds())+1))
+				w.WriteHeader(http.StatusTooManyRequests)
+				renderLogin(w, r, loginPageData{
+					Email: email,
+					Error: fmt.Sprintf("Слишком много неудачных попыток. Повторите через %s", formatWait(throttled.RetryAfter)),
+				})
+				return
+			}
+			log.Printf("Ошибка проверки ограничений входа: %v", err)
+		}
+
+		// Authenticate сам перехэширует старый пароль в открытом виде
+		user, err := services.Authenticate(email, password)
+		if err == nil {
+			completeLogin(w, r, user)
 			return
 		}
+		log.Printf("Неудачный вход для %s: %v", email, err)
+
+		if err := services.RecordLoginFailure(email, ip, r.UserAgent(), err.Error()); err != nil {
+			log.Printf("Ошибка записи попытки входа: %v", err)
+		}
+
+		message := "Неверный email или пароль."
+		if errors.Is(err, services.ErrUserDisabled) {
+			message = "Учётная запись отключена. Обратитесь к администратору."
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		renderLogin(w, r, loginPageData{Email: email, Error: message})
+		return
 	}
 
-	templates.ExecuteTemplate(w, "Login.html", nil)
+	renderLogin(w, r, loginPageData{})
+}
+
+// formatWait - время ожидания для пользователя: "15 сек." или "3 мин."
+func formatWait(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d сек.", int(d.Seconds())+1)
+	}
+	return fmt.Sprintf("%d мин.", int(d.Minutes())+1)
 }
@@ -0,0 +1,141 @@
+// восстановление пароля и подтверждение email по ссылкам из писем
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"proj/intel/models"
+	"proj/intel/services"
+	"proj/utils"
+	"strings"
+)
+
+type accountPageData struct {
+	Title   string
+	Message string
+	Error   string
+	Token   string
+	Sent    bool
+}
+
+// forgotPassword - запрос ссылки для сброса пароля
+func forgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		email := strings.TrimSpace(r.FormValue("email"))
+		ip := utils.ClientIP(r)
+
+		// Запросы на сброс ограничиваются вместе с попытками входа с этого IP
+		if err := services.CheckLoginAllowed("", ip); err != nil {
+			var throttled *services.ThrottleError
+			if errors.As(err, &throttled) {
+				w.WriteHeader(http.StatusTooManyRequests)
+				render(w, r, "forgotPassword.html", accountPageData{Error: "Слишком много запросов. Повторите через " + formatWait(throttled.RetryAfter)})
+				return
+			}
+		}
+		// Запрос учитывается только по IP: иначе чужими запросами можно было бы заблокировать вход в учётную запись
+		if err := services.RecordLoginFailure("", ip, r.UserAgent(), "запрос сброса пароля"); err != nil {
+			log.Printf("Ошибка записи запроса сброса пароля: %v", err)
+		}
+
+		if err := services.RequestPasswordReset(email); err != nil {
+			log.Printf("Ошибка отправки письма для сброса пароля %s: %v", email, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			render(w, r, "forgotPassword.html", accountPageData{Error: "Не удалось отправить письмо. Попробуйте позже."})
+			return
+		}
+		// Ответ одинаковый для любого адреса - по нему нельзя узнать, зарегистрирован ли email
+		render(w, r, "forgotPassword.html", accountPageData{Sent: true})
+		return
+	}
+
+	render(w, r, "forgotPassword.html", accountPageData{})
+}
+
+// resetPassword - новый пароль по ссылке из письма
+func resetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+
+	if r.Method == http.MethodPost {
+		password := r.FormValue("password")
+		if password != r.FormValue("confirm") {
+			w.WriteHeader(http.StatusBadRequest)
+			render(w, r, "resetPassword.html", accountPageData{Token: token, Error: "Пароли не совпадают"})
+			return
+		}
+
+		user, err := services.ResetPassword(token, password)
+		if errors.Is(err, services.ErrPasswordTooShort) {
+			w.WriteHeader(http.StatusBadRequest)
+			render(w, r, "resetPassword.html", accountPageData{Token: token, Error: err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Ошибка сброса пароля: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			render(w, r, "notice.html", accountPageData{Title: "Сброс пароля", Error: utils.ErrActionTokenInvalid.Error()})
+			return
+		}
+
+		// Если пользователь был в системе под этой учётной записью, его сессии уже отозваны
+		utils.ClearJWTCookie(w)
+		render(w, r, "notice.html", accountPageData{
+			Title:   "Пароль изменён",
+			Message: "Пароль для " + user.Email + " изменён. Все активные сеансы завершены, войдите с новым паролем.",
+		})
+		return
+	}
+
+	if err := services.CheckPasswordResetToken(token); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		render(w, r, "notice.html", accountPageData{Title: "Сброс пароля", Error: err.Error()})
+		return
+	}
+	render(w, r, "resetPassword.html", accountPageData{Token: token})
+}
+
+// verifyEmail - подтверждение адреса по ссылке из письма
+func verifyEmail(w http.ResponseWriter, r *http.Request) {
+	user, err := services.VerifyEmail(r.URL.Query().Get("token"))
+	if err != nil {
+		log.Printf("Ошибка подтверждения email: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		render(w, r, "notice.html", accountPageData{Title: "Подтверждение адреса", Error: utils.ErrActionTokenInvalid.Error()})
+		return
+	}
+	render(w, r, "notice.html", accountPageData{
+		Title:   "Адрес подтверждён",
+		Message: "Адрес " + user.Email + " подтверждён.",
+	})
+}
+
+// ResendVerification - повторная отправка письма с подтверждением
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	var user models.User
+	if err := services.GetDB().First(&user, claims.UserID).Error; err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+
+	data := accountPageData{Title: "Подтверждение адреса"}
+	switch err := services.SendVerificationEmail(&user); {
+	case err == nil:
+		data.Message = "Письмо со ссылкой отправлено на " + user.Email + "."
+	case errors.Is(err, services.ErrEmailAlreadyValid), errors.Is(err, services.ErrEmailTooFrequent):
+		data.Error = err.Error()
+	default:
+		log.Printf("Ошибка отправки письма подтверждения %s: %v", user.Email, err)
+		data.Error = "Не удалось отправить письмо. Попробуйте позже."
+	}
+	render(w, r, "notice.html", data)
+}
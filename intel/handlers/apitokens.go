@@ -0,0 +1,91 @@
+// персональные API-токены: выпуск, список, отзыв
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"proj/intel/models"
+	"proj/intel/services"
+	"proj/middleware"
+	"proj/utils"
+	"strconv"
+	"time"
+)
+
+type apiTokensPageData struct {
+	Tokens   []models.APIToken
+	Scopes   []middleware.PermissionInfo
+	NewToken string
+	Error    string
+}
+
+// APITokens - список токенов пользователя и выпуск нового
+func APITokens(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	data := apiTokensPageData{Scopes: middleware.RolePermissions(claims.Role)}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Ошибка парсинга формы", http.StatusBadRequest)
+			return
+		}
+
+		// Выдать можно только права, которые есть у роли
+		var scopes []string
+		for _, s := range r.Form["scope"] {
+			if middleware.HasPermission(claims.Role, middleware.Permission(s)) {
+				scopes = append(scopes, s)
+			}
+		}
+		days, _ := strconv.Atoi(r.FormValue("days"))
+
+		raw, token, err := services.CreateAPIToken(claims.UserID, r.FormValue("name"), scopes, time.Duration(days)*24*time.Hour)
+		if err != nil {
+			if !errors.Is(err, services.ErrAPITokenScopes) {
+				log.Printf("Ошибка выпуска API-токена: %v", err)
+			}
+			data.Error = err.Error()
+		} else {
+			log.Printf("Пользователь %s выпустил API-токен %s (%s)", claims.Email, token.Prefix, token.Scopes)
+			data.NewToken = raw
+		}
+	}
+
+	tokens, err := services.ListAPITokens(claims.UserID)
+	if err != nil {
+		log.Printf("Ошибка загрузки API-токенов: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+	data.Tokens = tokens
+	render(w, r, "apiTokens.html", data)
+}
+
+// RevokeAPIToken - отзыв своего токена
+func RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	id, err := strconv.ParseUint(r.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Неверный ID токена", http.StatusBadRequest)
+		return
+	}
+	if err := services.RevokeAPIToken(claims.UserID, uint(id)); err != nil {
+		http.Error(w, "Токен не найден", http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, r, "/tokens", http.StatusSeeOther)
+}
@@ -0,0 +1,135 @@
+// журнал действий: запись из обработчиков, просмотр и выгрузка в Excel
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"proj/intel/models"
+	"proj/intel/services"
+	"proj/utils"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// auditPageLimit - сколько записей показываем на странице; выгрузка без ограничения
+const auditPageLimit = 500
+
+// auditActor - кто выполняет запрос
+func auditActor(r *http.Request) services.Actor {
+	actor := services.Actor{IP: utils.ClientIP(r)}
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		return actor
+	}
+	if claims.Impersonated() {
+		actor.UserID = claims.ImpersonatorID
+		actor.Email = claims.ImpersonatorEmail
+		actor.Role = "admin"
+		actor.OnBehalfOf = claims.Email
+		return actor
+	}
+	actor.UserID = claims.UserID
+	actor.Email = claims.Email
+	actor.Role = claims.Role
+	return actor
+}
+
+// auditRoleChange - запись о смене роли или группы старосты
+func auditRoleChange(r *http.Request, before, after models.User) {
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditUserRole,
+		TargetType: "user",
+		TargetID:   after.ID,
+		Summary:    fmt.Sprintf("Роль %s (%s): %s → %s", after.Name, after.Email, before.Role, after.Role),
+		Before:     map[string]interface{}{"role": before.Role, "headman_group": before.HeadmanGroup},
+		After:      map[string]interface{}{"role": after.Role, "headman_group": after.HeadmanGroup},
+	})
+}
+
+// auditFilterFromRequest - фильтр из параметров ?actor=&action=&target=&from=&to=
+func auditFilterFromRequest(r *http.Request) services.AuditFilter {
+	q := r.URL.Query()
+	f := services.AuditFilter{
+		Actor:  q.Get("actor"),
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+	}
+	if from, err := time.ParseInLocation("2006-01-02", q.Get("from"), time.Local); err == nil {
+		f.From = from
+	}
+	// Дата "по" включительно
+	if to, err := time.ParseInLocation("2006-01-02", q.Get("to"), time.Local); err == nil {
+		f.To = to.AddDate(0, 0, 1)
+	}
+	return f
+}
+
+// AdminAuditLog - журнал действий с фильтрами
+func AdminAuditLog(w http.ResponseWriter, r *http.Request) {
+	filter := auditFilterFromRequest(r)
+	filter.Limit = auditPageLimit
+
+	entries, err := services.ListAudit(filter)
+	if err != nil {
+		log.Printf("Ошибка загрузки журнала: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	render(w, r, "audit.html", map[string]interface{}{
+		"Entries": entries,
+		"Actions": services.AuditActions,
+		"Actor":   q.Get("actor"),
+		"Action":  q.Get("action"),
+		"Target":  q.Get("target"),
+		"From":    q.Get("from"),
+		"To":      q.Get("to"),
+		"Limited": len(entries) == auditPageLimit,
+		"Query":   q.Encode(),
+	})
+}
+
+// AdminAuditExport - выгрузка журнала в Excel с теми же фильтрами
+func AdminAuditExport(w http.ResponseWriter, r *http.Request) {
+	entries, err := services.ListAudit(auditFilterFromRequest(r))
+	if err != nil {
+		log.Printf("Ошибка загрузки журнала: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	headers := []string{"Время", "Пользователь", "Роль", "От имени", "IP", "Действие", "Объект", "ID объекта", "Описание", "До", "После"}
+	for i, h := range headers {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		f.SetCellValue("Sheet1", cell, h)
+	}
+
+	for i, e := range entries {
+		row := i + 2
+		values := []interface{}{
+			e.CreatedAt.Format("02.01.2006 15:04:05"), e.ActorEmail, e.ActorRole, e.OnBehalfOf, e.IP,
+			e.Action, e.TargetType, e.TargetID, e.Summary, e.Before, e.After,
+		}
+		for col, v := range values {
+			cell, _ := excelize.CoordinatesToCellName(col+1, row)
+			f.SetCellValue("Sheet1", cell, v)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=audit_%s.xlsx", time.Now().Format("2006-01-02")))
+	w.Header().Set("Content-Transfer-Encoding", "binary")
+
+	if err := f.Write(w); err != nil {
+		log.Printf("Ошибка записи Excel: %v", err)
+		http.Error(w, "Ошибка создания файла", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Выгружен журнал действий: %d записей", len(entries))
+}
@@ -0,0 +1,278 @@
+// справочник ПЦК и выгрузка по комиссиям
+package handlers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"proj/intel/models"
+	"proj/intel/services"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// formUintPtr - необязательный ID из формы: пусто или 0 - nil
+func formUintPtr(r *http.Request, name string) (*uint, error) {
+	v := r.FormValue(name)
+	if v == "" || v == "0" {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	u := uint(id)
+	return &u, nil
+}
+
+func commissionsRedirect(w http.ResponseWriter, r *http.Request, err error) {
+	target := "/admin/commissions"
+	if err != nil {
+		target += "?error=" + url.QueryEscape(err.Error())
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// AdminCommissions - справочник ПЦК: список, создание комиссии
+func AdminCommissions(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		c, err := services.CreateCommission(r.FormValue("name"))
+		if err != nil {
+			commissionsRedirect(w, r, err)
+			return
+		}
+		log.Printf("Создана комиссия %q", c.Name)
+		commissionsRedirect(w, r, nil)
+		return
+	}
+
+	commissions, err := services.ListCommissions()
+	if err != nil {
+		log.Printf("Ошибка загрузки комиссий: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+	supervisors, err := services.ListSupervisors()
+	if err != nil {
+		log.Printf("Ошибка загрузки руководителей: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, "commissions.html", map[string]interface{}{
+		"Commissions": commissions,
+		"Supervisors": supervisors,
+		"Error":       r.URL.Query().Get("error"),
+	})
+}
+
+// AdminCommissionHead - назначение председателя комиссии
+func AdminCommissionHead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	commissionID, err := strconv.ParseUint(r.FormValue("commission_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid commission ID", http.StatusBadRequest)
+		return
+	}
+	headID, err := formUintPtr(r, "supervisor_id")
+	if err != nil {
+		http.Error(w, "Invalid supervisor ID", http.StatusBadRequest)
+		return
+	}
+
+	err = services.SetCommissionHead(uint(commissionID), headID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Комиссия или руководитель не найдены", http.StatusNotFound)
+		return
+	}
+	commissionsRedirect(w, r, err)
+}
+
+// AdminCommissionMember - перевод руководителя в комиссию
+func AdminCommissionMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	supervisorID, err := strconv.ParseUint(r.FormValue("supervisor_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid supervisor ID", http.StatusBadRequest)
+		return
+	}
+	commissionID, err := formUintPtr(r, "commission_id")
+	if err != nil {
+		http.Error(w, "Invalid commission ID", http.StatusBadRequest)
+		return
+	}
+
+	err = services.SetSupervisorCommission(uint(supervisorID), commissionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Комиссия или руководитель не найдены", http.StatusNotFound)
+		return
+	}
+	commissionsRedirect(w, r, err)
+}
+
+// exportCommissionHandler - выгрузка по ПЦК: одна книга на комиссию,
+// для всех комиссий сразу - zip-архив с книгами
+func exportCommissionHandler(w http.ResponseWriter, r *http.Request) {
+	commissions, err := services.ListCommissions()
+	if err != nil {
+		log.Printf("Ошибка загрузки комиссий: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		render(w, r, "exportCommission.html", map[string]interface{}{"Commissions": commissions})
+		return
+	}
+
+	selected := r.FormValue("commission_id")
+	if selected == "all" {
+		exportAllCommissions(w, commissions)
+		return
+	}
+
+	id, err := strconv.ParseUint(selected, 10, 32)
+	if err != nil {
+		http.Error(w, "Комиссия не указана", http.StatusBadRequest)
+		return
+	}
+	for _, c := range commissions {
+		if c.ID != uint(id) {
+			continue
+		}
+		f, err := commissionWorkbook(c)
+		if err != nil {
+			log.Printf("Ошибка выгрузки комиссии %s: %v", c.Name, err)
+			http.Error(w, "Ошибка создания файла", http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(services.CommissionFileName(c)))
+		if err := f.Write(w); err != nil {
+			log.Printf("Ошибка записи Excel: %v", err)
+		}
+		return
+	}
+	http.Error(w, "Комиссия не найдена", http.StatusNotFound)
+}
+
+func exportAllCommissions(w http.ResponseWriter, commissions []models.Commission) {
+	if len(commissions) == 0 {
+		http.Error(w, "Справочник комиссий пуст", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=commissions.zip")
+
+	archive := zip.NewWriter(w)
+	defer archive.Close()
+	for _, c := range commissions {
+		f, err := commissionWorkbook(c)
+		if err != nil {
+			log.Printf("Ошибка выгрузки комиссии %s: %v", c.Name, err)
+			continue
+		}
+		entry, err := archive.Create(services.CommissionFileName(c))
+		if err == nil {
+			err = f.Write(entry)
+		}
+		f.Close()
+		if err != nil {
+			log.Printf("Ошибка записи архива: %v", err)
+			return
+		}
+	}
+}
+
+// commissionWorkbook - книга комиссии: сводка по группам и лист на каждую группу
+func commissionWorkbook(c models.Commission) (*excelize.File, error) {
+	groups, err := services.CommissionReport(c)
+	if err != nil {
+		return nil, err
+	}
+	term, err := services.ActiveTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	f := excelize.NewFile()
+	summary := "Сводка"
+	f.SetSheetName("Sheet1", summary)
+
+	head := "не назначен"
+	if c.Head != nil {
+		head = c.Head.Name
+	}
+	f.SetCellValue(summary, "A1", c.Name)
+	f.SetCellValue(summary, "A2", "Председатель: "+head)
+	f.SetCellValue(summary, "A3", "Период: "+term.Name())
+	for i, title := range []string{"Группа", "Тем", "Свободно мест", "Назначено", "Принято руководителем"} {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 4)
+		f.SetCellValue(summary, cell, title)
+	}
+
+	used := map[string]bool{summary: true}
+	for i, g := range groups {
+		row := i + 5
+		f.SetCellValue(summary, fmt.Sprintf("A%d", row), g.Group)
+		f.SetCellValue(summary, fmt.Sprintf("B%d", row), g.Topics)
+		f.SetCellValue(summary, fmt.Sprintf("C%d", row), g.Free)
+		f.SetCellValue(summary, fmt.Sprintf("D%d", row), g.Assigned)
+		f.SetCellValue(summary, fmt.Sprintf("E%d", row), g.Accepted)
+
+		sheet := sheetName(g.Group, used)
+		if _, err := f.NewSheet(sheet); err != nil {
+			return nil, err
+		}
+		for j, title := range []string{"Тема", "Предмет", "Вид работы", "Руководитель", "Студент", "Статус"} {
+			cell, _ := excelize.CoordinatesToCellName(j+1, 1)
+			f.SetCellValue(sheet, cell, title)
+		}
+		for j, item := range g.Rows {
+			r := j + 2
+			f.SetCellValue(sheet, fmt.Sprintf("A%d", r), item.Topic.Title)
+			f.SetCellValue(sheet, fmt.Sprintf("B%d", r), item.Topic.Subject)
+			f.SetCellValue(sheet, fmt.Sprintf("C%d", r), item.Topic.WorkType)
+			f.SetCellValue(sheet, fmt.Sprintf("D%d", r), item.Supervisor)
+			if item.Student != nil {
+				f.SetCellValue(sheet, fmt.Sprintf("E%d", r), item.Student.Name)
+			}
+			f.SetCellValue(sheet, fmt.Sprintf("F%d", r), item.Status)
+		}
+	}
+	return f, nil
+}
+
+// sheetName - имя листа Excel: до 31 символа, без []:*?/\ и без повторов
+func sheetName(name string, used map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > 28 {
+		name = string(runes[:28])
+	}
+	result := name
+	for i := 2; used[result]; i++ {
+		result = fmt.Sprintf("%s %d", name, i)
+	}
+	used[result] = true
+	return result
+}
@@ -0,0 +1,194 @@
+// кабинет куратора: свои группы, ход распределения тем, старосты
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"proj/intel/models"
+	"proj/intel/services"
+	"proj/utils"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// curatorRedirect - обратно в кабинет; ошибка или итог показываются на странице
+func curatorRedirect(w http.ResponseWriter, r *http.Request, err error, notice string) {
+	target := "/curator"
+	switch {
+	case err != nil:
+		target += "?error=" + url.QueryEscape(err.Error())
+	case notice != "":
+		target += "?notice=" + url.QueryEscape(notice)
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// curatorGroup - группа из формы, если она закреплена за вошедшим куратором.
+// При ошибке ответ уже отправлен
+func curatorGroup(w http.ResponseWriter, r *http.Request) (*models.Groupfromcur, bool) {
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return nil, false
+	}
+	groupID, err := strconv.ParseUint(r.FormValue("group_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	group, err := services.CuratorOwnGroup(claims.UserID, uint(groupID))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Группа не найдена", http.StatusNotFound)
+		return nil, false
+	case errors.Is(err, services.ErrNotOwnGroup):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, false
+	case err != nil:
+		log.Printf("Ошибка поиска группы: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return nil, false
+	}
+	return group, true
+}
+
+// CuratorDashboard - группы куратора: ход распределения, студенты без тем, старосты
+func CuratorDashboard(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	var curator models.User
+	if err := services.GetDB().First(&curator, claims.UserID).Error; err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+
+	groups, err := services.CuratorGroups(curator.ID)
+	if err != nil {
+		log.Printf("Ошибка получения групп куратора: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, "curator.html", map[string]interface{}{
+		"User":   curator,
+		"Groups": groups,
+		"Error":  r.URL.Query().Get("error"),
+		"Notice": r.URL.Query().Get("notice"),
+	})
+}
+
+// CuratorHeadman - куратор назначает старосту своей группы или снимает его
+func CuratorHeadman(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	group, ok := curatorGroup(w, r)
+	if !ok {
+		return
+	}
+	studentID, err := strconv.ParseUint(r.FormValue("student_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid student ID", http.StatusBadRequest)
+		return
+	}
+
+	var student models.User
+	if err := services.GetDB().First(&student, studentID).Error; err != nil {
+		http.Error(w, "Студент не найден", http.StatusNotFound)
+		return
+	}
+	before := student
+
+	switch r.FormValue("action") {
+	case "assign":
+		if _, err := services.GroupMember(group.Code, student.ID); err != nil {
+			curatorRedirect(w, r, err, "")
+			return
+		}
+		err = services.SetUserRole(&student, "headman", group.Code)
+	case "remove":
+		if student.Role != "headman" || student.HeadmanGroup != group.Code {
+			curatorRedirect(w, r, errors.New("это не староста группы "+group.Code), "")
+			return
+		}
+		err = services.SetUserRole(&student, "student", "")
+	default:
+		http.Error(w, "Неизвестное действие", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка смены роли: %v", err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+		return
+	}
+	auditRoleChange(r, before, student)
+
+	curatorRedirect(w, r, nil, "")
+}
+
+// CuratorAutoAssign - случайное распределение свободных тем среди студентов одной группы
+func CuratorAutoAssign(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	group, ok := curatorGroup(w, r)
+	if !ok {
+		return
+	}
+
+	students, err := services.GroupStudentsWithoutTopic(group.Code)
+	if err != nil {
+		log.Printf("Ошибка получения студентов группы: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+	topics, err := services.GroupFreeTopics(group.Code)
+	if err != nil {
+		log.Printf("Ошибка получения тем группы: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+	if len(students) == 0 {
+		curatorRedirect(w, r, errors.New("в группе "+group.Code+" нет студентов без тем"), "")
+		return
+	}
+	if len(topics) == 0 {
+		curatorRedirect(w, r, errors.New("для группы "+group.Code+" нет свободных тем"), "")
+		return
+	}
+
+	assigned, count := distributeTopics(students, topics, auditActor(r))
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditTopicAuto,
+		TargetType: "group",
+		TargetID:   group.ID,
+		Summary: fmt.Sprintf("Автораспределение в группе %s: назначено %d тем (студентов без темы: %d, свободных тем: %d)",
+			group.Code, len(assigned), len(students), len(topics)),
+		After: assigned,
+	})
+
+	curatorRedirect(w, r, nil, fmt.Sprintf("Группа %s: распределено %d тем из %d возможных", group.Code, len(assigned), count))
+}
+
+// CuratorExport - Excel по своей группе: группа берётся из справочника, а не из формы
+func CuratorExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	group, ok := curatorGroup(w, r)
+	if !ok {
+		return
+	}
+	writeGroupExport(w, group.Code)
+}
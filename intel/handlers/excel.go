@@ -9,9 +9,12 @@ import (
 	"net/http"
 	"proj/intel/models"
 	"proj/intel/services"
+	"proj/utils"
+	"strconv"
 	"strings"
 
 	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
 )
 
 type UploadResponse struct {
@@ -21,11 +24,27 @@ type UploadResponse struct {
 	Error    string `json:"error,omitempty"`
 }
 
-func processExcelFile(file io.Reader, fileType string) UploadResponse {
+func processExcelFile(file io.Reader, fileType, filename string, actor services.Actor) (result UploadResponse) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("PANIC in processExcelFile: %v", r)
+			result = UploadResponse{Success: false, Error: fmt.Sprintf("Ошибка обработки файла: %v", r)}
 		}
+
+		// В журнал попадает и неудачный импорт - видно, кто и что пытался загрузить
+		services.Audit(actor, services.AuditRecord{
+			Action:     services.AuditImport,
+			TargetType: "import",
+			Summary:    fmt.Sprintf("Импорт %s из %s: %d записей", fileType, filename, result.Imported),
+			After: map[string]interface{}{
+				"type":     fileType,
+				"file":     filename,
+				"success":  result.Success,
+				"imported": result.Imported,
+				"message":  result.Message,
+				"error":    result.Error,
+			},
+		})
 	}()
 
 	log.Printf("Processing Excel file, type: %s", fileType)
@@ -126,6 +145,7 @@ func isExcelFile(data []byte) bool {
 
 func processStudents(rows [][]string) UploadResponse {
 	count := 0
+	var rejected []string
 	log.Printf("Начало обработки студентов, всего строк: %d", len(rows))
 
 	for i, row := range rows {
@@ -137,12 +157,26 @@ func processStudents(rows [][]string) UploadResponse {
 		log.Printf("Обработка строки %d: %v", i, row)
 
 		if len(row) >= 4 {
+			// Группа должна быть в справочнике; опечатки исправляются по псевдонимам
+			group, err := services.CanonicalGroup(row[3])
+			if err != nil {
+				log.Printf("Пропущена строка %d: группа «%s»: %v", i, row[3], err)
+				rejected = append(rejected, fmt.Sprintf("строка %d: «%s»", i+1, strings.TrimSpace(row[3])))
+				continue
+			}
+
+			hash, err := services.HashPassword(strings.TrimSpace(row[2]))
+			if err != nil {
+				log.Printf("Пропущена строка %d: %v", i, err)
+				continue
+			}
+
 			// Создаем пользователя со всеми полями
 			user := models.User{
 				Name:     strings.TrimSpace(row[0]), // ФИО
 				Email:    strings.TrimSpace(row[1]), // Email
-				Password: strings.TrimSpace(row[2]), // Password
-				Group:    strings.TrimSpace(row[3]), // Group
+				Password: hash,                      // Password (хэш)
+				Group:    group,                     // Group
 				Role:     "student",
 			}
 
@@ -156,15 +190,28 @@ func processStudents(rows [][]string) UploadResponse {
 	}
 
 	log.Printf("Обработка завершена. Импортировано: %d", count)
+	message := fmt.Sprintf("Импортировано %d студентов", count)
+	if len(rejected) > 0 {
+		message += fmt.Sprintf(". Пропущено %d студентов с группой не из справочника (добавьте группу или её написание в справочник групп): %s",
+			len(rejected), strings.Join(rejected, "; "))
+	}
 	return UploadResponse{
-		Success:  true,
+		Success:  count > 0 || len(rejected) == 0,
 		Imported: count,
-		Message:  fmt.Sprintf("Импортировано %d студентов", count),
+		Message:  message,
 	}
 }
 
 func processTopics(rows [][]string) UploadResponse {
+	// Темы загружаются в текущий учебный период
+	term, err := services.ActiveTerm()
+	if err != nil {
+		log.Printf("Ошибка получения учебного периода: %v", err)
+		return UploadResponse{Success: false, Error: err.Error()}
+	}
+
 	count := 0
+	var rejected []string
 	for i, row := range rows {
 		if i == 0 {
 			continue
@@ -172,17 +219,36 @@ func processTopics(rows [][]string) UploadResponse {
 
 		if len(row) >= 5 {
 			topic := models.Topic{
-				Title:      strings.TrimSpace(row[0]),
-				Subject:    strings.TrimSpace(row[1]),
-				WorkType:   strings.TrimSpace(row[2]),
-				Commission: strings.TrimSpace(row[3]),
-				Supervisor: strings.TrimSpace(row[4]),
-				Status:     "free", // По умолчанию тема свободна
+				Title:          strings.TrimSpace(row[0]),
+				Subject:        strings.TrimSpace(row[1]),
+				WorkType:       strings.TrimSpace(row[2]),
+				CommissionName: strings.TrimSpace(row[3]),
+				SupervisorName: strings.TrimSpace(row[4]),
+				Status:         models.TopicOpen, // Загруженные темы уже утверждены и сразу открыты для выбора
+				TermID:         &term.ID,
+			}
+
+			// Тема должна относиться к ПЦК из справочника
+			commission, err := services.FindCommission(topic.CommissionName)
+			if err != nil {
+				log.Printf("Ошибка поиска комиссии: %v", err)
+			}
+			if commission == nil {
+				log.Printf("Пропущена строка %d: комиссия «%s» не найдена", i, topic.CommissionName)
+				rejected = append(rejected, fmt.Sprintf("строка %d: комиссия «%s»", i+1, topic.CommissionName))
+				continue
 			}
+			topic.CommissionID = &commission.ID
 
-			// Добавляем группу если есть
+			// Добавляем группу если есть; она должна быть в справочнике
 			if len(row) > 5 && strings.TrimSpace(row[5]) != "" {
-				topic.Group = strings.TrimSpace(row[5])
+				group, err := services.CanonicalGroup(row[5])
+				if err != nil {
+					log.Printf("Пропущена строка %d: группа «%s»: %v", i, row[5], err)
+					rejected = append(rejected, fmt.Sprintf("строка %d: группа «%s»", i+1, strings.TrimSpace(row[5])))
+					continue
+				}
+				topic.Group = group
 			}
 
 			// Добавляем описание если есть
@@ -190,6 +256,18 @@ func processTopics(rows [][]string) UploadResponse {
 				topic.Description = strings.TrimSpace(row[6])
 			}
 
+			// Сколько студентов выполняют тему; по умолчанию один
+			topic.Capacity = 1
+			if len(row) > 7 && strings.TrimSpace(row[7]) != "" {
+				capacity, err := strconv.Atoi(strings.TrimSpace(row[7]))
+				if err != nil || capacity < 1 {
+					log.Printf("Пропущена строка %d: число студентов «%s»", i, row[7])
+					rejected = append(rejected, fmt.Sprintf("строка %d: число студентов «%s»", i+1, strings.TrimSpace(row[7])))
+					continue
+				}
+				topic.Capacity = capacity
+			}
+
 			// Используем ваш сервис для добавления
 			services.Add(&topic)
 			count++
@@ -199,28 +277,81 @@ func processTopics(rows [][]string) UploadResponse {
 		}
 	}
 
+	linked, unresolved, err := services.LinkTopicSupervisors()
+	if err != nil {
+		log.Printf("Ошибка привязки тем к руководителям: %v", err)
+	}
+
+	message := fmt.Sprintf("Импортировано %d тем в период %s. Привязано к руководителям: %d, не найдено в справочнике: %d", count, term.Name(), linked, unresolved)
+	if len(rejected) > 0 {
+		message += fmt.Sprintf(". Пропущено %d тем с комиссией или группой не из справочника (добавьте их в справочники ПЦК и групп): %s",
+			len(rejected), strings.Join(rejected, "; "))
+	}
+
 	return UploadResponse{
-		Success:  true,
+		Success:  count > 0 || len(rejected) == 0,
 		Imported: count,
-		Message:  fmt.Sprintf("Импортировано %d тем", count),
+		Message:  message,
 	}
 }
 
+// processSupervisors - справочник руководителей: ФИО, Email, Цикловая комиссия,
+// необязательный четвёртый столбец - сколько студентов можно взять
 func processSupervisors(rows [][]string) UploadResponse {
-	count := 0
+	count, created := 0, 0
 	for i, row := range rows {
 		if i == 0 {
 			continue
 		}
-		if len(row) >= 3 {
-			count++
+		if len(row) < 3 {
+			log.Printf("Пропущена строка %d: недостаточно данных для руководителя (только %d столбцов)", i, len(row))
+			continue
+		}
+
+		supervisor := models.Supervisor{
+			Name:           strings.TrimSpace(row[0]),
+			Email:          strings.TrimSpace(row[1]),
+			CommissionName: strings.TrimSpace(row[2]),
+		}
+		if len(row) > 3 && strings.TrimSpace(row[3]) != "" {
+			limit, err := strconv.Atoi(strings.TrimSpace(row[3]))
+			if err != nil || limit < 0 {
+				log.Printf("Строка %d: неверная нагрузка %q, ограничение не задано", i, row[3])
+			} else {
+				supervisor.MaxStudents = limit
+			}
+		}
+
+		// Комиссии из файла руководителей пополняют справочник ПЦК
+		commission, err := services.EnsureCommission(supervisor.CommissionName)
+		if err != nil {
+			log.Printf("Строка %d: ошибка комиссии «%s»: %v", i, supervisor.CommissionName, err)
+		} else if commission != nil {
+			supervisor.CommissionID = &commission.ID
+		}
+
+		isNew, err := services.SaveSupervisor(supervisor)
+		if err != nil {
+			log.Printf("Пропущена строка %d: %v", i, err)
+			continue
+		}
+		if isNew {
+			created++
 		}
+		count++
+	}
+
+	// Темы, загруженные раньше справочника, привязываются по ФИО
+	linked, unresolved, err := services.LinkTopicSupervisors()
+	if err != nil {
+		log.Printf("Ошибка привязки тем к руководителям: %v", err)
 	}
 
 	return UploadResponse{
 		Success:  true,
 		Imported: count,
-		Message:  fmt.Sprintf("Processed %d supervisors", count),
+		Message: fmt.Sprintf("Импортировано %d руководителей (новых: %d, обновлено: %d). Привязано тем: %d, без руководителя из справочника: %d",
+			count, created, count-created, linked, unresolved),
 	}
 }
 
@@ -238,7 +369,7 @@ func exportHandler(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method != "POST" {
 		log.Println("Метод не POST, показываем форму")
-		showExportForm(w)
+		showExportForm(w, r)
 		return
 	}
 
@@ -256,13 +387,31 @@ func exportHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Группа не указана", http.StatusBadRequest)
 		return
 	}
+	// Группу могли ввести в другом написании - берём код из справочника
+	if code, err := services.CanonicalGroup(group); err == nil {
+		group = code
+	}
+	// Староста выгружает свою группу, куратор - закреплённые за ним
+	scope, ok := managedGroups(w, r)
+	if !ok {
+		return
+	}
+	if !scope.Allows(group) {
+		http.Error(w, services.ErrOutsideScope.Error(), http.StatusForbidden)
+		return
+	}
+	writeGroupExport(w, group)
+}
 
+// writeGroupExport - Excel со студентами группы и их темами текущего периода
+func writeGroupExport(w http.ResponseWriter, group string) {
 	// Получаем пользователей из БД
 	var users []models.User
 	db := services.GetDB()
 
-	// Используем экранирование для поля group
-	result := db.Where("`group` = ?", group).Find(&users)
+	// Используем экранирование для поля group; тема берётся из topic_members
+	result := db.Scopes(services.WithCurrentTopic).Preload("Membership.Topic.Members.Student").
+		Where("`group` = ?", group).Find(&users)
 	if result.Error != nil {
 		log.Printf("Ошибка БД: %v", result.Error)
 		http.Error(w, "Ошибка базы данных: "+result.Error.Error(), http.StatusInternalServerError)
@@ -284,13 +433,18 @@ func exportHandler(w http.ResponseWriter, r *http.Request) {
 	f.SetCellValue("Sheet1", "A1", "Имя")
 	f.SetCellValue("Sheet1", "B1", "Тема")
 	f.SetCellValue("Sheet1", "C1", "Роль")
+	f.SetCellValue("Sheet1", "D1", "Команда")
 
 	// Заполняем данные
 	for i, user := range users {
 		row := i + 2
 		f.SetCellValue("Sheet1", fmt.Sprintf("A%d", row), user.Name)
-		f.SetCellValue("Sheet1", fmt.Sprintf("B%d", row), user.Topic)
+		f.SetCellValue("Sheet1", fmt.Sprintf("B%d", row), topicTitle(user.CurrentTopic()))
 		f.SetCellValue("Sheet1", fmt.Sprintf("C%d", row), user.Role)
+		// Для командной темы - все, кто её выполняет
+		if topic := user.CurrentTopic(); topic != nil && topic.Team() {
+			f.SetCellValue("Sheet1", fmt.Sprintf("D%d", row), topic.StudentNames())
+		}
 	}
 
 	// Устанавливаем заголовки ответа
@@ -308,7 +462,7 @@ func exportHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Успешно отправлен Excel файл для группы %s", group)
 }
 
-func showExportForm(w http.ResponseWriter) {
+func showExportForm(w http.ResponseWriter, r *http.Request) {
 	html := `<!DOCTYPE html>
 <html>
 <head>
@@ -328,6 +482,7 @@ func showExportForm(w http.ResponseWriter) {
     <div class="container">
         <h2>Выгрузка данных студентов</h2>
         <form method="POST" action="/export">
+            <input type="hidden" name="csrf_token" value="{{csrf}}">
             <div class="form-group">
                 <label for="group">Введите группу:</label>
                 <input type="text" id="group" name="group" required placeholder="Например: ИС-202">
@@ -338,6 +493,8 @@ func showExportForm(w http.ResponseWriter) {
 </body>
 </html>`
 
+	html = strings.Replace(html, "{{csrf}}", utils.CSRFToken(r), 1)
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if _, err := w.Write([]byte(html)); err != nil {
 		log.Printf("Ошибка отправки формы: %v", err)
@@ -345,7 +502,7 @@ func showExportForm(w http.ResponseWriter) {
 }
 
 func exportFormHandler(w http.ResponseWriter, r *http.Request) {
-	templates.ExecuteTemplate(w, "exportList.html", nil)
+	render(w, r, "exportList.html", nil)
 }
 
 // excel.go - добавьте эти функции
@@ -353,9 +510,18 @@ func exportFormHandler(w http.ResponseWriter, r *http.Request) {
 func exportSupervisorHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Обработчик exportSupervisorHandler вызван")
 
-	if r.Method != "POST" {
+	// Руководитель выгружает только свои темы - ФИО из формы не используется
+	var own *models.Supervisor
+	if claims, err := utils.GetUserFromCookie(r); err == nil && claims.Role == "supervisor" {
+		var ok bool
+		if own, ok = currentSupervisor(w, r); !ok {
+			return
+		}
+	}
+
+	if own == nil && r.Method != "POST" {
 		log.Println("Метод не POST, показываем форму для руководителя")
-		showExportSupervisorForm(w)
+		showExportSupervisorForm(w, r)
 		return
 	}
 
@@ -366,6 +532,9 @@ func exportSupervisorHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	supervisor := r.FormValue("supervisor")
+	if own != nil {
+		supervisor = own.Name
+	}
 	log.Printf("Получен руководитель: %s", supervisor)
 
 	if supervisor == "" {
@@ -377,7 +546,23 @@ func exportSupervisorHandler(w http.ResponseWriter, r *http.Request) {
 	var topics []models.Topic
 	db := services.GetDB()
 
-	result := db.Where("supervisor = ?", supervisor).Find(&topics)
+	var condition *gorm.DB
+	if own != nil {
+		condition = db.Where("supervisor_id = ?", own.ID)
+	} else {
+		// Руководитель ищется в справочнике по ФИО (в т.ч. «Фамилия И.О.»);
+		// темы без привязки к справочнику - по тексту из импорта
+		condition = db.Where("supervisor_id IS NULL AND supervisor = ?", supervisor)
+		match, err := services.FindSupervisor(supervisor)
+		if err != nil {
+			log.Printf("Ошибка поиска руководителя: %v", err)
+		}
+		if match != nil {
+			condition = db.Where("supervisor_id = ?", match.ID).Or("supervisor_id IS NULL AND supervisor = ?", supervisor)
+		}
+	}
+	// Выгрузка - за текущий учебный период
+	result := db.Preload("Commission").Scopes(services.ActiveTermTopics, services.ApprovedTopics, services.WithMembers).Where(condition).Find(&topics)
 	if result.Error != nil {
 		log.Printf("Ошибка БД при поиске тем: %v", result.Error)
 		http.Error(w, "Ошибка базы данных: "+result.Error.Error(), http.StatusInternalServerError)
@@ -403,17 +588,34 @@ func exportSupervisorHandler(w http.ResponseWriter, r *http.Request) {
 	f.SetCellValue("Sheet1", "E1", "Статус")
 	f.SetCellValue("Sheet1", "F1", "Группа")
 	f.SetCellValue("Sheet1", "G1", "Описание")
-
-	// Заполняем данные
-	for i, topic := range topics {
-		row := i + 2
-		f.SetCellValue("Sheet1", fmt.Sprintf("A%d", row), topic.Title)
-		f.SetCellValue("Sheet1", fmt.Sprintf("B%d", row), topic.Subject)
-		f.SetCellValue("Sheet1", fmt.Sprintf("C%d", row), topic.WorkType)
-		f.SetCellValue("Sheet1", fmt.Sprintf("D%d", row), topic.Commission)
-		f.SetCellValue("Sheet1", fmt.Sprintf("E%d", row), topic.Status)
-		f.SetCellValue("Sheet1", fmt.Sprintf("F%d", row), topic.Group)
-		f.SetCellValue("Sheet1", fmt.Sprintf("G%d", row), topic.Description)
+	f.SetCellValue("Sheet1", "H1", "Студент")
+	f.SetCellValue("Sheet1", "I1", "Принят руководителем")
+	f.SetCellValue("Sheet1", "J1", "Мест на теме")
+
+	// Заполняем данные: по строке на каждого студента темы, у темы без студентов - одна строка
+	row := 1
+	for _, topic := range topics {
+		members := topic.Members
+		if len(members) == 0 {
+			members = []models.TopicMember{{}}
+		}
+		for _, member := range members {
+			row++
+			f.SetCellValue("Sheet1", fmt.Sprintf("A%d", row), topic.Title)
+			f.SetCellValue("Sheet1", fmt.Sprintf("B%d", row), topic.Subject)
+			f.SetCellValue("Sheet1", fmt.Sprintf("C%d", row), topic.WorkType)
+			f.SetCellValue("Sheet1", fmt.Sprintf("D%d", row), topic.CommissionLabel())
+			f.SetCellValue("Sheet1", fmt.Sprintf("E%d", row), topic.StateLabel())
+			f.SetCellValue("Sheet1", fmt.Sprintf("F%d", row), topic.Group)
+			f.SetCellValue("Sheet1", fmt.Sprintf("G%d", row), topic.Description)
+			if member.Student != nil {
+				f.SetCellValue("Sheet1", fmt.Sprintf("H%d", row), member.Student.Name)
+			}
+			if member.AcceptedAt != nil {
+				f.SetCellValue("Sheet1", fmt.Sprintf("I%d", row), member.AcceptedAt.Format("02.01.2006"))
+			}
+			f.SetCellValue("Sheet1", fmt.Sprintf("J%d", row), fmt.Sprintf("%d из %d", len(topic.Members), topic.Capacity))
+		}
 	}
 
 	// Устанавливаем заголовки ответа
@@ -431,7 +633,7 @@ func exportSupervisorHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Успешно отправлен Excel файл для руководителя %s", supervisor)
 }
 
-func showExportSupervisorForm(w http.ResponseWriter) {
+func showExportSupervisorForm(w http.ResponseWriter, r *http.Request) {
 	html := `<!DOCTYPE html>
 <html>
 <head>
@@ -516,6 +718,7 @@ func showExportSupervisorForm(w http.ResponseWriter) {
     <div class="container">
         <h2>Выгрузка данных по руководителю</h2>
         <form method="POST" action="/export-supervisor">
+            <input type="hidden" name="csrf_token" value="{{csrf}}">
             <div class="form-group">
                 <label for="supervisor">Введите ФИО руководителя:</label>
                 <input type="text" id="supervisor" name="supervisor" required placeholder="Например: Иванов И.И.">
@@ -526,6 +729,8 @@ func showExportSupervisorForm(w http.ResponseWriter) {
 </body>
 </html>`
 
+	html = strings.Replace(html, "{{csrf}}", utils.CSRFToken(r), 1)
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if _, err := w.Write([]byte(html)); err != nil {
 		log.Printf("Ошибка отправки формы: %v", err)
@@ -533,5 +738,9 @@ func showExportSupervisorForm(w http.ResponseWriter) {
 }
 
 func exportSupervisorFormHandler(w http.ResponseWriter, r *http.Request) {
-	templates.ExecuteTemplate(w, "exportSupervisor.html", nil)
+	if claims, err := utils.GetUserFromCookie(r); err == nil && claims.Role == "supervisor" {
+		http.Redirect(w, r, "/export-supervisor", http.StatusFound)
+		return
+	}
+	render(w, r, "exportSupervisor.html", nil)
 }
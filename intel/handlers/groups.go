@@ -0,0 +1,182 @@
+// справочник групп: кураторы, псевдонимы, объединение ошибочных групп
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"proj/intel/models"
+	"proj/intel/services"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// groupsRedirect - обратно на справочник; ошибка или итог показываются на странице
+func groupsRedirect(w http.ResponseWriter, r *http.Request, err error, notice string) {
+	target := "/admin/groups"
+	switch {
+	case err != nil:
+		target += "?error=" + url.QueryEscape(err.Error())
+	case notice != "":
+		target += "?notice=" + url.QueryEscape(notice)
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// groupActionDone - разбирает ошибку действия со справочником; false - ответ уже отправлен
+func groupActionDone(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Группа или куратор не найдены", http.StatusNotFound)
+	case errors.Is(err, services.ErrGroupCode), errors.Is(err, services.ErrGroupExists),
+		errors.Is(err, services.ErrAliasTaken), errors.Is(err, services.ErrSameGroup),
+		errors.Is(err, services.ErrNotCurator):
+		groupsRedirect(w, r, err, "")
+	default:
+		log.Printf("Ошибка справочника групп: %v", err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// AdminGroups - справочник групп: список, написания вне справочника, создание группы
+func AdminGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		year, _ := strconv.Atoi(r.FormValue("year"))
+		curatorID, err := formUintPtr(r, "curator_id")
+		if err != nil {
+			http.Error(w, "Invalid curator ID", http.StatusBadRequest)
+			return
+		}
+		group, err := services.CreateGroup(models.Groupfromcur{
+			Code:      r.FormValue("code"),
+			Specialty: r.FormValue("specialty"),
+			Year:      year,
+			CuratorID: curatorID,
+		})
+		if !groupActionDone(w, r, err) {
+			return
+		}
+		log.Printf("В справочник добавлена группа %s", group.Code)
+		groupsRedirect(w, r, nil, "Группа "+group.Code+" добавлена")
+		return
+	}
+
+	groups, err := services.ListGroups()
+	if err != nil {
+		log.Printf("Ошибка загрузки групп: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+	unknown, err := services.UnknownGroups()
+	if err != nil {
+		log.Printf("Ошибка поиска групп вне справочника: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+	var curators []models.User
+	if err := services.GetDB().Where("role = ?", "curator").Order("name").Find(&curators).Error; err != nil {
+		log.Printf("Ошибка загрузки кураторов: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, "groups.html", map[string]interface{}{
+		"Groups":   groups,
+		"Unknown":  unknown,
+		"Curators": curators,
+		"Error":    r.URL.Query().Get("error"),
+		"Notice":   r.URL.Query().Get("notice"),
+	})
+}
+
+// AdminGroupUpdate - специальность, курс и куратор группы
+func AdminGroupUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	groupID, err := strconv.ParseUint(r.FormValue("group_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	curatorID, err := formUintPtr(r, "curator_id")
+	if err != nil {
+		http.Error(w, "Invalid curator ID", http.StatusBadRequest)
+		return
+	}
+	year, _ := strconv.Atoi(r.FormValue("year"))
+
+	err = services.UpdateGroup(uint(groupID), r.FormValue("specialty"), year, curatorID)
+	if !groupActionDone(w, r, err) {
+		return
+	}
+	groupsRedirect(w, r, nil, "")
+}
+
+// AdminGroupAlias - другое написание группы: записи с ним приводятся к коду группы
+func AdminGroupAlias(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	groupID, err := strconv.ParseUint(r.FormValue("group_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	alias := r.FormValue("alias")
+	group, fixed, err := services.AddGroupAlias(uint(groupID), alias)
+	if !groupActionDone(w, r, err) {
+		return
+	}
+
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditGroupAlias,
+		TargetType: "group",
+		TargetID:   group.ID,
+		Summary:    fmt.Sprintf("Написание «%s» отнесено к группе %s, исправлено записей: %d", alias, group.Code, fixed),
+		After:      map[string]interface{}{"alias": alias, "group": group.Code, "fixed": fixed},
+	})
+	groupsRedirect(w, r, nil, fmt.Sprintf("«%s» теперь означает %s, исправлено записей: %d", alias, group.Code, fixed))
+}
+
+// AdminGroupMerge - ошибочная группа объединяется с правильной
+func AdminGroupMerge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	fromID, err := strconv.ParseUint(r.FormValue("from_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	intoID, err := strconv.ParseUint(r.FormValue("into_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	from, into, fixed, err := services.MergeGroups(uint(fromID), uint(intoID))
+	if !groupActionDone(w, r, err) {
+		return
+	}
+
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditGroupMerge,
+		TargetType: "group",
+		TargetID:   into.ID,
+		Summary:    fmt.Sprintf("Группа %s объединена с %s, исправлено записей: %d", from.Code, into.Code, fixed),
+		Before:     map[string]interface{}{"group_id": from.ID, "group": from.Code},
+		After:      map[string]interface{}{"group_id": into.ID, "group": into.Code, "fixed": fixed},
+	})
+	groupsRedirect(w, r, nil, fmt.Sprintf("Группа %s объединена с %s, исправлено записей: %d", from.Code, into.Code, fixed))
+}
@@ -6,43 +6,254 @@ import (
 	"net/http"
 	"os"
 	"proj/middleware"
+	"sort"
 )
 
+// routePolicies - политика доступа для каждого маршрута.
+// Маршрут без записи здесь не зарегистрируется: сервер не запустится
+var routePolicies = map[string]middleware.Policy{
+	// ──────  публичные (без авторизации)  ──────
+	"/static/":   middleware.Public,
+	"/register/": middleware.Public,
+	"/login/":    middleware.Public,
+	"/logout/":   middleware.Public,
+
+	// второй шаг входа: доступ по cookie промежуточного шага, а не по сессии
+	"/login/2fa":       middleware.Public,
+	"/login/2fa/setup": middleware.Public,
+
+	// вход через провайдера OpenID Connect
+	"/login/oidc":          middleware.Public,
+	"/login/oidc/callback": middleware.Public,
+
+	// ссылки из писем: доступ по подписанному токену
+	"/forgot-password": middleware.Public,
+	"/reset-password":  middleware.Public,
+	"/verify-email":    middleware.Public,
+
+	// ──────  любой вошедший пользователь  ──────
+	"/":                    middleware.Authenticated, // главная = панель по роли
+	"/dashboard/":          middleware.Authenticated,
+	"/student":             middleware.Authenticated,
+	"/sessions":            middleware.Authenticated,
+	"/sessions/revoke":     middleware.Authenticated,
+	"/sessions/logout-all": middleware.Authenticated,
+	"/2fa":                 middleware.Authenticated,
+	"/verify-email/resend": middleware.Authenticated,
+	"/pending":             middleware.Authenticated,
+	"/pending/group":       middleware.Authenticated,
+	"/tokens":              middleware.Authenticated,
+	"/tokens/revoke":       middleware.Authenticated,
+	"/impersonation/stop":  middleware.Authenticated,
+
+	// ──────  темы и студенты  ──────
+	"/students":          middleware.Require(middleware.PermStudentsManage),
+	"/studentsStar":      middleware.Require(middleware.PermStudentsView),
+	"/assign-topic":      middleware.Require(middleware.PermTopicsAssign),
+	"/assign-student":    middleware.Require(middleware.PermTopicsAssign),
+	"/remove-assignment": middleware.Require(middleware.PermTopicsAssign),
+	"/auto-assign":       middleware.Require(middleware.PermTopicsAutoAssign),
+	"/ruc/":              middleware.Require(middleware.PermHeadmenAssign),
+	"/addStarosta/":      middleware.Require(middleware.PermHeadmenAssign),
+	"/admin-upload":      middleware.Require(middleware.PermStudentsImport),
+	"/student/propose":   middleware.Require(middleware.PermTopicsPropose),
+	"/update-topic":      middleware.Require(middleware.PermTopicsPropose),
+
+	// ──────  заявки на смену темы  ──────
+	"/topic-requests":        middleware.Require(middleware.PermTopicRequests),
+	"/topic-requests/review": middleware.Require(middleware.PermTopicRequests),
+
+	// ──────  кабинет руководителя  ──────
+	"/supervisor":             middleware.Require(middleware.PermSupervisorDesk),
+	"/supervisor/decide":      middleware.Require(middleware.PermSupervisorDesk),
+	"/supervisor/description": middleware.Require(middleware.PermSupervisorDesk),
+	"/supervisor/state":       middleware.Require(middleware.PermSupervisorDesk),
+	"/supervisor/proposal":    middleware.Require(middleware.PermSupervisorDesk),
+
+	// ──────  кабинет куратора  ──────
+	"/curator":             middleware.Require(middleware.PermCuratorDesk),
+	"/curator/headman":     middleware.Require(middleware.PermCuratorDesk),
+	"/curator/auto-assign": middleware.Require(middleware.PermCuratorDesk),
+	"/curator/export":      middleware.Require(middleware.PermCuratorDesk),
+
+	// ──────  регистрация  ──────
+	"/registrations":                   middleware.Require(middleware.PermRegistrationApprove),
+	"/registrations/review":            middleware.Require(middleware.PermRegistrationApprove),
+	"/admin/registration":              middleware.Require(middleware.PermRegistrationSetup),
+	"/admin/registration/codes":        middleware.Require(middleware.PermRegistrationSetup),
+	"/admin/registration/codes/revoke": middleware.Require(middleware.PermRegistrationSetup),
+
+	// ──────  выгрузки  ──────
+	"/export-list":            middleware.Require(middleware.PermExportGroup),
+	"/export":                 middleware.Require(middleware.PermExportGroup),
+	"/export-form":            middleware.Require(middleware.PermExportGroup),
+	"/export-supervisor":      middleware.Require(middleware.PermExportSupervisor),
+	"/export-supervisor-form": middleware.Require(middleware.PermExportSupervisor),
+	"/list/export/department": middleware.Require(middleware.PermExportCommission),
+
+	// ──────  администрирование  ──────
+	"/admin/rotate-key":            middleware.Require(middleware.PermKeysRotate),
+	"/admin/users/role":            middleware.Require(middleware.PermUsersManage),
+	"/admin/users/disable":         middleware.Require(middleware.PermUsersManage),
+	"/admin/sessions":              middleware.Require(middleware.PermSessionsManage),
+	"/admin/sessions/revoke":       middleware.Require(middleware.PermSessionsManage),
+	"/admin/sessions/revoke-all":   middleware.Require(middleware.PermSessionsManage),
+	"/admin/login-attempts":        middleware.Require(middleware.PermLoginsReview),
+	"/admin/login-attempts/unlock": middleware.Require(middleware.PermLoginsReview),
+	"/admin/2fa-policy":            middleware.Require(middleware.PermSecurityPolicy),
+	"/admin/audit":                 middleware.Require(middleware.PermAuditView),
+	"/admin/audit/export":          middleware.Require(middleware.PermAuditView),
+	"/admin/impersonate":           middleware.Require(middleware.PermImpersonate),
+	"/admin/commissions":           middleware.Require(middleware.PermCommissionsManage),
+	"/admin/commissions/head":      middleware.Require(middleware.PermCommissionsManage),
+	"/admin/commissions/member":    middleware.Require(middleware.PermCommissionsManage),
+	"/admin/groups":                middleware.Require(middleware.PermGroupsManage),
+	"/admin/groups/update":         middleware.Require(middleware.PermGroupsManage),
+	"/admin/groups/alias":          middleware.Require(middleware.PermGroupsManage),
+	"/admin/groups/merge":          middleware.Require(middleware.PermGroupsManage),
+	"/admin/terms":                 middleware.Require(middleware.PermTermsManage),
+	"/admin/terms/rollover":        middleware.Require(middleware.PermTermsManage),
+	"/admin/topics":                middleware.Require(middleware.PermTopicsLifecycle),
+	"/admin/topics/state":          middleware.Require(middleware.PermTopicsLifecycle),
+}
+
+// routeTable - маршруты, зарегистрированные на mux, и ошибки таблицы политик
+type routeTable struct {
+	mux        *http.ServeMux
+	registered map[string]bool
+	missing    []string // маршруты без политики: они не регистрируются
+}
+
+// handle - регистрирует маршрут с его политикой доступа
+func (t *routeTable) handle(pattern string, handler http.HandlerFunc) {
+	policy, ok := routePolicies[pattern]
+	if !ok {
+		t.missing = append(t.missing, pattern)
+		return
+	}
+	t.registered[pattern] = true
+	t.mux.Handle(pattern, middleware.Protect(policy, handler))
+}
+
+// unusedPolicies - политики без маршрута: это опечатка в таблице
+func (t *routeTable) unusedPolicies() []string {
+	var unused []string
+	for pattern := range routePolicies {
+		if !t.registered[pattern] {
+			unused = append(unused, pattern)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
 // маршруты и их функции (переходят в файл indexTemp.go)
 
 func RegisterRouter() {
-	fs := http.FileServer(http.Dir("./static"))
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
+	t := registerRoutes(http.DefaultServeMux)
+	for _, pattern := range t.missing {
+		log.Fatalf("Для маршрута %s не задана политика доступа", pattern)
+	}
+	for _, pattern := range t.unusedPolicies() {
+		log.Fatalf("Политика для %s задана, но маршрут не зарегистрирован", pattern)
+	}
+	log.Printf("Server started, listening on %s", os.Getenv("ADDR"))
+}
 
-	// ──────  публичные (без авторизации)  ──────
-	http.HandleFunc("/register/", register)
-	http.HandleFunc("/login/", login)
-	http.HandleFunc("/logout/", logout)
+// registerRoutes - регистрирует все маршруты приложения на mux
+func registerRoutes(mux *http.ServeMux) *routeTable {
+	t := &routeTable{mux: mux, registered: map[string]bool{}}
 
-	http.HandleFunc("/assign-topic", AssignTopicToStudent)
-	http.HandleFunc("/assign-student", AssignStudentToTopic)
+	fs := http.StripPrefix("/static/", http.FileServer(http.Dir("./static")))
+	t.handle("/static/", fs.ServeHTTP)
 
-	http.HandleFunc("/export-list", exportList)
-	http.HandleFunc("/export", exportHandler)
-	http.HandleFunc("/export-form", exportFormHandler)
-	http.HandleFunc("/export-supervisor", exportSupervisorHandler)
-	http.HandleFunc("/export-supervisor-form", exportSupervisorFormHandler)
+	t.handle("/register/", register)
+	t.handle("/login/", login)
+	t.handle("/logout/", logout)
+	t.handle("/login/2fa", loginSecondFactor)
+	t.handle("/login/2fa/setup", loginTwoFactorSetup)
+	t.handle("/login/oidc", loginOIDC)
+	t.handle("/login/oidc/callback", loginOIDCCallback)
+	t.handle("/forgot-password", forgotPassword)
+	t.handle("/reset-password", resetPassword)
+	t.handle("/verify-email", verifyEmail)
+	t.handle("/verify-email/resend", ResendVerification)
 
-	http.HandleFunc("/student", StudentFunction)
+	t.handle("/", Dashboard)
+	t.handle("/dashboard/", Dashboard)
+	t.handle("/student", StudentFunction)
+	t.handle("/student/propose", StudentProposeTopic)
+	t.handle("/update-topic", UpdateTopic)
+	t.handle("/topic-requests", TopicRequests)
+	t.handle("/topic-requests/review", TopicRequestReview)
 
-	// ──────  защищённые  ──────
-	http.Handle("/dashboard/", middleware.CheckAuth(Dashboard))
-	http.Handle("/", middleware.CheckAuth(Dashboard)) // главная = админ‑панель
-	http.Handle("/students", middleware.RecoveryMiddleware(ListStudents))
-	http.Handle("/ruc/", middleware.CheckAuth(ruc))
-	// ✅ ИСПРАВЛЕННЫЕ маршруты для старост:
-	http.Handle("/addStarosta/", middleware.CheckAuth(http.HandlerFunc(addStatosta))) // Со слешем
+	t.handle("/students", ListStudents)
+	t.handle("/studentsStar", StudentsForStarosta)
+	t.handle("/assign-topic", AssignTopicToStudent)
+	t.handle("/assign-student", AssignStudentToTopic)
+	t.handle("/remove-assignment", RemoveAssignment)
+	t.handle("/auto-assign", AutoAssignTopics)
+	t.handle("/ruc/", ruc)
+	t.handle("/addStarosta/", addStatosta)
+	t.handle("/admin-upload", AdminFunction)
 
-	http.Handle("/admin-upload", http.HandlerFunc(AdminFunction)) // Уникальный путь
+	t.handle("/supervisor", SupervisorDashboard)
+	t.handle("/supervisor/decide", SupervisorDecide)
+	t.handle("/supervisor/description", SupervisorTopicDescription)
+	t.handle("/supervisor/state", SupervisorTopicState)
+	t.handle("/supervisor/proposal", SupervisorProposal)
 
-	http.Handle("/auto-assign", middleware.CheckAuth(http.HandlerFunc(AutoAssignTopics)))
-	http.Handle("/remove-assignment", middleware.CheckAuth(http.HandlerFunc(RemoveAssignment)))
-	http.Handle("/studentsStar", middleware.CheckAuth(http.HandlerFunc(StudentsForStarosta)))
+	t.handle("/curator", CuratorDashboard)
+	t.handle("/curator/headman", CuratorHeadman)
+	t.handle("/curator/auto-assign", CuratorAutoAssign)
+	t.handle("/curator/export", CuratorExport)
 
-	log.Printf("Server started, listening on %s", os.Getenv("ADDR"))
+	t.handle("/pending", PendingPage)
+	t.handle("/pending/group", PendingGroup)
+	t.handle("/registrations", PendingRegistrations)
+	t.handle("/registrations/review", ReviewRegistration)
+	t.handle("/admin/registration", AdminRegistrationSettings)
+	t.handle("/admin/registration/codes", AdminCreateEnrollmentCode)
+	t.handle("/admin/registration/codes/revoke", AdminRevokeEnrollmentCode)
+
+	t.handle("/export-list", exportList)
+	t.handle("/export", exportHandler)
+	t.handle("/export-form", exportFormHandler)
+	t.handle("/export-supervisor", exportSupervisorHandler)
+	t.handle("/export-supervisor-form", exportSupervisorFormHandler)
+	t.handle("/list/export/department", exportCommissionHandler)
+
+	t.handle("/admin/rotate-key", RotateJWTKey)
+	t.handle("/admin/users/role", AdminSetRole)
+	t.handle("/admin/users/disable", AdminSetDisabled)
+
+	t.handle("/sessions", MySessions)
+	t.handle("/sessions/revoke", RevokeMySession)
+	t.handle("/sessions/logout-all", LogoutEverywhere)
+	t.handle("/2fa", TwoFactorSettings)
+	t.handle("/tokens", APITokens)
+	t.handle("/tokens/revoke", RevokeAPIToken)
+	t.handle("/admin/sessions", AdminUserSessions)
+	t.handle("/admin/sessions/revoke", AdminRevokeSession)
+	t.handle("/admin/sessions/revoke-all", AdminRevokeUserSessions)
+	t.handle("/admin/login-attempts", AdminFailedLogins)
+	t.handle("/admin/login-attempts/unlock", AdminUnlockLogin)
+	t.handle("/admin/2fa-policy", AdminTwoFactorPolicy)
+	t.handle("/admin/audit", AdminAuditLog)
+	t.handle("/admin/audit/export", AdminAuditExport)
+	t.handle("/admin/impersonate", AdminImpersonate)
+	t.handle("/admin/commissions", AdminCommissions)
+	t.handle("/admin/commissions/head", AdminCommissionHead)
+	t.handle("/admin/commissions/member", AdminCommissionMember)
+	t.handle("/admin/groups", AdminGroups)
+	t.handle("/admin/groups/update", AdminGroupUpdate)
+	t.handle("/admin/groups/alias", AdminGroupAlias)
+	t.handle("/admin/groups/merge", AdminGroupMerge)
+	t.handle("/admin/terms", AdminTerms)
+	t.handle("/admin/terms/rollover", AdminTermRollover)
+	t.handle("/admin/topics", AdminTopics)
+	t.handle("/admin/topics/state", AdminTopicState)
+	t.handle(middleware.ImpersonationStopPath, StopImpersonation)
+
+	return t
 }
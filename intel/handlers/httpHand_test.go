@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+// Каждый зарегистрированный маршрут должен иметь политику, а каждая политика - маршрут
+func TestRoutePolicies(t *testing.T) {
+	table := registerRoutes(http.NewServeMux())
+
+	for _, pattern := range table.missing {
+		t.Errorf("маршрут %s зарегистрирован без политики доступа", pattern)
+	}
+	for _, pattern := range table.unusedPolicies() {
+		t.Errorf("политика для %s задана, но маршрут не зарегистрирован", pattern)
+	}
+	for pattern := range table.registered {
+		if _, ok := routePolicies[pattern]; !ok {
+			t.Errorf("маршрут %s зарегистрирован без политики доступа", pattern)
+		}
+	}
+	if len(table.registered) == 0 {
+		t.Fatal("не зарегистрировано ни одного маршрута")
+	}
+}
+
+// Маршрут без политики не попадает в mux, а отсутствие маршрута для политики замечается
+func TestRouteTableReportsGaps(t *testing.T) {
+	table := &routeTable{mux: http.NewServeMux(), registered: map[string]bool{}}
+	table.handle("/no-such-policy", func(http.ResponseWriter, *http.Request) {})
+
+	if len(table.missing) != 1 || table.missing[0] != "/no-such-policy" {
+		t.Fatalf("маршрут без политики не отмечен: %v", table.missing)
+	}
+	if table.registered["/no-such-policy"] {
+		t.Fatal("маршрут без политики зарегистрирован")
+	}
+	if len(table.unusedPolicies()) != len(routePolicies) {
+		t.Fatalf("ожидались все политики без маршрутов, получено %d из %d", len(table.unusedPolicies()), len(routePolicies))
+	}
+}
@@ -0,0 +1,109 @@
+// просмотр системы администратором от имени студента или старосты
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"proj/intel/services"
+	"proj/utils"
+
+	"gorm.io/gorm"
+)
+
+// AdminImpersonate - администратор открывает сессию от имени пользователя
+func AdminImpersonate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	allowWrite := r.FormValue("allow_write") == "on"
+	session, target, err := services.StartImpersonation(claims.UserID, claims.SessionID(),
+		r.FormValue("email"), allowWrite, r.UserAgent(), utils.ClientIP(r))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrImpersonationTarget), errors.Is(err, services.ErrUserDisabled):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Ошибка входа от имени пользователя: %v", err)
+		http.Error(w, "Ошибка создания сессии", http.StatusInternalServerError)
+		return
+	}
+
+	mode := "только просмотр"
+	if allowWrite {
+		mode = "с правом изменений"
+	}
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditImpersonate,
+		TargetType: "user",
+		TargetID:   target.ID,
+		Summary:    fmt.Sprintf("Начат просмотр от имени %s (%s), %s", target.Name, target.Email, mode),
+		After:      map[string]interface{}{"session": session.ID[:8], "allow_write": allowWrite, "expires_at": session.ExpiresAt},
+	})
+
+	if err := utils.SetJWTCookie(w, session.ID, target.ID, target.Email, target.Role); err != nil {
+		http.Error(w, "Ошибка создания сессии", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Администратор %s вошёл от имени %s", claims.Email, target.Email)
+	http.Redirect(w, r, "/dashboard/", http.StatusSeeOther)
+}
+
+// StopImpersonation - завершение просмотра и возврат в свою сессию
+func StopImpersonation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	session, err := services.GetActiveSession(claims.SessionID())
+	if err != nil || !session.Impersonated() {
+		http.Redirect(w, r, "/dashboard/", http.StatusSeeOther)
+		return
+	}
+
+	// Запись делаем до отзыва: после него сессия уже не действует
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditImpersonate,
+		TargetType: "user",
+		TargetID:   claims.UserID,
+		Summary:    fmt.Sprintf("Завершён просмотр от имени %s", claims.Email),
+		Before:     map[string]interface{}{"session": session.ID[:8]},
+	})
+
+	parent, err := services.StopImpersonation(session)
+	if err != nil {
+		// Исходная сессия администратора истекла или отозвана - входим заново
+		utils.ClearJWTCookie(w)
+		http.Redirect(w, r, "/login/", http.StatusSeeOther)
+		return
+	}
+
+	auth, err := services.ResolveUserAuth(parent.UserID)
+	if err != nil {
+		utils.ClearJWTCookie(w)
+		http.Redirect(w, r, "/login/", http.StatusSeeOther)
+		return
+	}
+	if err := utils.SetJWTCookie(w, parent.ID, auth.UserID, auth.Email, auth.Role); err != nil {
+		http.Error(w, "Ошибка создания сессии", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Администратор %s завершил просмотр от имени %s", auth.Email, claims.Email)
+	http.Redirect(w, r, "/dashboard/", http.StatusSeeOther)
+}
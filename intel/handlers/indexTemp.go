@@ -3,6 +3,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -26,6 +27,10 @@ func Dashboard(w http.ResponseWriter, r *http.Request) {
 		StudentFunction(w, r)
 	case "headman":
 		StudentsForStarosta(w, r)
+	case "supervisor":
+		SupervisorDashboard(w, r)
+	case "curator":
+		CuratorDashboard(w, r)
 	default:
 		http.Redirect(w, r, "/login", http.StatusFound)
 	}
@@ -39,9 +44,10 @@ func StudentFunction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Получаем данные студента из БД
+	// Получаем данные студента из БД вместе с назначенной темой
 	var student models.User
-	if err := services.GetDB().First(&student, claims.UserID).Error; err != nil {
+	if err := services.GetDB().Scopes(services.WithCurrentTopic).Preload("Membership.Topic.Members.Student").
+		First(&student, claims.UserID).Error; err != nil {
 		http.Error(w, "Студент не найден", http.StatusNotFound)
 		return
 	}
@@ -51,19 +57,51 @@ func StudentFunction(w http.ResponseWriter, r *http.Request) {
 
 	// Подготавливаем данные для шаблона
 	data := struct {
-		User     models.User
-		HasTopic bool
-		Topic    string
-		Initials string
+		User        models.User
+		HasTopic    bool
+		Topic       string
+		Team        string // все, кто выполняет командную тему
+		Initials    string
+		Proposals   []models.Topic      // темы, предложенные студентом в текущем периоде
+		Pending     bool                // предложение ещё рассматривается
+		Supervisors []models.Supervisor // для выбора руководителя предлагаемой темы
+		Requests    []models.TopicChangeRequest
+		FreeTopics  []models.Topic // открытые темы, на которые можно попросить смену
+		Error       string
 	}{
 		User:     student,
-		HasTopic: student.Topic != "",
-		Topic:    student.Topic,
+		HasTopic: student.CurrentTopic() != nil,
+		Topic:    topicTitle(student.CurrentTopic()),
 		Initials: initials,
+		Error:    r.URL.Query().Get("error"),
+	}
+	if topic := student.CurrentTopic(); topic != nil && topic.Team() {
+		data.Team = topic.StudentNames()
+	}
+	if data.Proposals, err = services.StudentProposals(student.ID); err != nil {
+		log.Printf("Ошибка загрузки предложений тем: %v", err)
+	}
+	for _, p := range data.Proposals {
+		if p.Status == models.TopicDraft || p.Status == models.TopicProposed {
+			data.Pending = true
+		}
+	}
+	if !data.HasTopic {
+		if data.Supervisors, err = services.ListSupervisors(); err != nil {
+			log.Printf("Ошибка загрузки руководителей: %v", err)
+		}
+	}
+	if data.Requests, err = services.StudentTopicRequests(student.ID); err != nil {
+		log.Printf("Ошибка загрузки заявок на смену темы: %v", err)
+	}
+	if data.HasTopic && (len(data.Requests) == 0 || !data.Requests[0].Pending()) {
+		if data.FreeTopics, err = services.GroupFreeTopics(student.Group); err != nil {
+			log.Printf("Ошибка загрузки свободных тем: %v", err)
+		}
 	}
 
 	// Выполняем шаблон
-	templates.ExecuteTemplate(w, "student.html", data)
+	render(w, r, "student.html", data)
 }
 
 // Функция для генерации инициалов из имени
@@ -82,17 +120,6 @@ func AdminFunction(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Method: %s", r.Method)
 	log.Printf("Content-Type: %s", r.Header.Get("Content-Type"))
 
-	// Добавьте CORS заголовки
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		log.Printf("OPTIONS request handled")
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	claims, err := utils.GetUserFromCookie(r)
 	if err != nil {
 		log.Printf("Auth error: %v", err)
@@ -101,6 +128,7 @@ func AdminFunction(w http.ResponseWriter, r *http.Request) {
 	}
 	if claims.Role != "admin" {
 		http.Redirect(w, r, "/studentsStar", http.StatusSeeOther)
+		return
 	}
 	if r.Method == http.MethodPost {
 		log.Printf("Starting file upload processing")
@@ -123,7 +151,7 @@ func AdminFunction(w http.ResponseWriter, r *http.Request) {
 		log.Printf("File type: %s", fileType)
 
 		// Обрабатываем Excel файл
-		result := processExcelFile(file, fileType)
+		result := processExcelFile(file, fileType, header.Filename, auditActor(r))
 		log.Printf("Processing result: %+v", result)
 
 		w.Header().Set("Content-Type", "application/json")
@@ -138,7 +166,29 @@ func AdminFunction(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("GET request - serving admin page")
-	templates.ExecuteTemplate(w, "admin.html", nil)
+	render(w, r, "admin.html", nil)
+}
+
+// RotateJWTKey - выпускает новый ключ подписи JWT (только для администратора)
+func RotateJWTKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key, err := utils.Keys().Rotate()
+	if err != nil {
+		log.Printf("Ошибка ротации ключа: %v", err)
+		sendError(w, "Ошибка смены ключа: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Новый ключ %s выпущен", key.ID),
+		"kid":     key.ID,
+	})
 }
 
 func ListStudents(w http.ResponseWriter, r *http.Request) {
@@ -149,8 +199,9 @@ func ListStudents(w http.ResponseWriter, r *http.Request) {
 	}
 	if claims.Role != "admin" {
 		http.Redirect(w, r, "/studentsStar", http.StatusSeeOther)
+		return
 	}
-	data, err := GetAllTopicsData()
+	data, err := GetAllTopicsData(services.GroupScope{All: true})
 	if err != nil {
 		log.Printf("Ошибка получения данных: %v", err)
 		http.Error(w, "Ошибка загрузки данных: "+err.Error(), http.StatusInternalServerError)
@@ -159,7 +210,7 @@ func ListStudents(w http.ResponseWriter, r *http.Request) {
 
 	data["Title"] = "Управление студентами и темами"
 
-	err = templates.ExecuteTemplate(w, "listStudents.html", data)
+	err = render(w, r, "listStudents.html", data)
 	if err != nil {
 		log.Printf("Ошибка выполнения шаблона: %v", err)
 		http.Error(w, "Ошибка отображения страницы", http.StatusInternalServerError)
@@ -174,41 +225,13 @@ func ruc(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if r.Method == http.MethodPost {
-		studentEmail := r.FormValue("student_email")
-		headmanGroup := r.FormValue("headman_group")
-
-		fmt.Printf("Получены данные: email=%s, group=%s\n", studentEmail, headmanGroup)
-
-		db := services.GetDB()
-
-		// Находим студента по email (УБЕРИ проверку роли)
-		var student models.User
-		result := db.Where("email = ?", studentEmail).First(&student)
-
-		if result.Error != nil {
-			fmt.Printf("Ошибка поиска студента: %v\n", result.Error)
-			http.Error(w, "Студент не найден", http.StatusBadRequest)
-			return
-		}
-
-		fmt.Printf("Найден студент: %s, текущая роль: %s\n", student.Name, student.Role)
-
-		// Меняем роль на headman и назначаем группу
-		student.Role = "headman"
-
-		result = db.Save(&student)
-		if result.Error != nil {
-			fmt.Printf("Ошибка сохранения: %v\n", result.Error)
-			http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
-			return
+		if appointHeadman(w, r) {
+			http.Redirect(w, r, "/studentsStar/", http.StatusFound)
 		}
-
-		fmt.Printf("Роль успешно изменена на: %s\n", student.Role)
-		http.Redirect(w, r, "/studentsStar/", http.StatusFound)
 		return
 	}
 
-	templates.ExecuteTemplate(w, "rucCreate.html", nil)
+	render(w, r, "rucCreate.html", nil)
 }
 func addStatosta(w http.ResponseWriter, r *http.Request) {
 	_, err := utils.GetUserFromCookie(r)
@@ -218,61 +241,73 @@ func addStatosta(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == http.MethodPost {
-		// Парсим форму
-		if err := r.ParseForm(); err != nil {
-			http.Error(w, "Ошибка парсинга формы", http.StatusBadRequest)
-			return
+		if appointHeadman(w, r) {
+			http.Redirect(w, r, "/", http.StatusFound)
 		}
+		return
+	}
+	render(w, r, "starostaCreate.html", nil)
+}
 
-		studentEmail := r.FormValue("student_email")
-		headmanGroup := r.FormValue("headman_group")
-
-		fmt.Printf("Получены данные: email=%s, group=%s\n", studentEmail, headmanGroup)
-
-		db := services.GetDB()
-
-		// Находим студента по email
-		var student models.User
-		result := db.Where("email = ?", studentEmail).First(&student)
-
-		if result.Error != nil {
-			fmt.Printf("Ошибка поиска студента: %v\n", result.Error)
-			http.Error(w, "Студент не найден", http.StatusBadRequest)
-			return
-		}
-
-		fmt.Printf("Найден студент: %s, текущая роль: %s, группа: %s\n",
-			student.Name, student.Role, student.Group)
-
-		// Меняем роль на headman и назначаем HeadmanGroup
-		student.Role = "headman"
-		student.HeadmanGroup = headmanGroup
+// appointHeadman - назначает старостой студента группы из формы (student_email, headman_group).
+// Куратор назначает старост только своих групп, и только из студентов этой группы
+func appointHeadman(w http.ResponseWriter, r *http.Request) bool {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Ошибка парсинга формы", http.StatusBadRequest)
+		return false
+	}
+	scope, ok := managedGroups(w, r)
+	if !ok {
+		return false
+	}
 
-		result = db.Save(&student)
-		if result.Error != nil {
-			fmt.Printf("Ошибка сохранения: %v\n", result.Error)
-			http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
-			return
+	group, err := services.CanonicalGroup(r.FormValue("headman_group"))
+	if err != nil {
+		if errors.Is(err, services.ErrGroupUnknown) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return false
 		}
+		log.Printf("Ошибка поиска группы: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return false
+	}
+	if !scope.Allows(group) {
+		http.Error(w, services.ErrOutsideScope.Error(), http.StatusForbidden)
+		return false
+	}
 
-		fmt.Printf("Студент назначен старостой! Роль: %s, Ответственная группа: %s\n",
-			student.Role, student.HeadmanGroup)
+	var student models.User
+	if err := services.GetDB().Where("email = ?", strings.TrimSpace(r.FormValue("student_email"))).
+		First(&student).Error; err != nil {
+		http.Error(w, "Студент не найден", http.StatusBadRequest)
+		return false
+	}
+	if _, err := services.GroupMember(group, student.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
 
-		http.Redirect(w, r, "/", http.StatusFound)
-		return
+	// Сервис сбрасывает кэш прав, роль применится сразу
+	before := student
+	if err := services.SetUserRole(&student, "headman", group); err != nil {
+		log.Printf("Ошибка смены роли: %v", err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+		return false
 	}
-	templates.ExecuteTemplate(w, "starostaCreate.html", nil)
+	auditRoleChange(r, before, student)
+	log.Printf("%s назначен старостой группы %s", student.Email, group)
+	return true
 }
 
 func StudentsForStarosta(w http.ResponseWriter, r *http.Request) {
-	_, err := utils.GetUserFromCookie(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
+	// Староста и куратор видят только свои группы, администратор - все
+	scope, ok := managedGroups(w, r)
+	if !ok {
 		return
 	}
 
 	// Получаем реальные данные из базы
-	data, err := GetAllTopicsData()
+	data, err := GetAllTopicsData(scope)
 	if err != nil {
 		log.Printf("Ошибка получения данных: %v", err)
 		http.Error(w, "Ошибка загрузки данных: "+err.Error(), http.StatusInternalServerError)
@@ -283,7 +318,7 @@ func StudentsForStarosta(w http.ResponseWriter, r *http.Request) {
 	data["Title"] = "Управление студентами и темами"
 
 	// Выполн+яем шаблон
-	err = templates.ExecuteTemplate(w, "listStudentforStarosta.html", data)
+	err = render(w, r, "listStudentforStarosta.html", data)
 	if err != nil {
 		log.Printf("Ошибка выполнения шаблона: %v", err)
 		http.Error(w, "Ошибка отображения страницы", http.StatusInternalServerError)
@@ -292,5 +327,5 @@ func StudentsForStarosta(w http.ResponseWriter, r *http.Request) {
 }
 
 func exportList(w http.ResponseWriter, r *http.Request) {
-	templates.ExecuteTemplate(w, "listexport.html", nil)
+	render(w, r, "listexport.html", nil)
 }
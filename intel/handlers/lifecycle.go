@@ -0,0 +1,88 @@
+// жизненный цикл тем: состояния, переходы и их история
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"proj/intel/models"
+	"proj/intel/services"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// auditTopicState - запись в журнал о смене состояния темы
+func auditTopicState(r *http.Request, topic models.Topic, from string) {
+	if topic.Status == from {
+		return
+	}
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditTopicState,
+		TargetType: "topic",
+		TargetID:   topic.ID,
+		Summary: fmt.Sprintf("Тема «%s»: %s → %s", topic.Title,
+			models.TopicStateLabel(from), topic.StateLabel()),
+		Before: map[string]interface{}{"status": from},
+		After:  map[string]interface{}{"status": topic.Status},
+	})
+}
+
+// AdminTopics - темы текущего периода с состояниями и историей переходов
+func AdminTopics(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	if state != "" && !models.IsTopicState(state) {
+		state = ""
+	}
+	topics, err := services.LifecycleTopics(state)
+	if err != nil {
+		log.Printf("Ошибка загрузки тем: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+
+	states := make([]models.TopicMove, 0, len(models.TopicStates))
+	for _, s := range models.TopicStates {
+		states = append(states, models.TopicMove{To: s, Label: models.TopicStateLabel(s)})
+	}
+	render(w, r, "topics.html", map[string]interface{}{
+		"Topics": topics,
+		"States": states,
+		"State":  state,
+		"Error":  r.URL.Query().Get("error"),
+	})
+}
+
+// AdminTopicState - перевод темы в другое состояние
+func AdminTopicState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	topicID, err := strconv.ParseUint(r.FormValue("topic_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid topic ID", http.StatusBadRequest)
+		return
+	}
+
+	topic, from, err := services.ChangeTopicState(uint(topicID), r.FormValue("state"), auditActor(r), r.FormValue("note"))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Тема не найдена", http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrTopicMove), errors.Is(err, services.ErrTopicChanged),
+		errors.Is(err, services.ErrTopicAutoMove), errors.Is(err, services.ErrTopicHasMembers),
+		errors.Is(err, services.ErrTopicNoMembers):
+		http.Redirect(w, r, "/admin/topics?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Printf("Ошибка смены состояния темы %d: %v", topicID, err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+		return
+	}
+	auditTopicState(r, topic, from)
+
+	http.Redirect(w, r, "/admin/topics", http.StatusSeeOther)
+}
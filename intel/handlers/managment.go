@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -9,6 +10,7 @@ import (
 	"proj/intel/models"
 	"proj/intel/services"
 	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -21,19 +23,19 @@ type StudentWithTopic struct {
 	Topic models.Topic `json:"topic"`
 }
 
-// Получение всех данных для шаблона
-func GetAllTopicsData() (map[string]interface{}, error) {
-	studentsWithTopics, err := GetStudentsWithTopics()
+// Получение всех данных для шаблона по группам зоны ответственности
+func GetAllTopicsData(scope services.GroupScope) (map[string]interface{}, error) {
+	studentsWithTopics, err := GetStudentsWithTopics(scope)
 	if err != nil {
 		return nil, err
 	}
 
-	studentsWithoutTopics, err := GetStudentsWithoutTopics()
+	studentsWithoutTopics, err := GetStudentsWithoutTopics(scope)
 	if err != nil {
 		return nil, err
 	}
 
-	freeTopics, err := GetFreeTopics()
+	freeTopics, err := GetFreeTopics(scope)
 	if err != nil {
 		return nil, err
 	}
@@ -45,24 +47,24 @@ func GetAllTopicsData() (map[string]interface{}, error) {
 	}, nil
 }
 
-func GetStudentsWithTopics() ([]StudentWithTopic, error) {
-	db := services.GetDB()
-	var studentsWithTopics []StudentWithTopic
-
+func GetStudentsWithTopics(scope services.GroupScope) ([]StudentWithTopic, error) {
 	var users []models.User
-	err := db.Where("role = ? AND id IN (SELECT student_id FROM topics WHERE student_id IS NOT NULL)", "student").
+	db := services.GetDB()
+	assigned := db.Model(&models.TopicMember{}).Select("student_id").Scopes(services.ActiveTermMembers)
+	err := db.Scopes(services.WithCurrentTopic, scope.Students).Preload("Membership.Topic.Supervisor").
+		Preload("Membership.Topic.Members.Student").
+		Where("role = ? AND id IN (?)", "student", assigned).
 		Find(&users).Error
 	if err != nil {
 		return nil, err
 	}
 
+	studentsWithTopics := make([]StudentWithTopic, 0, len(users))
 	for _, user := range users {
-		var topic models.Topic
-		err := db.Where("student_id = ?", user.ID).First(&topic).Error
-		if err == nil {
+		if topic := user.CurrentTopic(); topic != nil {
 			studentsWithTopics = append(studentsWithTopics, StudentWithTopic{
 				User:  user,
-				Topic: topic,
+				Topic: *topic,
 			})
 		}
 	}
@@ -71,23 +73,67 @@ func GetStudentsWithTopics() ([]StudentWithTopic, error) {
 }
 
 // Студенты без тем
-func GetStudentsWithoutTopics() ([]models.User, error) {
+func GetStudentsWithoutTopics(scope services.GroupScope) ([]models.User, error) {
 	var students []models.User
-	db := services.GetDB()
-	err := db.Where("role = ? AND id NOT IN (SELECT student_id FROM topics WHERE student_id IS NOT NULL)", "student").
+	err := services.GetDB().Scopes(services.WithoutTopic, scope.Students).
+		Where("role = ?", "student").
 		Find(&students).Error
 
 	return students, err
 }
 
-// Свободные темы
-func GetFreeTopics() ([]models.Topic, error) {
+// Темы, на которых остались места; у командных тем подгружены уже назначенные студенты
+func GetFreeTopics(scope services.GroupScope) ([]models.Topic, error) {
 	var topics []models.Topic
-	db := services.GetDB()
-	err := db.Where("status = ? OR student_id IS NULL OR student_id = 0", "free").Find(&topics).Error
+	err := services.GetDB().Preload("Supervisor").Preload("Commission").
+		Scopes(services.ActiveTermTopics, services.FreeTopics, services.WithMembers, scope.Topics).Find(&topics).Error
 	return topics, err
 }
 
+// topicTitle - название темы для журнала ("" - темы нет)
+func topicTitle(topic *models.Topic) string {
+	if topic == nil {
+		return ""
+	}
+	return topic.Title
+}
+
+// memberIDs - ID студентов, назначенных на тему, для журнала
+func memberIDs(members []models.TopicMember) []uint {
+	ids := make([]uint, 0, len(members))
+	for _, m := range members {
+		ids = append(ids, m.StudentID)
+	}
+	return ids
+}
+
+// withoutMember - ID студентов темы после снятия одного из них
+func withoutMember(members []models.TopicMember, studentID uint) []uint {
+	ids := make([]uint, 0, len(members))
+	for _, m := range members {
+		if m.StudentID != studentID {
+			ids = append(ids, m.StudentID)
+		}
+	}
+	return ids
+}
+
+// managedGroups - группы, с которыми работает вошедший пользователь: староста - своя,
+// куратор - закреплённые за ним, администратор - все. При ошибке ответ уже отправлен
+func managedGroups(w http.ResponseWriter, r *http.Request) (services.GroupScope, bool) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return services.GroupScope{}, false
+	}
+	scope, err := services.ManagedGroups(user)
+	if err != nil {
+		log.Printf("Ошибка загрузки групп пользователя %s: %v", user.Email, err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return scope, false
+	}
+	return scope, true
+}
+
 func AssignTopicToStudent(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -112,33 +158,65 @@ func AssignTopicToStudent(w http.ResponseWriter, r *http.Request) {
 
 	db := services.GetDB()
 
-	// Обновляем тему - назначаем студента
-	result := db.Model(&models.Topic{}).
-		Where("id = ?", topicIDUint).
-		Updates(map[string]interface{}{
-			"student_id": uint(studentIDUint),
-			"status":     "assigned",
-		})
-
-	if result.Error != nil {
-		http.Error(w, "Failed to assign topic", http.StatusInternalServerError)
+	// Состояние до изменения - для журнала
+	var topic models.Topic
+	if err := db.Preload("Members").First(&topic, topicIDUint).Error; err != nil {
+		http.Error(w, "Topic not found", http.StatusNotFound)
 		return
 	}
+	var student models.User
+	if err := db.First(&student, studentIDUint).Error; err != nil {
+		http.Error(w, "Student not found", http.StatusNotFound)
+		return
+	}
+	// Староста и куратор назначают темы только студентам своих групп
+	scope, ok := managedGroups(w, r)
+	if !ok {
+		return
+	}
+	if !scope.Allows(student.Group) || (topic.Group != "" && !scope.Allows(topic.Group)) {
+		http.Error(w, services.ErrOutsideScope.Error(), http.StatusForbidden)
+		return
+	}
+	previous, err := services.StudentTopic(student.ID)
+	if err != nil {
+		http.Error(w, "Failed to load student topic", http.StatusInternalServerError)
+		return
+	}
+	before := map[string]interface{}{
+		"topic_members": memberIDs(topic.Members),
+		"topic_status":  topic.Status,
+		"student_topic": topicTitle(previous),
+	}
 
-	// Обновляем студента - записываем тему
-	result = db.Model(&models.User{}).
-		Where("id = ?", studentIDUint).
-		Update("topic", func() string {
-			var topic models.Topic
-			db.First(&topic, topicIDUint)
-			return topic.Title
-		}())
-
-	if result.Error != nil {
-		http.Error(w, "Failed to update student", http.StatusInternalServerError)
+	// Назначение хранится в topic_members; на командную тему назначаются, пока есть места
+	if err := services.AssignTopic(topic.ID, student.ID, auditActor(r)); err != nil {
+		if errors.Is(err, services.ErrNotStudent) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrTopicFull) || errors.Is(err, services.ErrTopicArchived) ||
+			errors.Is(err, services.ErrTopicNotOpen) || errors.Is(err, services.ErrTopicInWork) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("Ошибка назначения темы %d студенту %d: %v", topic.ID, student.ID, err)
+		http.Error(w, "Failed to assign topic", http.StatusInternalServerError)
 		return
 	}
 
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditTopicAssign,
+		TargetType: "topic",
+		TargetID:   topic.ID,
+		Summary:    fmt.Sprintf("Тема «%s» назначена студенту %s (%s)", topic.Title, student.Name, student.Email),
+		Before:     before,
+		After: map[string]interface{}{
+			"topic_members": append(memberIDs(topic.Members), student.ID),
+			"student_topic": topic.Title,
+		},
+	})
+
 	http.Redirect(w, r, "/students", http.StatusSeeOther)
 }
 
@@ -169,81 +247,129 @@ func AutoAssignTopics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db := services.GetDB()
-
-	// Получаем студентов без тем
-	var studentsWithoutTopics []models.User
-	err := db.Where("role = ? AND (topic = '' OR topic IS NULL)", "student").Find(&studentsWithoutTopics).Error
-	if err != nil {
-		http.Error(w, "Ошибка получения студентов: "+err.Error(), http.StatusInternalServerError)
+	// Администратор распределяет темы среди всех студентов, староста и куратор - по своим группам
+	scope, ok := managedGroups(w, r)
+	if !ok {
 		return
 	}
-
-	// Получаем свободные темы
-	var freeTopics []models.Topic
-	err = db.Where("status = 'free' OR student_id IS NULL OR student_id = 0").Find(&freeTopics).Error
-	if err != nil {
-		http.Error(w, "Ошибка получения тем: "+err.Error(), http.StatusInternalServerError)
+	groups := scope.Groups
+	if scope.All {
+		groups = []string{""}
+	}
+	if len(groups) == 0 {
+		http.Error(w, services.ErrOutsideScope.Error(), http.StatusForbidden)
 		return
 	}
 
-	// Проверяем, что есть что распределять
-	if len(studentsWithoutTopics) == 0 {
+	var assigned []map[string]interface{}
+	var count, studentsTotal, topicsTotal int
+	for _, group := range groups {
+		studentsWithoutTopics, freeTopics, err := autoAssignPool(group)
+		if err != nil {
+			http.Error(w, "Ошибка получения данных: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		studentsTotal += len(studentsWithoutTopics)
+		topicsTotal += len(freeTopics)
+		if len(studentsWithoutTopics) == 0 || len(freeTopics) == 0 {
+			continue
+		}
+		groupAssigned, groupCount := distributeTopics(studentsWithoutTopics, freeTopics, auditActor(r))
+		assigned = append(assigned, groupAssigned...)
+		count += groupCount
+	}
+
+	// Проверяем, что было что распределять
+	if studentsTotal == 0 {
 		http.Error(w, "Нет студентов без тем", http.StatusBadRequest)
 		return
 	}
 
-	if len(freeTopics) == 0 {
+	if topicsTotal == 0 {
 		http.Error(w, "Нет свободных тем", http.StatusBadRequest)
 		return
 	}
 
-	// Перемешиваем студентов и темы для случайного распределения
-	shuffledStudents := shuffleStudents(studentsWithoutTopics)
-	shuffledTopics := shuffleTopics(freeTopics)
+	assignedCount := len(assigned)
+	summary := fmt.Sprintf("Автораспределение: назначено %d тем (студентов без темы: %d, свободных тем: %d)",
+		assignedCount, studentsTotal, topicsTotal)
+	if !scope.All {
+		summary += ", группы: " + strings.Join(scope.Groups, ", ")
+	}
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditTopicAuto,
+		TargetType: "topic",
+		Summary:    summary,
+		After:      assigned,
+	})
+
+	// Возвращаем результат
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"message":        fmt.Sprintf("Успешно распределено %d тем из %d возможных", assignedCount, count),
+		"assigned":       assignedCount,
+		"total_possible": count,
+	})
+}
+
+// autoAssignPool - студенты без тем и свободные темы. Для группы - только её студенты
+// и темы этой группы или без группы; пустая группа - все
+func autoAssignPool(group string) ([]models.User, []models.Topic, error) {
+	if group == "" {
+		all := services.GroupScope{All: true}
+		students, err := GetStudentsWithoutTopics(all)
+		if err != nil {
+			return nil, nil, err
+		}
+		topics, err := GetFreeTopics(all)
+		return students, topics, err
+	}
+	students, err := services.GroupStudentsWithoutTopic(group)
+	if err != nil {
+		return nil, nil, err
+	}
+	topics, err := services.GroupFreeTopics(group)
+	return students, topics, err
+}
+
+// distributeTopics - случайно раздаёт свободные места на темах студентам без тем.
+// Командная тема участвует столько раз, сколько на ней мест; у тем должны быть подгружены Members.
+// Возвращает назначения для журнала и сколько назначений было возможно
+func distributeTopics(students []models.User, topics []models.Topic, actor services.Actor) ([]map[string]interface{}, int) {
+	var places []models.Topic
+	for _, topic := range topics {
+		for i := 0; i < topic.Places(); i++ {
+			places = append(places, topic)
+		}
+	}
+
+	// Перемешиваем студентов и места для случайного распределения
+	shuffledStudents := shuffleStudents(students)
+	shuffledTopics := shuffleTopics(places)
 
-	// Распределяем темы (берем минимум из количества студентов и тем)
+	// Распределяем темы (берем минимум из количества студентов и мест)
 	count := min(len(shuffledStudents), len(shuffledTopics))
-	assignedCount := 0
+	var assigned []map[string]interface{}
 
 	for i := 0; i < count; i++ {
 		student := shuffledStudents[i]
 		topic := shuffledTopics[i]
 
 		// Назначаем тему студенту
-		err := db.Model(&models.Topic{}).
-			Where("id = ?", topic.ID).
-			Updates(map[string]interface{}{
-				"student_id": student.ID,
-				"status":     "assigned",
-			}).Error
-
-		if err != nil {
+		if err := services.AssignTopic(topic.ID, student.ID, actor); err != nil {
 			log.Printf("Ошибка назначения темы %d студенту %d: %v", topic.ID, student.ID, err)
 			continue
 		}
 
-		// Обновляем тему у студента
-		err = db.Model(&models.User{}).
-			Where("id = ?", student.ID).
-			Update("topic", topic.Title).Error
-
-		if err != nil {
-			log.Printf("Ошибка обновления студента %d: %v", student.ID, err)
-			continue
-		}
-
-		assignedCount++
+		assigned = append(assigned, map[string]interface{}{
+			"student_id": student.ID,
+			"student":    student.Email,
+			"topic_id":   topic.ID,
+			"topic":      topic.Title,
+		})
 	}
-
-	// Возвращаем результат
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":        true,
-		"message":        fmt.Sprintf("Успешно распределено %d тем из %d возможных", assignedCount, count),
-		"assigned":       assignedCount,
-		"total_possible": count,
-	})
+	return assigned, count
 }
 
 // Функции для перемешивания
@@ -291,29 +417,52 @@ func RemoveAssignment(w http.ResponseWriter, r *http.Request) {
 
 	db := services.GetDB()
 
-	// Освобождаем тему
-	err := db.Model(&models.Topic{}).
-		Where("id = ?", topicID).
-		Updates(map[string]interface{}{
-			"student_id": nil,
-			"status":     "free",
-		}).Error
-
-	if err != nil {
-		http.Error(w, "Ошибка освобождения темы", http.StatusInternalServerError)
+	// Состояние до изменения - для журнала
+	var topic models.Topic
+	if err := db.Preload("Members").First(&topic, topicID).Error; err != nil {
+		http.Error(w, "Тема не найдена", http.StatusNotFound)
+		return
+	}
+	var student models.User
+	if err := db.First(&student, studentID).Error; err != nil {
+		http.Error(w, "Студент не найден", http.StatusNotFound)
+		return
+	}
+	scope, ok := managedGroups(w, r)
+	if !ok {
+		return
+	}
+	if !scope.Allows(student.Group) {
+		http.Error(w, services.ErrOutsideScope.Error(), http.StatusForbidden)
 		return
 	}
 
-	// Очищаем тему у студента
-	err = db.Model(&models.User{}).
-		Where("id = ?", studentID).
-		Update("topic", "").Error
-
-	if err != nil {
-		http.Error(w, "Ошибка обновления студента", http.StatusInternalServerError)
+	// Освобождаем тему
+	if err := services.ReleaseTopic(topic.ID, student.ID, auditActor(r)); err != nil {
+		if errors.Is(err, services.ErrNotAssigned) || errors.Is(err, services.ErrTopicInWork) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, "Ошибка освобождения темы", http.StatusInternalServerError)
 		return
 	}
 
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditTopicUnassign,
+		TargetType: "topic",
+		TargetID:   topic.ID,
+		Summary:    fmt.Sprintf("Студент %s (%s) снят с темы «%s»", student.Name, student.Email, topic.Title),
+		Before: map[string]interface{}{
+			"topic_members": memberIDs(topic.Members),
+			"topic_status":  topic.Status,
+			"student_topic": topic.Title,
+		},
+		After: map[string]interface{}{
+			"topic_members": withoutMember(topic.Members, student.ID),
+			"student_topic": "",
+		},
+	})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
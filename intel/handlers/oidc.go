@@ -0,0 +1,99 @@
+// вход через провайдера OpenID Connect (authorization code + PKCE)
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"proj/intel/services"
+	"proj/utils"
+
+	"golang.org/x/oauth2"
+)
+
+// loginOIDC - начало входа: запоминаем state, nonce и verifier и уходим к провайдеру
+func loginOIDC(w http.ResponseWriter, r *http.Request) {
+	client, err := services.GetOIDCClient(r.Context())
+	if err != nil {
+		log.Printf("Вход через провайдера недоступен: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		renderLogin(w, r, loginPageData{Error: "Вход через " + services.OIDCProviderName() + " временно недоступен."})
+		return
+	}
+
+	state := &utils.OIDCState{
+		State:    randomURLToken(),
+		Nonce:    randomURLToken(),
+		Verifier: oauth2.GenerateVerifier(),
+	}
+	if err := utils.SetOIDCCookie(w, state); err != nil {
+		http.Error(w, "Ошибка создания сессии", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, client.AuthCodeURL(state.State, state.Nonce, state.Verifier), http.StatusFound)
+}
+
+// loginOIDCCallback - возврат от провайдера: проверка state, обмен кода, поиск учётной записи
+func loginOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	saved, err := utils.GetOIDCState(r)
+	utils.ClearOIDCCookie(w)
+	if err != nil || r.URL.Query().Get("state") != saved.State {
+		log.Printf("Неверный state при входе через провайдера: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		renderLogin(w, r, loginPageData{Error: "Сеанс входа устарел. Попробуйте ещё раз."})
+		return
+	}
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		log.Printf("Провайдер вернул ошибку: %s %s", e, r.URL.Query().Get("error_description"))
+		w.WriteHeader(http.StatusUnauthorized)
+		renderLogin(w, r, loginPageData{Error: "Вход отменён или отклонён провайдером."})
+		return
+	}
+
+	client, err := services.GetOIDCClient(r.Context())
+	if err != nil {
+		log.Printf("Вход через провайдера недоступен: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		renderLogin(w, r, loginPageData{Error: "Вход через провайдера временно недоступен."})
+		return
+	}
+
+	identity, err := client.Exchange(r.Context(), r.URL.Query().Get("code"), saved.Nonce, saved.Verifier)
+	if err != nil {
+		log.Printf("Ошибка входа через провайдера: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		renderLogin(w, r, loginPageData{Error: "Не удалось войти через провайдера. Попробуйте ещё раз."})
+		return
+	}
+
+	user, err := services.OIDCUser(identity)
+	if err != nil {
+		log.Printf("Вход через провайдера для %s (%s) отклонён: %v", identity.Email, identity.Subject, err)
+		message := "Не удалось войти через провайдера."
+		switch {
+		case errors.Is(err, services.ErrOIDCNoAccount), errors.Is(err, services.ErrDomainNotAllowed),
+			errors.Is(err, services.ErrOIDCEmailUnverified):
+			message = err.Error() + "."
+		case errors.Is(err, services.ErrUserDisabled):
+			message = "Учётная запись отключена. Обратитесь к администратору."
+		}
+		w.WriteHeader(http.StatusForbidden)
+		renderLogin(w, r, loginPageData{Email: identity.Email, Error: message})
+		return
+	}
+
+	log.Printf("Вход через провайдера: %s", user.Email)
+	completeLogin(w, r, user)
+}
+
+func randomURLToken() string {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
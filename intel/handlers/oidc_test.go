@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"proj/intel/services"
+	"proj/utils"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// startDiscoveryOnly - провайдер, у которого есть только discovery; обмен кода считается ошибкой теста
+func startDiscoveryOnly(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var tokenCalls atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			tokenCalls.Add(1)
+			http.Error(w, "unexpected", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                srv.URL,
+			"authorization_endpoint":                srv.URL + "/authorize",
+			"token_endpoint":                        srv.URL + "/token",
+			"jwks_uri":                              srv.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	services.SetOIDCConfig(services.OIDCConfig{
+		Issuer:      srv.URL,
+		ClientID:    "vkr-portal",
+		RedirectURL: "https://vkr.college.test/login/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+		Name:        "единый вход",
+	})
+	t.Cleanup(func() { services.SetOIDCConfig(services.OIDCConfig{}) })
+	loadTemplates("templates")
+	return srv, &tokenCalls
+}
+
+// startOIDCLogin - начало входа: cookie с параметрами и адрес, куда ушёл пользователь
+func startOIDCLogin(t *testing.T) (*http.Cookie, *url.URL) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	loginOIDC(rec, httptest.NewRequest(http.MethodGet, "/login/oidc", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("начало входа: %d %s", rec.Code, rec.Body.String())
+	}
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == utils.OIDCCookieName {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("cookie с параметрами входа не выставлена")
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookie, location
+}
+
+func TestLoginOIDCStartsWithStateAndPKCE(t *testing.T) {
+	srv, _ := startDiscoveryOnly(t)
+	cookie, location := startOIDCLogin(t)
+
+	if !strings.HasPrefix(location.String(), srv.URL+"/authorize?") {
+		t.Fatalf("переход не к провайдеру: %s", location)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/login/oidc/callback", nil)
+	req.AddCookie(cookie)
+	saved, err := utils.GetOIDCState(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := location.Query()
+	if q.Get("state") != saved.State || q.Get("nonce") != saved.Nonce {
+		t.Fatal("state и nonce в адресе не совпадают с сохранёнными в cookie")
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("нет PKCE: %s", location)
+	}
+}
+
+// Возврат с чужим state или без cookie отклоняется до обмена кода
+func TestLoginOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	_, tokenCalls := startDiscoveryOnly(t)
+	cookie, _ := startOIDCLogin(t)
+
+	cases := map[string]*http.Cookie{
+		"чужой state": cookie,
+		"без cookie":  nil,
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?code=stolen&state=forged", nil)
+			if c != nil {
+				req.AddCookie(c)
+			}
+			rec := httptest.NewRecorder()
+			loginOIDCCallback(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("ответ %d, ожидался 400", rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), "Сеанс входа устарел") {
+				t.Fatalf("нет сообщения об устаревшем входе:\n%s", rec.Body.String())
+			}
+			cleared := false
+			for _, rc := range rec.Result().Cookies() {
+				if rc.Name == utils.OIDCCookieName && rc.Value == "" {
+					cleared = true
+				}
+			}
+			if !cleared {
+				t.Fatal("cookie с параметрами входа не удалена")
+			}
+		})
+	}
+	if n := tokenCalls.Load(); n != 0 {
+		t.Fatalf("при неверном state сервер обращался к провайдеру: %d", n)
+	}
+}
+
+func TestLoginOIDCCallbackProviderError(t *testing.T) {
+	_, tokenCalls := startDiscoveryOnly(t)
+	cookie, location := startOIDCLogin(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?error=access_denied&state="+
+		url.QueryEscape(location.Query().Get("state")), nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	loginOIDCCallback(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("ответ %d, ожидался 401", rec.Code)
+	}
+	if n := tokenCalls.Load(); n != 0 {
+		t.Fatalf("после отказа провайдера был обмен кода: %d", n)
+	}
+}
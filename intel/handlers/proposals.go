@@ -0,0 +1,123 @@
+// предложения тем от студентов и их рассмотрение руководителями
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"proj/intel/models"
+	"proj/intel/services"
+	"proj/utils"
+	"strconv"
+)
+
+// StudentProposeTopic - студент предлагает свою тему и желаемого руководителя
+func StudentProposeTopic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	var student models.User
+	if err := services.GetDB().First(&student, claims.UserID).Error; err != nil {
+		http.Error(w, "Студент не найден", http.StatusNotFound)
+		return
+	}
+	supervisorID, _ := strconv.ParseUint(r.FormValue("supervisor_id"), 10, 32)
+
+	topic, err := services.ProposeTopic(student, services.TopicProposal{
+		Title:        r.FormValue("title"),
+		Subject:      r.FormValue("subject"),
+		WorkType:     r.FormValue("work_type"),
+		SupervisorID: uint(supervisorID),
+	}, auditActor(r))
+	switch {
+	case errors.Is(err, services.ErrProposalTitle), errors.Is(err, services.ErrProposalWorkType),
+		errors.Is(err, services.ErrProposalSupervisor), errors.Is(err, services.ErrProposalPending),
+		errors.Is(err, services.ErrProposalHasTopic), errors.Is(err, services.ErrNoActiveTerm):
+		http.Redirect(w, r, "/student?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Printf("Ошибка сохранения предложения темы: %v", err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+		return
+	}
+
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditTopicPropose,
+		TargetType: "topic",
+		TargetID:   topic.ID,
+		Summary: fmt.Sprintf("Студент %s (%s) предложил тему «%s», руководитель %s",
+			student.Name, student.Email, topic.Title, topic.SupervisorLabel()),
+		After: map[string]interface{}{"title": topic.Title, "supervisor_id": topic.SupervisorID, "status": topic.Status},
+	})
+
+	http.Redirect(w, r, "/student", http.StatusSeeOther)
+}
+
+// SupervisorProposal - руководитель или председатель ПЦК утверждает предложение студента
+// (возможно, поправив его) или отклоняет с указанием причины
+func SupervisorProposal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	supervisor, ok := currentSupervisor(w, r)
+	if !ok {
+		return
+	}
+	topicID, err := strconv.ParseUint(r.FormValue("topic_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid topic ID", http.StatusBadRequest)
+		return
+	}
+
+	var rec services.AuditRecord
+	switch r.FormValue("action") {
+	case "approve":
+		var before, topic models.Topic
+		before, topic, err = services.ApproveProposal(*supervisor, uint(topicID), services.TopicProposal{
+			Title:    r.FormValue("title"),
+			Subject:  r.FormValue("subject"),
+			WorkType: r.FormValue("work_type"),
+		}, auditActor(r))
+		if err == nil {
+			rec = services.AuditRecord{
+				TargetID: topic.ID,
+				Summary: fmt.Sprintf("%s утвердил тему «%s», предложенную студентом %s (%s)",
+					supervisor.Name, topic.Title, before.ProposedBy.Name, before.ProposedBy.Email),
+				Before: map[string]interface{}{"title": before.Title, "subject": before.Subject, "work_type": before.WorkType, "status": before.Status},
+				After:  map[string]interface{}{"title": topic.Title, "subject": topic.Subject, "work_type": topic.WorkType, "status": topic.Status},
+			}
+		}
+	case "reject":
+		var topic models.Topic
+		topic, err = services.RejectProposal(*supervisor, uint(topicID), r.FormValue("reason"), auditActor(r))
+		if err == nil {
+			rec = services.AuditRecord{
+				TargetID: topic.ID,
+				Summary: fmt.Sprintf("%s отклонил тему «%s», предложенную студентом %s (%s)",
+					supervisor.Name, topic.Title, topic.ProposedBy.Name, topic.ProposedBy.Email),
+				Before: map[string]interface{}{"status": models.TopicProposed},
+				After:  map[string]interface{}{"status": topic.Status, "reason": r.FormValue("reason")},
+			}
+		}
+	default:
+		http.Error(w, "Неизвестное действие", http.StatusBadRequest)
+		return
+	}
+	if !supervisorActionDone(w, r, err) {
+		return
+	}
+	rec.Action = services.AuditTopicReview
+	rec.TargetType = "topic"
+	services.Audit(auditActor(r), rec)
+
+	http.Redirect(w, r, "/supervisor", http.StatusSeeOther)
+}
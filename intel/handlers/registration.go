@@ -0,0 +1,209 @@
+// контроль регистрации: коды приглашения, разрешённые домены, очередь одобрения
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"proj/intel/models"
+	"proj/intel/services"
+	"proj/utils"
+	"strconv"
+	"time"
+)
+
+// PendingPage - куда попадает пользователь, пока регистрацию не одобрили
+func PendingPage(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	var user models.User
+	if err := services.GetDB().First(&user, claims.UserID).Error; err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+	if !user.Pending {
+		http.Redirect(w, r, "/dashboard/", http.StatusFound)
+		return
+	}
+	renderPending(w, r, user, r.URL.Query().Get("error"))
+}
+
+// renderPending - страница ожидания; студенту без группы показывается выбор группы
+func renderPending(w http.ResponseWriter, r *http.Request, user models.User, errMsg string) {
+	data := map[string]interface{}{
+		"User":  user,
+		"Error": errMsg,
+	}
+	if user.Role == "student" && user.Group == "" {
+		groups, err := services.ListGroups()
+		if err != nil {
+			log.Printf("Ошибка загрузки справочника групп: %v", err)
+		}
+		data["Groups"] = groups
+	}
+	render(w, r, "pending.html", data)
+}
+
+// PendingGroup - студент, созданный через провайдера входа, выбирает свою группу
+func PendingGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	switch err := services.ChooseGroup(&user, r.FormValue("group")); {
+	case errors.Is(err, services.ErrGroupUnknown), errors.Is(err, services.ErrGroupChosen):
+		http.Redirect(w, r, "/pending?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Printf("Ошибка сохранения группы %s: %v", user.Email, err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Студент %s выбрал группу %s", user.Email, user.Group)
+	http.Redirect(w, r, "/pending", http.StatusSeeOther)
+}
+
+// AdminRegistrationSettings - правила регистрации и коды приглашения
+func AdminRegistrationSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		settings := services.GetRegistrationSettings()
+		settings.RequireCode = r.FormValue("require_code") == "on"
+		settings.RequireApproval = r.FormValue("require_approval") == "on"
+		settings.AllowedDomains = r.FormValue("allowed_domains")
+		if err := services.SaveRegistrationSettings(settings); err != nil {
+			log.Printf("Ошибка сохранения правил регистрации: %v", err)
+			http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Правила регистрации обновлены: код=%v, одобрение=%v, домены=%q",
+			settings.RequireCode, settings.RequireApproval, settings.AllowedDomains)
+		http.Redirect(w, r, "/admin/registration", http.StatusSeeOther)
+		return
+	}
+
+	codes, err := services.ListEnrollmentCodes()
+	if err != nil {
+		log.Printf("Ошибка загрузки кодов приглашения: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, "registrationSettings.html", map[string]interface{}{
+		"Settings": services.GetRegistrationSettings(),
+		"Codes":    codes,
+		"Now":      time.Now(),
+	})
+}
+
+// AdminCreateEnrollmentCode - новый код приглашения в группу
+func AdminCreateEnrollmentCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	maxUses, _ := strconv.Atoi(r.FormValue("max_uses"))
+	days, _ := strconv.Atoi(r.FormValue("days"))
+	ttl := time.Duration(days) * 24 * time.Hour
+
+	code, err := services.CreateEnrollmentCode(r.FormValue("group"), maxUses, ttl, claims.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Выпущен код приглашения %s для группы %s", code.Code, code.Group)
+	http.Redirect(w, r, "/admin/registration", http.StatusSeeOther)
+}
+
+// AdminRevokeEnrollmentCode - отзыв кода приглашения
+func AdminRevokeEnrollmentCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseUint(r.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Неверный ID кода", http.StatusBadRequest)
+		return
+	}
+	if err := services.RevokeEnrollmentCode(uint(id)); err != nil {
+		log.Printf("Ошибка отзыва кода приглашения: %v", err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/registration", http.StatusSeeOther)
+}
+
+// PendingRegistrations - очередь учётных записей на одобрение
+func PendingRegistrations(w http.ResponseWriter, r *http.Request) {
+	reviewer, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	users, err := services.ListPendingUsers(reviewer)
+	if err != nil {
+		log.Printf("Ошибка загрузки очереди регистрации: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, "registrations.html", map[string]interface{}{
+		"Users": users,
+	})
+}
+
+// ReviewRegistration - одобрение или отклонение заявки
+func ReviewRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseUint(r.FormValue("user_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Неверный ID пользователя", http.StatusBadRequest)
+		return
+	}
+	reviewer, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var user *models.User
+	switch r.FormValue("action") {
+	case "approve":
+		user, err = services.ApproveUser(reviewer, uint(id))
+	case "reject":
+		user, err = services.RejectUser(reviewer, uint(id))
+	default:
+		http.Error(w, "Недопустимое действие", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, services.ErrOutsideScope) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, services.ErrNotPending) || errors.Is(err, services.ErrGroupMissing) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка обработки заявки %d: %v", id, err)
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Заявка %s: %s", user.Email, r.FormValue("action"))
+	http.Redirect(w, r, "/registrations", http.StatusSeeOther)
+}
@@ -0,0 +1,172 @@
+// управление сессиями: список активных сессий, отзыв, "выйти везде"
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"proj/intel/models"
+	"proj/intel/services"
+	"proj/utils"
+	"strconv"
+)
+
+type sessionsPageData struct {
+	Owner     models.User
+	Sessions  []models.Session
+	CurrentID string
+	AdminView bool
+}
+
+// MySessions - список активных сессий текущего пользователя
+func MySessions(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	var user models.User
+	if err := services.GetDB().First(&user, claims.UserID).Error; err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+
+	sessions, err := services.ListActiveSessions(user.ID)
+	if err != nil {
+		log.Printf("Ошибка получения сессий: %v", err)
+		http.Error(w, "Ошибка загрузки сессий", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, "sessions.html", sessionsPageData{
+		Owner:     user,
+		Sessions:  sessions,
+		CurrentID: claims.SessionID(),
+	})
+}
+
+// RevokeMySession - завершает одну из своих сессий
+func RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	session, err := services.GetActiveSession(r.FormValue("session_id"))
+	if err != nil || session.UserID != claims.UserID {
+		http.Error(w, "Сессия не найдена", http.StatusNotFound)
+		return
+	}
+	if err := services.RevokeSession(session.ID); err != nil {
+		http.Error(w, "Ошибка завершения сессии", http.StatusInternalServerError)
+		return
+	}
+
+	if session.ID == claims.SessionID() {
+		utils.ClearJWTCookie(w)
+		http.Redirect(w, r, "/login/", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/sessions", http.StatusSeeOther)
+}
+
+// LogoutEverywhere - завершает все сессии текущего пользователя
+func LogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	if err := services.RevokeUserSessions(claims.UserID); err != nil {
+		http.Error(w, "Ошибка завершения сессий", http.StatusInternalServerError)
+		return
+	}
+	utils.ClearJWTCookie(w)
+	http.Redirect(w, r, "/login/", http.StatusSeeOther)
+}
+
+// AdminUserSessions - сессии выбранного пользователя (для администратора)
+func AdminUserSessions(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	db := services.GetDB()
+	var user models.User
+	if email := r.FormValue("email"); email != "" {
+		err = db.Where("email = ?", email).First(&user).Error
+	} else {
+		err = db.First(&user, r.FormValue("user_id")).Error
+	}
+	if err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+
+	sessions, err := services.ListActiveSessions(user.ID)
+	if err != nil {
+		log.Printf("Ошибка получения сессий: %v", err)
+		http.Error(w, "Ошибка загрузки сессий", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, "sessions.html", sessionsPageData{
+		Owner:     user,
+		Sessions:  sessions,
+		CurrentID: claims.SessionID(),
+		AdminView: true,
+	})
+}
+
+// AdminRevokeSession - отзывает одну сессию любого пользователя
+func AdminRevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.FormValue("session_id")
+	userID, err := strconv.ParseUint(r.FormValue("user_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if err := services.RevokeSession(sessionID); err != nil {
+		http.Error(w, "Ошибка отзыва сессии", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Администратор отозвал сессию %s пользователя %d", sessionID, userID)
+	http.Redirect(w, r, "/admin/sessions?user_id="+strconv.FormatUint(userID, 10), http.StatusSeeOther)
+}
+
+// AdminRevokeUserSessions - отзывает все сессии пользователя
+func AdminRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.ParseUint(r.FormValue("user_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if err := services.RevokeUserSessions(uint(userID)); err != nil {
+		http.Error(w, "Ошибка отзыва сессий", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Администратор отозвал все сессии пользователя %d", userID)
+	http.Redirect(w, r, "/admin/sessions?user_id="+strconv.FormatUint(userID, 10), http.StatusSeeOther)
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Значение user_id из формы не попадает в адрес перенаправления как есть
+func TestAdminRevokeSessionRejectsBadUserID(t *testing.T) {
+	for _, userID := range []string{"", "1&user_id=2", "//evil.example"} {
+		form := url.Values{"session_id": {"abc"}, "user_id": {userID}}
+		req := httptest.NewRequest(http.MethodPost, "/admin/sessions/revoke", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		AdminRevokeSession(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("user_id=%q: ответ %d, ожидался 400", userID, rec.Code)
+		}
+		if loc := rec.Header().Get("Location"); loc != "" {
+			t.Errorf("user_id=%q: перенаправление на %s", userID, loc)
+		}
+	}
+}
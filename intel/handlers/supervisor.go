@@ -0,0 +1,214 @@
+// кабинет руководителя: свои темы, студенты, свободные места
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"proj/intel/models"
+	"proj/intel/services"
+	"proj/utils"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// currentSupervisor - запись справочника для вошедшего руководителя.
+// При ошибке ответ уже отправлен
+func currentSupervisor(w http.ResponseWriter, r *http.Request) (*models.Supervisor, bool) {
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return nil, false
+	}
+	var user models.User
+	if err := services.GetDB().First(&user, claims.UserID).Error; err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return nil, false
+	}
+
+	supervisor, err := services.SupervisorForUser(user)
+	if errors.Is(err, services.ErrNoSupervisorProfile) {
+		w.WriteHeader(http.StatusForbidden)
+		render(w, r, "notice.html", accountPageData{
+			Title: "Кабинет руководителя",
+			Error: "Учётная запись " + user.Email + " не найдена в справочнике руководителей. Обратитесь к администратору.",
+		})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Ошибка поиска руководителя: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return nil, false
+	}
+	return supervisor, true
+}
+
+// SupervisorDashboard - темы руководителя, назначенные студенты и свободные места
+func SupervisorDashboard(w http.ResponseWriter, r *http.Request) {
+	supervisor, ok := currentSupervisor(w, r)
+	if !ok {
+		return
+	}
+
+	workload, err := services.GetSupervisorWorkload(*supervisor)
+	if err != nil {
+		log.Printf("Ошибка получения тем руководителя: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+
+	proposals, err := services.ProposalsForReview(*supervisor)
+	if err != nil {
+		log.Printf("Ошибка получения предложений тем: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, "supervisor.html", map[string]interface{}{
+		"Workload":  workload,
+		"Proposals": proposals,
+		"Error":     r.URL.Query().Get("error"),
+	})
+}
+
+// SupervisorDecide - руководитель принимает студента или отказывает ему
+func SupervisorDecide(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	supervisor, ok := currentSupervisor(w, r)
+	if !ok {
+		return
+	}
+	topicID, err := strconv.ParseUint(r.FormValue("topic_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid topic ID", http.StatusBadRequest)
+		return
+	}
+	studentID, err := strconv.ParseUint(r.FormValue("student_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid student ID", http.StatusBadRequest)
+		return
+	}
+
+	var member models.TopicMember
+	action := r.FormValue("action")
+	switch action {
+	case "accept":
+		member, err = services.AcceptStudent(*supervisor, uint(topicID), uint(studentID))
+	case "decline":
+		member, err = services.DeclineStudent(*supervisor, uint(topicID), uint(studentID), auditActor(r))
+	default:
+		http.Error(w, "Неизвестное действие", http.StatusBadRequest)
+		return
+	}
+	if !supervisorActionDone(w, r, err) {
+		return
+	}
+
+	topic, student := member.Topic, member.Student
+	rec := services.AuditRecord{
+		Action:     services.AuditTopicAccept,
+		TargetType: "topic",
+		TargetID:   topic.ID,
+		Summary:    fmt.Sprintf("Руководитель %s принял студента %s (%s) на тему «%s»", supervisor.Name, student.Name, student.Email, topic.Title),
+		After:      map[string]interface{}{"student_id": student.ID, "accepted_at": member.AcceptedAt},
+	}
+	if action == "decline" {
+		rec.Action = services.AuditTopicDecline
+		rec.Summary = fmt.Sprintf("Руководитель %s отказал студенту %s (%s), место на теме «%s» освобождено", supervisor.Name, student.Name, student.Email, topic.Title)
+		rec.Before = map[string]interface{}{"student_id": student.ID, "accepted_at": member.AcceptedAt, "topic_status": topic.Status}
+		rec.After = map[string]interface{}{"student_id": nil}
+	}
+	services.Audit(auditActor(r), rec)
+
+	http.Redirect(w, r, "/supervisor", http.StatusSeeOther)
+}
+
+// SupervisorTopicDescription - руководитель меняет описание своей темы
+func SupervisorTopicDescription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	supervisor, ok := currentSupervisor(w, r)
+	if !ok {
+		return
+	}
+	topicID, err := strconv.ParseUint(r.FormValue("topic_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid topic ID", http.StatusBadRequest)
+		return
+	}
+
+	description := r.FormValue("description")
+	topic, err := services.UpdateTopicDescription(*supervisor, uint(topicID), description)
+	if !supervisorActionDone(w, r, err) {
+		return
+	}
+
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditTopicEdit,
+		TargetType: "topic",
+		TargetID:   topic.ID,
+		Summary:    fmt.Sprintf("Руководитель %s изменил описание темы «%s»", supervisor.Name, topic.Title),
+		Before:     map[string]interface{}{"description": topic.Description},
+		After:      map[string]interface{}{"description": description},
+	})
+
+	http.Redirect(w, r, "/supervisor", http.StatusSeeOther)
+}
+
+// SupervisorTopicState - руководитель отмечает ход работы по своей теме
+func SupervisorTopicState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	supervisor, ok := currentSupervisor(w, r)
+	if !ok {
+		return
+	}
+	topicID, err := strconv.ParseUint(r.FormValue("topic_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid topic ID", http.StatusBadRequest)
+		return
+	}
+
+	topic, from, err := services.SupervisorTopicState(*supervisor, uint(topicID), r.FormValue("state"), auditActor(r), r.FormValue("note"))
+	if !supervisorActionDone(w, r, err) {
+		return
+	}
+	auditTopicState(r, topic, from)
+
+	http.Redirect(w, r, "/supervisor", http.StatusSeeOther)
+}
+
+// supervisorActionDone - разбирает ошибку действия в кабинете; false - ответ уже отправлен
+func supervisorActionDone(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Тема не найдена", http.StatusNotFound)
+	case errors.Is(err, services.ErrNotOwnTopic), errors.Is(err, services.ErrNotReviewer):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrNoStudent), errors.Is(err, services.ErrSupervisorFull),
+		errors.Is(err, services.ErrNotAssigned), errors.Is(err, services.ErrTopicInWork),
+		errors.Is(err, services.ErrTopicMove), errors.Is(err, services.ErrTopicChanged),
+		errors.Is(err, services.ErrNotProposal), errors.Is(err, services.ErrProposalReason),
+		errors.Is(err, services.ErrProposalTitle), errors.Is(err, services.ErrProposalWorkType),
+		errors.Is(err, services.ErrTopicNotOpen), errors.Is(err, services.ErrTopicFull),
+		errors.Is(err, services.ErrTopicNoMembers):
+		// Ошибку показываем на странице кабинета
+		http.Redirect(w, r, "/supervisor?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+	default:
+		log.Printf("Ошибка действия руководителя: %v", err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+	}
+	return false
+}
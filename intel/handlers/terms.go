@@ -0,0 +1,84 @@
+// учебные периоды: список и переход на новый период
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"proj/intel/models"
+	"proj/intel/services"
+	"strconv"
+)
+
+// AdminTerms - учебные периоды с числом тем и назначений
+func AdminTerms(w http.ResponseWriter, r *http.Request) {
+	stats, err := services.ListTermStats()
+	if err != nil {
+		log.Printf("Ошибка загрузки учебных периодов: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+	active, err := services.ActiveTerm()
+	if err != nil {
+		log.Printf("Ошибка получения учебного периода: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, "terms.html", map[string]interface{}{
+		"Terms":  stats,
+		"Active": active,
+		"Next":   active.Next(),
+		"Error":  r.URL.Query().Get("error"),
+		"Notice": r.URL.Query().Get("notice"),
+	})
+}
+
+// AdminTermRollover - завершение периода: он уходит в архив, открывается следующий
+func AdminTermRollover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	year, err := strconv.Atoi(r.FormValue("year"))
+	if err != nil {
+		http.Error(w, "Неверный учебный год", http.StatusBadRequest)
+		return
+	}
+	semester, err := strconv.Atoi(r.FormValue("semester"))
+	if err != nil {
+		http.Error(w, "Неверный семестр", http.StatusBadRequest)
+		return
+	}
+	carry := r.FormValue("carry_free") == "on"
+
+	result, err := services.RolloverTerm(models.Term{Year: year, Semester: semester}, carry, auditActor(r))
+	switch {
+	case errors.Is(err, services.ErrTermInvalid), errors.Is(err, services.ErrTermExists),
+		errors.Is(err, services.ErrTermOrder), errors.Is(err, services.ErrNoActiveTerm):
+		http.Redirect(w, r, "/admin/terms?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Printf("Ошибка перехода на новый учебный период: %v", err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+		return
+	}
+
+	summary := fmt.Sprintf("Период %s завершён, начат %s, тем отправлено в архив: %d", result.Archived.Name(), result.Active.Name(), result.Closed)
+	if carry {
+		summary += fmt.Sprintf(", перенесено свободных тем: %d", result.Carried)
+	}
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditTermRollover,
+		TargetType: "term",
+		TargetID:   result.Active.ID,
+		Summary:    summary,
+		Before:     map[string]interface{}{"term_id": result.Archived.ID, "term": result.Archived.Name()},
+		After:      map[string]interface{}{"term_id": result.Active.ID, "term": result.Active.Name(), "carried": result.Carried, "closed": result.Closed},
+	})
+	log.Print(summary)
+
+	http.Redirect(w, r, "/admin/terms?notice="+url.QueryEscape(summary), http.StatusSeeOther)
+}
@@ -0,0 +1,159 @@
+// заявки студентов на смену темы или уточнение её названия
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"proj/intel/models"
+	"proj/intel/services"
+	"proj/utils"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// currentUser - вошедший пользователь из БД; false - ответ уже отправлен
+func currentUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	var user models.User
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return user, false
+	}
+	if err := services.GetDB().First(&user, claims.UserID).Error; err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return user, false
+	}
+	return user, true
+}
+
+// UpdateTopic - студент просит другую тему или уточнение названия своей темы
+func UpdateTopic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	student, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	newTopicID, _ := strconv.ParseUint(r.FormValue("new_topic_id"), 10, 32)
+
+	req, err := services.CreateTopicRequest(student, services.TopicRequestInput{
+		Kind:       r.FormValue("kind"),
+		NewTopicID: uint(newTopicID),
+		NewTitle:   r.FormValue("new_title"),
+		Reason:     r.FormValue("reason"),
+	})
+	switch {
+	case errors.Is(err, services.ErrRequestKind), errors.Is(err, services.ErrRequestReason),
+		errors.Is(err, services.ErrRequestNoTopic), errors.Is(err, services.ErrRequestNewTopic),
+		errors.Is(err, services.ErrRequestTitle), errors.Is(err, services.ErrRequestPending):
+		http.Redirect(w, r, "/student?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Printf("Ошибка сохранения заявки на смену темы: %v", err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+		return
+	}
+
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditTopicRequest,
+		TargetType: "topic_request",
+		TargetID:   req.ID,
+		Summary:    fmt.Sprintf("Студент %s (%s) подал заявку: %s", student.Name, student.Email, req.KindLabel()),
+		After: map[string]interface{}{"topic_id": req.TopicID, "new_topic_id": req.NewTopicID,
+			"new_title": req.NewTitle, "reason": req.Reason},
+	})
+
+	http.Redirect(w, r, "/student", http.StatusSeeOther)
+}
+
+// TopicRequests - заявки на смену темы, которые может рассмотреть пользователь
+func TopicRequests(w http.ResponseWriter, r *http.Request) {
+	reviewer, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	list, err := services.ReviewTopicRequests(reviewer)
+	if err != nil {
+		log.Printf("Ошибка загрузки заявок на смену темы: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, "topicRequests.html", map[string]interface{}{
+		"Requests": list,
+		"Error":    r.URL.Query().Get("error"),
+	})
+}
+
+// TopicRequestReview - одобрение или отклонение заявки
+func TopicRequestReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reviewer, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(r.FormValue("request_id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid request ID", http.StatusBadRequest)
+		return
+	}
+	approve := r.FormValue("action") == "approve"
+	if !approve && r.FormValue("action") != "reject" {
+		http.Error(w, "Неизвестное действие", http.StatusBadRequest)
+		return
+	}
+
+	req, err := services.ReviewTopicRequest(reviewer, uint(id), approve, r.FormValue("note"), auditActor(r))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Заявка не найдена", http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrNotRequestOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, services.ErrProposalReason), errors.Is(err, services.ErrRequestReviewed),
+		errors.Is(err, services.ErrRequestStale), errors.Is(err, services.ErrRequestNewTopic),
+		errors.Is(err, services.ErrTopicFull), errors.Is(err, services.ErrTopicNotOpen),
+		errors.Is(err, services.ErrTopicInWork), errors.Is(err, services.ErrTopicArchived):
+		http.Redirect(w, r, "/topic-requests?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Printf("Ошибка рассмотрения заявки %d: %v", id, err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+		return
+	}
+
+	rec := services.AuditRecord{
+		Action:     services.AuditRequestReview,
+		TargetType: "topic_request",
+		TargetID:   req.ID,
+		Summary: fmt.Sprintf("%s: заявка студента %s (%s) отклонена, тема «%s» остаётся",
+			req.KindLabel(), req.Student.Name, req.Student.Email, req.Topic.Title),
+		Before: map[string]interface{}{"status": models.RequestPending},
+		After:  map[string]interface{}{"status": req.Status, "note": req.ReviewNote},
+	}
+	switch {
+	case !approve:
+	case req.Kind == models.RequestChange:
+		rec.Summary = fmt.Sprintf("Смена темы одобрена: студент %s (%s) освободил тему «%s» и получил «%s»",
+			req.Student.Name, req.Student.Email, req.Topic.Title, req.NewTopic.Title)
+		rec.Before = map[string]interface{}{"status": models.RequestPending, "topic_id": req.TopicID}
+		rec.After = map[string]interface{}{"status": req.Status, "topic_id": req.NewTopicID, "note": req.ReviewNote}
+	default:
+		rec.Summary = fmt.Sprintf("Уточнение названия одобрено: «%s» → «%s» (студент %s)",
+			req.Topic.Title, req.NewTitle, req.Student.Name)
+		rec.Before = map[string]interface{}{"status": models.RequestPending, "title": req.Topic.Title}
+		rec.After = map[string]interface{}{"status": req.Status, "title": req.NewTitle, "note": req.ReviewNote}
+	}
+	services.Audit(auditActor(r), rec)
+
+	http.Redirect(w, r, "/topic-requests", http.StatusSeeOther)
+}
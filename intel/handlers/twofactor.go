@@ -0,0 +1,249 @@
+// двухфакторная аутентификация: второй шаг входа, подключение TOTP, политика по ролям
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"image/png"
+	"log"
+	"net/http"
+	"proj/intel/models"
+	"proj/intel/services"
+	"proj/utils"
+
+	"github.com/pquerna/otp"
+)
+
+type twoFactorPageData struct {
+	Error           string
+	LoginFlow       bool // подключение во время входа (2FA обязательна для роли)
+	Enabled         bool
+	Required        bool
+	QRCode          template.URL
+	ProvisioningURI string
+	Secret          string
+	RecoveryCodes   []string
+	RemainingCodes  int64
+}
+
+// mfaPendingUser - пользователь, прошедший проверку пароля, но не 2FA
+func mfaPendingUser(r *http.Request) (*models.User, error) {
+	userID, err := utils.GetMFAUserID(r)
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := services.GetDB().First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// loginSecondFactor - второй шаг входа: ввод TOTP-кода или кода восстановления
+func loginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	user, err := mfaPendingUser(r)
+	if err != nil {
+		utils.ClearMFACookie(w)
+		http.Redirect(w, r, "/login/", http.StatusFound)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		ip := utils.ClientIP(r)
+
+		// Подбор кода ограничивается так же, как подбор пароля
+		if err := services.CheckLoginAllowed(user.Email, ip); err != nil {
+			var throttled *services.ThrottleError
+			if errors.As(err, &throttled) {
+				w.WriteHeader(http.StatusTooManyRequests)
+				render(w, r, "twoFactor.html", twoFactorPageData{
+					Error: fmt.Sprintf("Слишком много неудачных попыток. Повторите через %s", formatWait(throttled.RetryAfter)),
+				})
+				return
+			}
+			log.Printf("Ошибка проверки ограничений входа: %v", err)
+		}
+
+		if err := services.VerifySecondFactor(user.ID, r.FormValue("code")); err != nil {
+			log.Printf("Неверный код 2FA для %s: %v", user.Email, err)
+			if err := services.RecordLoginFailure(user.Email, ip, r.UserAgent(), "неверный код 2FA"); err != nil {
+				log.Printf("Ошибка записи попытки входа: %v", err)
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			render(w, r, "twoFactor.html", twoFactorPageData{Error: "Неверный код. Попробуйте ещё раз."})
+			return
+		}
+
+		if err := finishLogin(w, r, user); err != nil {
+			http.Error(w, "Ошибка создания сессии", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/dashboard", http.StatusFound)
+		return
+	}
+
+	render(w, r, "twoFactor.html", twoFactorPageData{})
+}
+
+// loginTwoFactorSetup - обязательное подключение 2FA во время входа
+func loginTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	user, err := mfaPendingUser(r)
+	if err != nil {
+		utils.ClearMFACookie(w)
+		http.Redirect(w, r, "/login/", http.StatusFound)
+		return
+	}
+	if services.TwoFactorEnabled(user.ID) {
+		http.Redirect(w, r, "/login/2fa", http.StatusFound)
+		return
+	}
+	handleTwoFactorSetup(w, r, user, true)
+}
+
+// TwoFactorSettings - подключение и отключение 2FA из личного кабинета
+func TwoFactorSettings(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	var user models.User
+	if err := services.GetDB().First(&user, claims.UserID).Error; err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+	handleTwoFactorSetup(w, r, &user, false)
+}
+
+func handleTwoFactorSetup(w http.ResponseWriter, r *http.Request, user *models.User, loginFlow bool) {
+	if !services.RoleSupportsTwoFactor(user.Role) {
+		http.Error(w, services.ErrTwoFactorNotAllowed.Error(), http.StatusForbidden)
+		return
+	}
+
+	data := twoFactorPageData{
+		LoginFlow: loginFlow,
+		Enabled:   services.TwoFactorEnabled(user.ID),
+		Required:  services.TwoFactorRequired(user.Role),
+	}
+
+	if r.Method == http.MethodPost {
+		switch r.FormValue("action") {
+		case "confirm":
+			codes, err := services.ConfirmTOTPEnrollment(user.ID, r.FormValue("code"))
+			if err != nil {
+				data.Error = err.Error()
+				break
+			}
+			log.Printf("2FA подключена для %s", user.Email)
+
+			if loginFlow {
+				if err := finishLogin(w, r, user); err != nil {
+					http.Error(w, "Ошибка создания сессии", http.StatusInternalServerError)
+					return
+				}
+			}
+			// Коды показываем один раз - в БД хранятся только хэши
+			render(w, r, "twoFactorSetup.html", twoFactorPageData{
+				LoginFlow:     loginFlow,
+				Enabled:       true,
+				RecoveryCodes: codes,
+			})
+			return
+
+		case "disable":
+			if loginFlow || !data.Enabled {
+				http.Error(w, "Недопустимое действие", http.StatusBadRequest)
+				return
+			}
+			if err := services.VerifySecondFactor(user.ID, r.FormValue("code")); err != nil {
+				data.Error = "Неверный код"
+				break
+			}
+			if err := services.DisableTwoFactor(user); err != nil {
+				data.Error = err.Error()
+				break
+			}
+			log.Printf("2FA отключена для %s", user.Email)
+			http.Redirect(w, r, "/2fa", http.StatusSeeOther)
+			return
+
+		case "restart":
+			// Новый секрет, если старый QR потерян до подтверждения
+			if data.Enabled {
+				http.Error(w, "Недопустимое действие", http.StatusBadRequest)
+				return
+			}
+			if _, err := services.BeginTOTPEnrollment(user); err != nil {
+				data.Error = err.Error()
+			}
+		}
+	}
+
+	if data.Enabled {
+		data.RemainingCodes = services.RemainingRecoveryCodes(user.ID)
+		render(w, r, "twoFactorSetup.html", data)
+		return
+	}
+
+	key, err := services.PendingTOTPKey(user)
+	if err != nil {
+		key, err = services.BeginTOTPEnrollment(user)
+	}
+	if err != nil {
+		log.Printf("Ошибка подключения 2FA: %v", err)
+		http.Error(w, "Ошибка подключения 2FA", http.StatusInternalServerError)
+		return
+	}
+
+	qr, err := qrDataURL(key)
+	if err != nil {
+		log.Printf("Ошибка генерации QR: %v", err)
+	}
+	data.QRCode = qr
+	data.ProvisioningURI = key.URL()
+	data.Secret = key.Secret()
+	render(w, r, "twoFactorSetup.html", data)
+}
+
+// qrDataURL - QR-код с otpauth:// URI в виде data: URL для <img>
+func qrDataURL(key *otp.Key) (template.URL, error) {
+	img, err := key.Image(220, 220)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+// AdminTwoFactorPolicy - обязательная 2FA по ролям
+func AdminTwoFactorPolicy(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Ошибка парсинга формы", http.StatusBadRequest)
+			return
+		}
+		for _, role := range services.TwoFactorRoles {
+			required := r.FormValue("required_"+role) == "on"
+			if err := services.SetTwoFactorRequired(role, required); err != nil {
+				log.Printf("Ошибка сохранения политики 2FA: %v", err)
+				http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+				return
+			}
+		}
+		log.Printf("Политика 2FA обновлена: %v", services.TwoFactorPolicies())
+		http.Redirect(w, r, "/admin/2fa-policy", http.StatusSeeOther)
+		return
+	}
+
+	render(w, r, "twoFactorPolicy.html", map[string]interface{}{
+		"Roles":    services.TwoFactorRoles,
+		"Policies": services.TwoFactorPolicies(),
+	})
+}
@@ -0,0 +1,152 @@
+// управление учётными записями: смена роли и отключение
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"proj/intel/models"
+	"proj/intel/services"
+	"proj/utils"
+)
+
+var validRoles = map[string]bool{
+	"admin":      true,
+	"curator":    true,
+	"supervisor": true,
+	"headman":    true,
+	"student":    true,
+}
+
+// AdminSetRole - повышение или понижение пользователя администратором
+func AdminSetRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	role := r.FormValue("role")
+	if !validRoles[role] {
+		http.Error(w, "Неизвестная роль", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := services.GetDB().Where("email = ?", r.FormValue("email")).First(&user).Error; err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+
+	headmanGroup := ""
+	if role == "headman" {
+		headmanGroup = r.FormValue("headman_group")
+		if headmanGroup == "" {
+			headmanGroup = user.Group
+		}
+	}
+
+	before := user
+	if err := services.SetUserRole(&user, role, headmanGroup); err != nil {
+		if errors.Is(err, services.ErrGroupUnknown) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Ошибка смены роли: %v", err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+		return
+	}
+	auditRoleChange(r, before, user)
+
+	log.Printf("Роль пользователя %s изменена на %s", user.Email, role)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// AdminSetDisabled - отключение или включение учётной записи
+func AdminSetDisabled(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := utils.GetUserFromCookie(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	var user models.User
+	if err := services.GetDB().Where("email = ?", r.FormValue("email")).First(&user).Error; err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+
+	disabled := r.FormValue("disabled") == "true"
+	if disabled && user.ID == claims.UserID {
+		http.Error(w, "Нельзя отключить собственную учётную запись", http.StatusBadRequest)
+		return
+	}
+
+	wasDisabled := user.Disabled
+	if err := services.SetUserDisabled(&user, disabled); err != nil {
+		log.Printf("Ошибка отключения пользователя: %v", err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+		return
+	}
+
+	summary := "Учётная запись " + user.Email + " включена"
+	if disabled {
+		summary = "Учётная запись " + user.Email + " отключена"
+	}
+	services.Audit(auditActor(r), services.AuditRecord{
+		Action:     services.AuditUserDisable,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Summary:    summary,
+		Before:     map[string]interface{}{"disabled": wasDisabled},
+		After:      map[string]interface{}{"disabled": disabled},
+	})
+
+	log.Printf("Учётная запись %s: disabled=%v", user.Email, disabled)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// AdminFailedLogins - журнал неудачных попыток входа
+func AdminFailedLogins(w http.ResponseWriter, r *http.Request) {
+	email := r.FormValue("email")
+	ip := r.FormValue("ip")
+
+	attempts, err := services.ListFailedLogins(email, ip, 200)
+	if err != nil {
+		log.Printf("Ошибка получения попыток входа: %v", err)
+		http.Error(w, "Ошибка загрузки данных", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, "failedLogins.html", map[string]interface{}{
+		"Attempts": attempts,
+		"Email":    email,
+		"IP":       ip,
+	})
+}
+
+// AdminUnlockLogin - снимает блокировку входа для учётной записи
+func AdminUnlockLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email := r.FormValue("email")
+	if email == "" {
+		http.Error(w, "Email не указан", http.StatusBadRequest)
+		return
+	}
+	if err := services.ClearLoginFailures(email); err != nil {
+		http.Error(w, "Ошибка разблокировки", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Вход для %s разблокирован администратором", email)
+	http.Redirect(w, r, "/admin/login-attempts?email="+url.QueryEscape(email), http.StatusSeeOther)
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AuditEntry - запись журнала действий: кто, что, над чем, значения до и после
+type AuditEntry struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	ActorID    uint      `gorm:"index" json:"actor_id"`
+	ActorEmail string    `gorm:"size:100;index" json:"actor_email"`
+	ActorRole  string    `gorm:"size:20" json:"actor_role"`
+	OnBehalfOf string    `gorm:"size:100" json:"on_behalf_of,omitempty"` // email пользователя, если действие выполнено в режиме просмотра от его имени
+	Action     string    `gorm:"size:50;index" json:"action"`
+	TargetType string    `gorm:"size:20" json:"target_type"` // user, topic, import
+	TargetID   uint      `gorm:"index" json:"target_id"`
+	Summary    string    `gorm:"size:500" json:"summary"`
+	Before     string    `gorm:"type:text" json:"before"` // JSON
+	After      string    `gorm:"type:text" json:"after"`  // JSON
+	IP         string    `gorm:"size:64" json:"ip"`
+}
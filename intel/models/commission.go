@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Commission - предметно-цикловая комиссия (ПЦК): председатель и руководители-члены
+type Commission struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:100;uniqueIndex" json:"name"`
+	HeadID    *uint     `gorm:"index" json:"head_id"` // председатель - руководитель из справочника
+	CreatedAt time.Time `json:"created_at"`
+
+	Head    *Supervisor  `gorm:"foreignKey:HeadID;constraint:OnDelete:SET NULL" json:"-"`
+	Members []Supervisor `gorm:"foreignKey:CommissionID;constraint:OnDelete:SET NULL" json:"-"`
+}
+
+// IsHead - является ли руководитель председателем комиссии
+func (c Commission) IsHead(supervisorID uint) bool {
+	return c.HeadID != nil && *c.HeadID == supervisorID
+}
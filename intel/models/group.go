@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Groupfromcur - учебная группа из справочника. User.Group, User.HeadmanGroup
+// и Topic.Group хранят её канонический код
+type Groupfromcur struct {
+	gorm.Model
+	Code      string `gorm:"column:group;size:20;uniqueIndex" json:"group"` // канонический код, например ИС-202
+	Specialty string `gorm:"column:name;size:100" json:"specialty"`         // специальность
+	Year      int    `json:"year"`                                          // курс, 0 - не указан
+	CuratorID *uint  `gorm:"index" json:"curatorId"`                        // куратор группы
+
+	Curator *User        `gorm:"foreignKey:CuratorID;constraint:OnDelete:SET NULL" json:"-"`
+	Aliases []GroupAlias `gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE" json:"aliases,omitempty"`
+}
+
+// IsCurator - является ли пользователь куратором группы
+func (g Groupfromcur) IsCurator(userID uint) bool {
+	return g.CuratorID != nil && *g.CuratorID == userID
+}
+
+// GroupAlias - другое написание группы (опечатка, старый код), которое приводится к коду из справочника
+type GroupAlias struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Alias     string    `gorm:"size:50;uniqueIndex" json:"alias"`
+	GroupID   uint      `gorm:"index;not null" json:"groupId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
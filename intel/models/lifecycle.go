@@ -0,0 +1,158 @@
+package models
+
+import "time"
+
+// Состояния темы
+const (
+	TopicDraft      = "draft"       // черновик, видит только автор
+	TopicProposed   = "proposed"    // предложена, ждёт рассмотрения
+	TopicApproved   = "approved"    // утверждена, но ещё не открыта для выбора
+	TopicOpen       = "open"        // открыта для выбора, есть свободные места
+	TopicAssigned   = "assigned"    // все места заняты
+	TopicInProgress = "in_progress" // студенты выполняют работу
+	TopicSubmitted  = "submitted"   // работа сдана
+	TopicDefended   = "defended"    // работа защищена
+	TopicArchived   = "archived"    // тема закрыта или период завершён
+)
+
+// TopicStates - состояния по порядку жизненного цикла
+var TopicStates = []string{
+	TopicDraft, TopicProposed, TopicApproved, TopicOpen, TopicAssigned,
+	TopicInProgress, TopicSubmitted, TopicDefended, TopicArchived,
+}
+
+var topicStateLabels = map[string]string{
+	TopicDraft:      "Черновик",
+	TopicProposed:   "Предложена",
+	TopicApproved:   "Утверждена",
+	TopicOpen:       "Открыта",
+	TopicAssigned:   "Назначена",
+	TopicInProgress: "В работе",
+	TopicSubmitted:  "Сдана",
+	TopicDefended:   "Защищена",
+	TopicArchived:   "В архиве",
+}
+
+// topicMoves - допустимые переходы между состояниями. В архив тему можно отправить
+// из любого состояния: так закрывается и учебный период
+var topicMoves = map[string][]string{
+	TopicDraft:      {TopicProposed, TopicArchived},
+	TopicProposed:   {TopicApproved, TopicDraft, TopicArchived},
+	TopicApproved:   {TopicOpen, TopicArchived},
+	TopicOpen:       {TopicAssigned, TopicInProgress, TopicApproved, TopicArchived}, // в работу - командная тема, набранная не полностью
+	TopicAssigned:   {TopicOpen, TopicInProgress, TopicArchived},
+	TopicInProgress: {TopicSubmitted, TopicArchived},
+	TopicSubmitted:  {TopicDefended, TopicInProgress, TopicArchived},
+	TopicDefended:   {TopicArchived},
+}
+
+// supervisorMoves - переходы, которые руководитель делает на своих темах
+var supervisorMoves = map[string][]string{
+	TopicOpen:       {TopicInProgress},
+	TopicAssigned:   {TopicInProgress},
+	TopicInProgress: {TopicSubmitted},
+	TopicSubmitted:  {TopicDefended, TopicInProgress},
+}
+
+// TopicStateLabel - название состояния для страниц и выгрузок
+func TopicStateLabel(state string) string {
+	if label, ok := topicStateLabels[state]; ok {
+		return label
+	}
+	return state
+}
+
+// IsTopicState - известно ли такое состояние
+func IsTopicState(state string) bool {
+	_, ok := topicStateLabels[state]
+	return ok
+}
+
+// CanMoveTopic - разрешён ли переход из одного состояния в другое
+func CanMoveTopic(from, to string) bool {
+	for _, s := range topicMoves[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// AutoTopicMove - переход между «Открыта» и «Назначена»: он выполняется только
+// при назначении и снятии студентов, вручную его не делают
+func AutoTopicMove(from, to string) bool {
+	return (from == TopicOpen && to == TopicAssigned) || (from == TopicAssigned && to == TopicOpen)
+}
+
+// SupervisorCanMoveTopic - может ли руководитель перевести свою тему в состояние
+func SupervisorCanMoveTopic(from, to string) bool {
+	for _, s := range supervisorMoves[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TopicMove - состояние, в которое можно перевести тему, с названием для кнопки
+type TopicMove struct {
+	To    string
+	Label string
+}
+
+func topicMovesFrom(moves []string, from string) []TopicMove {
+	result := make([]TopicMove, 0, len(moves))
+	for _, to := range moves {
+		if AutoTopicMove(from, to) {
+			continue
+		}
+		result = append(result, TopicMove{To: to, Label: TopicStateLabel(to)})
+	}
+	return result
+}
+
+// StateLabel - название текущего состояния темы
+func (t Topic) StateLabel() string {
+	return TopicStateLabel(t.Status)
+}
+
+// ManualMoves - состояния, в которые тему можно перевести вручную
+func (t Topic) ManualMoves() []TopicMove {
+	return topicMovesFrom(topicMoves[t.Status], t.Status)
+}
+
+// SupervisorMoves - состояния, в которые тему может перевести её руководитель
+func (t Topic) SupervisorMoves() []TopicMove {
+	return topicMovesFrom(supervisorMoves[t.Status], t.Status)
+}
+
+// LastTransition - последняя смена состояния; история должна быть подгружена новыми сверху
+func (t Topic) LastTransition() *TopicTransition {
+	if len(t.Transitions) == 0 {
+		return nil
+	}
+	return &t.Transitions[0]
+}
+
+// TopicTransition - смена состояния темы: кто и когда её сделал
+type TopicTransition struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	TopicID    uint      `json:"topicId" gorm:"index;not null"`
+	From       string    `json:"from" gorm:"column:from_state;size:20"`
+	To         string    `json:"to" gorm:"column:to_state;size:20"`
+	ActorID    uint      `json:"actorId"`    // 0 - система
+	ActorEmail string    `json:"actorEmail"` // "" - система
+	OnBehalfOf string    `json:"onBehalfOf,omitempty"`
+	Note       string    `json:"note,omitempty" gorm:"size:500"`
+	CreatedAt  time.Time `json:"createdAt" gorm:"index"`
+}
+
+// FromLabel - название прежнего состояния
+func (t TopicTransition) FromLabel() string {
+	return TopicStateLabel(t.From)
+}
+
+// ToLabel - название нового состояния
+func (t TopicTransition) ToLabel() string {
+	return TopicStateLabel(t.To)
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// EnrollmentCode - код приглашения для регистрации в конкретную группу
+type EnrollmentCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Code      string     `gorm:"size:32;uniqueIndex" json:"code"`
+	Group     string     `gorm:"size:20;index" json:"group"`
+	MaxUses   int        `json:"max_uses"` // 0 - без ограничения
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Revoked   bool       `gorm:"default:false" json:"revoked"`
+	CreatedBy uint       `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Usable - код ещё можно использовать
+func (c *EnrollmentCode) Usable(now time.Time) bool {
+	if c.Revoked {
+		return false
+	}
+	if c.ExpiresAt != nil && !now.Before(*c.ExpiresAt) {
+		return false
+	}
+	return c.MaxUses == 0 || c.Uses < c.MaxUses
+}
+
+// RegistrationSettings - правила самостоятельной регистрации (одна запись, ID = 1)
+type RegistrationSettings struct {
+	ID              uint   `gorm:"primaryKey" json:"id"`
+	RequireCode     bool   `gorm:"default:false" json:"require_code"`     // без кода приглашения регистрация закрыта
+	AllowedDomains  string `gorm:"size:500" json:"allowed_domains"`       // через запятую; пусто - любой домен
+	RequireApproval bool   `gorm:"default:false" json:"require_approval"` // новые учётные записи ждут одобрения
+	UpdatedAt       time.Time
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// FailedLogin - неудачная попытка входа (для троттлинга и просмотра администратором)
+type FailedLogin struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Email     string    `gorm:"size:100;index" json:"email"`
+	IP        string    `gorm:"size:64;index" json:"ip"`
+	UserAgent string    `gorm:"size:255" json:"user_agent"`
+	Reason    string    `gorm:"size:100" json:"reason"`
+	Cleared   bool      `gorm:"default:false" json:"cleared"` // сброшена успешным входом или администратором
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// TwoFactor - настройки TOTP пользователя
+type TwoFactor struct {
+	UserID     uint       `gorm:"primaryKey" json:"user_id"`
+	Secret     string     `gorm:"size:64" json:"-"`
+	Enabled    bool       `gorm:"default:false" json:"enabled"` // false - начата, но не подтверждена
+	EnabledAt  *time.Time `json:"enabled_at,omitempty"`
+	LastCode   string     `gorm:"size:10" json:"-"` // защита от повторного использования кода
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// RecoveryCode - одноразовый код восстановления (хранится хэш)
+type RecoveryCode struct {
+	ID       uint       `gorm:"primaryKey" json:"id"`
+	UserID   uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash string     `gorm:"size:64" json:"-"`
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+}
+
+// TwoFactorPolicy - обязательна ли 2FA для роли
+type TwoFactorPolicy struct {
+	Role     string `gorm:"primaryKey;size:20" json:"role"`
+	Required bool   `gorm:"default:false" json:"required"`
+}
+
+// EmailToken - выданная ссылка из письма (сброс пароля, подтверждение адреса).
+// Сам токен подписан и в БД не хранится, здесь только его jti для одноразовости
+type EmailToken struct {
+	ID        string     `gorm:"primaryKey;size:32" json:"id"` // jti
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	Purpose   string     `gorm:"size:20;index" json:"purpose"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
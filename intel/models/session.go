@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Session - серверная сессия; ID совпадает с jti в JWT
+type Session struct {
+	ID         string     `gorm:"primaryKey;size:32" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	UserAgent  string     `gorm:"size:255" json:"user_agent"` // Устройство / браузер
+	IP         string     `gorm:"size:64" json:"ip"`
+	CSRFToken  string     `gorm:"size:64" json:"-"` // Токен для POST-форм и fetch
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	// Просмотр от имени пользователя: администратор, его исходная сессия и разрешены ли изменения
+	ImpersonatorID     *uint  `gorm:"index" json:"impersonator_id,omitempty"`
+	ParentSessionID    string `gorm:"size:32" json:"-"`
+	ImpersonationWrite bool   `gorm:"default:false" json:"impersonation_write"`
+}
+
+// Impersonated - сессия открыта администратором от имени пользователя
+func (s *Session) Impersonated() bool {
+	return s.ImpersonatorID != nil
+}
+
+// Active - сессия не отозвана и не истекла
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
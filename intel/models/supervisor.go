@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Supervisor - руководитель курсовых и дипломных работ
+type Supervisor struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Name           string    `gorm:"size:100;index" json:"name"`                   // ФИО полностью
+	Email          string    `gorm:"size:100;index" json:"email"`                  // может быть пустым
+	CommissionName string    `gorm:"column:commission;size:100" json:"commission"` // цикловая комиссия, как указана при импорте
+	CommissionID   *uint     `gorm:"index" json:"commission_id"`                   // ПЦК из справочника
+	MaxStudents    int       `gorm:"default:0" json:"max_students"`                // предельная нагрузка, 0 - без ограничения
+	UserID         *uint     `gorm:"uniqueIndex" json:"user_id"`                   // учётная запись с ролью supervisor, если есть
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Term - учебный период (год и семестр). Темы и назначения относятся к одному периоду,
+// работать можно только с активным, прошедшие хранятся в архиве
+type Term struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Year       int        `gorm:"uniqueIndex:idx_terms_year_semester" json:"year"`     // год начала учебного года: 2026 - это 2026/27
+	Semester   int        `gorm:"uniqueIndex:idx_terms_year_semester" json:"semester"` // 1 - осенний, 2 - весенний
+	Active     bool       `gorm:"index" json:"active"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// Name - период для интерфейса и выгрузок: «2026/27, осенний семестр»
+func (t Term) Name() string {
+	semester := "осенний"
+	if t.Semester == 2 {
+		semester = "весенний"
+	}
+	return fmt.Sprintf("%d/%02d, %s семестр", t.Year, (t.Year+1)%100, semester)
+}
+
+// Next - следующий семестр: после весеннего начинается новый учебный год
+func (t Term) Next() Term {
+	if t.Semester == 1 {
+		return Term{Year: t.Year, Semester: 2}
+	}
+	return Term{Year: t.Year + 1, Semester: 1}
+}
+
+// Before - идёт ли период раньше другого
+func (t Term) Before(other Term) bool {
+	return t.Year < other.Year || (t.Year == other.Year && t.Semester < other.Semester)
+}
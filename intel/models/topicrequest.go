@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// Виды заявок на смену темы
+const (
+	RequestChange = "change" // другая тема из открытых
+	RequestRename = "rename" // уточнение названия текущей темы
+)
+
+// Состояния заявки
+const (
+	RequestPending  = "pending"
+	RequestApproved = "approved"
+	RequestRejected = "rejected"
+)
+
+var requestKindLabels = map[string]string{
+	RequestChange: "Смена темы",
+	RequestRename: "Уточнение названия",
+}
+
+var requestStatusLabels = map[string]string{
+	RequestPending:  "На рассмотрении",
+	RequestApproved: "Одобрена",
+	RequestRejected: "Отклонена",
+}
+
+// TopicChangeRequest - заявка студента на другую тему или на уточнение названия.
+// Рассматривает староста группы, куратор или администратор
+type TopicChangeRequest struct {
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	StudentID  uint   `json:"studentId" gorm:"index;not null"`
+	TermID     uint   `json:"termId" gorm:"index;not null"`
+	TopicID    uint   `json:"topicId" gorm:"index;not null"` // тема студента на момент заявки
+	Kind       string `json:"kind" gorm:"size:20"`
+	NewTopicID *uint  `json:"newTopicId,omitempty"`               // желаемая тема, для смены темы
+	NewTitle   string `json:"newTitle,omitempty" gorm:"size:300"` // новое название, для уточнения
+	Reason     string `json:"reason" gorm:"size:1000"`
+	Status     string `json:"status" gorm:"size:20;index"`
+
+	ReviewerID    *uint      `json:"reviewerId,omitempty"`
+	ReviewerEmail string     `json:"reviewerEmail,omitempty"`
+	ReviewNote    string     `json:"reviewNote,omitempty" gorm:"size:500"`
+	ReviewedAt    *time.Time `json:"reviewedAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+
+	Student  *User  `gorm:"foreignKey:StudentID;constraint:OnDelete:CASCADE" json:"-"`
+	Topic    *Topic `gorm:"foreignKey:TopicID;constraint:OnDelete:CASCADE" json:"-"`
+	NewTopic *Topic `gorm:"foreignKey:NewTopicID;constraint:OnDelete:SET NULL" json:"-"`
+}
+
+// KindLabel - вид заявки для страниц
+func (r TopicChangeRequest) KindLabel() string {
+	return requestKindLabels[r.Kind]
+}
+
+// StatusLabel - состояние заявки для страниц
+func (r TopicChangeRequest) StatusLabel() string {
+	return requestStatusLabels[r.Status]
+}
+
+// Pending - ждёт ли заявка решения
+func (r TopicChangeRequest) Pending() bool {
+	return r.Status == RequestPending
+}
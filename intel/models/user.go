@@ -1,22 +1,84 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type Topic struct {
-	ID          uint   `json:"id" gorm:"primaryKey"`
-	Title       string `json:"title"`       // Название темы
-	Subject     string `json:"subject"`     // Предмет
-	WorkType    string `json:"workType"`    // Вид работы: "course" или "diploma"
-	Commission  string `json:"commission"`  // Цикловая комиссия
-	Supervisor  string `json:"supervisor"`  // Руководитель
-	Description string `json:"description"` // Описание темы (опционально)
-	Status      string `json:"status"`      // Статус: "free" или "assigned"
-	StudentID   uint   `json:"studentId"`   // ID студента, если назначена
-	Group       string `json:"group"`       // Группа, для которой предназначена тема
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	Title          string `json:"title"`                               // Название темы
+	Subject        string `json:"subject"`                             // Предмет
+	WorkType       string `json:"workType"`                            // Вид работы: "course" или "diploma"
+	CommissionName string `json:"commission" gorm:"column:commission"` // Цикловая комиссия, как указана при импорте
+	CommissionID   *uint  `json:"commissionId" gorm:"index"`           // ПЦК из справочника
+	SupervisorName string `json:"supervisor" gorm:"column:supervisor"` // Руководитель, как указан при импорте
+	SupervisorID   *uint  `json:"supervisorId" gorm:"index"`           // Руководитель из справочника, если найден
+	Description    string `json:"description"`                         // Описание темы (опционально)
+	Status         string `json:"status" gorm:"size:20;index"`         // Состояние жизненного цикла, см. lifecycle.go
+	TermID         *uint  `json:"termId" gorm:"index"`                 // учебный период
+	Capacity       int    `json:"capacity" gorm:"default:1"`           // сколько студентов выполняют тему
+	Group          string `json:"group"`                               // Группа, для которой предназначена тема
+	ProposedByID   *uint  `json:"proposedById" gorm:"index"`           // Студент, предложивший тему
+
+	Supervisor  *Supervisor       `gorm:"foreignKey:SupervisorID;constraint:OnDelete:SET NULL" json:"-"`
+	Commission  *Commission       `gorm:"foreignKey:CommissionID;constraint:OnDelete:SET NULL" json:"-"`
+	Term        *Term             `gorm:"foreignKey:TermID;constraint:OnDelete:RESTRICT" json:"-"`
+	ProposedBy  *User             `gorm:"foreignKey:ProposedByID;constraint:OnDelete:SET NULL" json:"-"`
+	Members     []TopicMember     `gorm:"foreignKey:TopicID;constraint:OnDelete:CASCADE" json:"members,omitempty"` // назначенные студенты
+	Transitions []TopicTransition `gorm:"foreignKey:TopicID;constraint:OnDelete:CASCADE" json:"-"`                 // история смены состояний
+}
+
+// TopicMember - студент, назначенный на тему. В одном периоде у студента одна тема
+type TopicMember struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	TopicID    uint       `json:"topicId" gorm:"index;not null"`
+	StudentID  uint       `json:"studentId" gorm:"uniqueIndex:idx_topic_members_term_student;not null"`
+	TermID     uint       `json:"termId" gorm:"uniqueIndex:idx_topic_members_term_student;not null"` // период темы
+	AcceptedAt *time.Time `json:"acceptedAt,omitempty"`                                              // когда руководитель принял студента
+	CreatedAt  time.Time  `json:"createdAt"`
+
+	Topic   *Topic `gorm:"foreignKey:TopicID" json:"-"`
+	Student *User  `gorm:"foreignKey:StudentID" json:"-"`
+}
+
+// Places - сколько ещё студентов можно назначить; считается по подгруженным Members
+func (t Topic) Places() int {
+	return max(t.Capacity-len(t.Members), 0)
+}
+
+// Team - тема для нескольких студентов
+func (t Topic) Team() bool {
+	return t.Capacity > 1
+}
+
+// StudentNames - ФИО назначенных студентов через запятую; нужны подгруженные Members.Student
+func (t Topic) StudentNames() string {
+	names := make([]string, 0, len(t.Members))
+	for _, m := range t.Members {
+		if m.Student != nil {
+			names = append(names, m.Student.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// SupervisorLabel - ФИО руководителя: из справочника, если он подгружен, иначе как в импорте
+func (t Topic) SupervisorLabel() string {
+	if t.Supervisor != nil {
+		return t.Supervisor.Name
+	}
+	return t.SupervisorName
+}
+
+// CommissionLabel - название ПЦК: из справочника, если она подгружена, иначе как в импорте
+func (t Topic) CommissionLabel() string {
+	if t.Commission != nil {
+		return t.Commission.Name
+	}
+	return t.CommissionName
 }
 
 type User struct {
@@ -26,15 +88,22 @@ type User struct {
 	Password     string `gorm:"password" json:"-"`
 	Role         string `gorm:"size:20;default:student" json:"role"` // admin, curator, headman, student
 	Group        string `gorm:"size:20" json:"group"`
-	Topic        string `gorm:"size:100" json:"topic"`
-	HeadmanGroup string `gorm:"size:20" json:"headman_group"` // Группа, за которую отвечает староста
+	HeadmanGroup string `gorm:"size:20" json:"headman_group"`  // Группа, за которую отвечает староста
+	Disabled     bool   `gorm:"default:false" json:"disabled"` // Учётная запись отключена
 
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`                 // nil - адрес не подтверждён
+	Pending         bool       `gorm:"default:false" json:"pending"`                // ждёт одобрения куратора или администратора
+	OIDCSubject     string     `gorm:"column:oidc_subject;size:255;index" json:"-"` // issuer|sub учётной записи у провайдера входа
+
+	Membership *TopicMember `gorm:"foreignKey:StudentID;constraint:OnDelete:CASCADE" json:"membership,omitempty"` // участие в теме; подгружать с services.WithCurrentTopic
 }
 
-type Groupfromcur struct {
-	gorm.Model
-	Name  string `gorm:"size:50" json:"full_name"`
-	Group string `gorm:"size:20" json:"group"`
+// CurrentTopic - тема из подгруженного участия; nil - темы нет
+func (u User) CurrentTopic() *Topic {
+	if u.Membership == nil {
+		return nil
+	}
+	return u.Membership.Topic
 }
 
 type ChatMessage struct {
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"proj/intel/models"
+	"proj/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	resetTokenTTL  = time.Hour
+	verifyTokenTTL = 48 * time.Hour
+	// emailResendInterval - не чаще одного письма одного типа на пользователя
+	emailResendInterval = time.Minute
+	minPasswordLength   = 6
+)
+
+var (
+	ErrPasswordTooShort  = fmt.Errorf("пароль должен быть не короче %d символов", minPasswordLength)
+	ErrEmailTooFrequent  = errors.New("письмо уже отправлено, попробуйте через минуту")
+	ErrEmailAlreadyValid = errors.New("адрес уже подтверждён")
+)
+
+// issueEmailToken - регистрирует jti и возвращает подписанный токен
+func issueEmailToken(user *models.User, purpose string, ttl time.Duration) (string, error) {
+	var recent int64
+	db.Model(&models.EmailToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", user.ID, purpose, time.Now().Add(-emailResendInterval)).
+		Count(&recent)
+	if recent > 0 {
+		return "", ErrEmailTooFrequent
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	record := &models.EmailToken{
+		ID:        id,
+		UserID:    user.ID,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := db.Create(record).Error; err != nil {
+		return "", err
+	}
+	return utils.GenerateActionToken(id, user.ID, user.Email, purpose, ttl)
+}
+
+// consumeEmailToken - проверяет токен и помечает его использованным.
+// Второй вызов с тем же токеном вернёт ошибку
+func consumeEmailToken(tx *gorm.DB, tokenString, purpose string) (*models.User, error) {
+	claims, err := utils.ParseActionToken(tokenString, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	res := tx.Model(&models.EmailToken{}).
+		Where("id = ? AND user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?",
+			claims.Id, claims.UserID, purpose, now).
+		Update("used_at", now)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, utils.ErrActionTokenInvalid
+	}
+
+	var user models.User
+	if err := tx.First(&user, claims.UserID).Error; err != nil {
+		return nil, utils.ErrActionTokenInvalid
+	}
+	// Ссылка выдана на старый адрес - после смены email она не действует
+	if !strings.EqualFold(user.Email, claims.Email) || user.Disabled {
+		return nil, utils.ErrActionTokenInvalid
+	}
+	return &user, nil
+}
+
+// RequestPasswordReset - отправляет ссылку для сброса пароля.
+// Для неизвестного адреса молча ничего не делает, чтобы нельзя было перебирать email.
+// Без APP_BASE_URL письмо не отправляется ни для какого адреса
+func RequestPasswordReset(email string) error {
+	baseURL, err := utils.BaseURL()
+	if err != nil {
+		return err
+	}
+	var user models.User
+	if err := db.Where("email = ?", strings.TrimSpace(email)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Запрошен сброс пароля для неизвестного адреса %s", email)
+			return nil
+		}
+		return err
+	}
+	if user.Disabled {
+		log.Printf("Запрошен сброс пароля для отключённой учётной записи %s", email)
+		return nil
+	}
+
+	token, err := issueEmailToken(&user, utils.PurposeResetPassword, resetTokenTTL)
+	if errors.Is(err, ErrEmailTooFrequent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Здравствуйте, %s!\n\n"+
+		"Для вашей учётной записи запрошен сброс пароля. Чтобы задать новый пароль, перейдите по ссылке:\n\n"+
+		"%s/reset-password?token=%s\n\n"+
+		"Ссылка действует %d мин. и может быть использована один раз.\n"+
+		"Если вы не запрашивали сброс, просто проигнорируйте это письмо.\n",
+		user.Name, baseURL, token, int(resetTokenTTL.Minutes()))
+	return GetMailer().Send(user.Email, "Сброс пароля", body)
+}
+
+// CheckPasswordResetToken - проверка ссылки до показа формы (токен не расходуется)
+func CheckPasswordResetToken(tokenString string) error {
+	claims, err := utils.ParseActionToken(tokenString, utils.PurposeResetPassword)
+	if err != nil {
+		return err
+	}
+	var count int64
+	db.Model(&models.EmailToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", claims.Id, time.Now()).
+		Count(&count)
+	if count == 0 {
+		return utils.ErrActionTokenInvalid
+	}
+	return nil
+}
+
+// ResetPassword - задаёт новый пароль по ссылке из письма и завершает все сессии
+func ResetPassword(tokenString, newPassword string) (*models.User, error) {
+	if len([]rune(newPassword)) < minPasswordLength {
+		return nil, ErrPasswordTooShort
+	}
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *models.User
+	err = db.Transaction(func(tx *gorm.DB) error {
+		u, err := consumeEmailToken(tx, tokenString, utils.PurposeResetPassword)
+		if err != nil {
+			return err
+		}
+		user = u
+
+		updates := map[string]interface{}{"password": hash}
+		// Письмо дошло до владельца - значит, адрес заодно подтверждён
+		if user.EmailVerifiedAt == nil {
+			updates["email_verified_at"] = time.Now()
+		}
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		// Остальные ссылки на сброс после смены пароля не нужны
+		return tx.Model(&models.EmailToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, utils.PurposeResetPassword).
+			Update("used_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := RevokeUserSessions(user.ID); err != nil {
+		log.Printf("Ошибка завершения сессий после сброса пароля: %v", err)
+	}
+	if err := ClearLoginFailures(user.Email); err != nil {
+		log.Printf("Ошибка сброса счётчика попыток: %v", err)
+	}
+	log.Printf("Пароль пользователя %s сброшен по ссылке из письма", user.Email)
+	return user, nil
+}
+
+// SendVerificationEmail - письмо со ссылкой подтверждения адреса
+func SendVerificationEmail(user *models.User) error {
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyValid
+	}
+	baseURL, err := utils.BaseURL()
+	if err != nil {
+		return err
+	}
+	token, err := issueEmailToken(user, utils.PurposeVerifyEmail, verifyTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Здравствуйте, %s!\n\n"+
+		"Подтвердите адрес электронной почты, перейдя по ссылке:\n\n"+
+		"%s/verify-email?token=%s\n\n"+
+		"Ссылка действует %d ч.\n",
+		user.Name, baseURL, token, int(verifyTokenTTL.Hours()))
+	return GetMailer().Send(user.Email, "Подтверждение адреса электронной почты", body)
+}
+
+// VerifyEmail - отмечает адрес подтверждённым по ссылке из письма
+func VerifyEmail(tokenString string) (*models.User, error) {
+	var user *models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		u, err := consumeEmailToken(tx, tokenString, utils.PurposeVerifyEmail)
+		if err != nil {
+			return err
+		}
+		user = u
+		if user.EmailVerifiedAt != nil {
+			return nil
+		}
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		return tx.Model(user).Update("email_verified_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Адрес %s подтверждён", user.Email)
+	return user, nil
+}
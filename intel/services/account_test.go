@@ -0,0 +1,153 @@
+package services
+
+import (
+	"errors"
+	"proj/intel/models"
+	"proj/utils"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var tokenLink = regexp.MustCompile(`(https?://\S+)\?token=([\w.-]+)`)
+
+// mailedLink - ссылка с токеном из единственного письма, принятого сервером
+func mailedLink(t *testing.T, server *fakeSMTP, to string) (string, string) {
+	t.Helper()
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("ожидалось одно письмо, получено %d", len(messages))
+	}
+	if len(messages[0].To) != 1 || messages[0].To[0] != to {
+		t.Fatalf("письмо ушло на %v, а не на %s", messages[0].To, to)
+	}
+	m := tokenLink.FindStringSubmatch(messages[0].Data)
+	if m == nil {
+		t.Fatalf("в письме нет ссылки с токеном:\n%s", messages[0].Data)
+	}
+	return m[1], m[2]
+}
+
+func createTestUser(t *testing.T, email string) *models.User {
+	t.Helper()
+	user := &models.User{Name: "Иванов Иван", Email: email, Password: "-", Role: "student", Group: "ИС-21"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func countEmailTokens(t *testing.T) int64 {
+	t.Helper()
+	var count int64
+	db.Model(&models.EmailToken{}).Count(&count)
+	return count
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	useTestDB(t)
+	server := startFakeSMTP(t)
+	server.Mailer(t)
+	t.Setenv("APP_BASE_URL", "https://vkr.college.test/")
+	user := createTestUser(t, "reset@college.test")
+
+	if err := RequestPasswordReset("reset@college.test"); err != nil {
+		t.Fatalf("ошибка запроса сброса: %v", err)
+	}
+	link, token := mailedLink(t, server, user.Email)
+	if link != "https://vkr.college.test/reset-password" {
+		t.Fatalf("ссылка ведёт на %s", link)
+	}
+
+	if err := CheckPasswordResetToken(token); err != nil {
+		t.Fatalf("действующая ссылка отклонена: %v", err)
+	}
+	if _, err := ResetPassword(token, "новый-пароль"); err != nil {
+		t.Fatalf("ошибка сброса пароля: %v", err)
+	}
+	var saved models.User
+	db.First(&saved, user.ID)
+	if ok, _ := CheckPassword(saved.Password, "новый-пароль"); !ok {
+		t.Fatal("пароль не изменился")
+	}
+	if saved.EmailVerifiedAt == nil {
+		t.Error("адрес не отмечен подтверждённым после сброса по письму")
+	}
+	if _, err := ResetPassword(token, "другой-пароль"); !errors.Is(err, utils.ErrActionTokenInvalid) {
+		t.Fatalf("ссылка сработала повторно: %v", err)
+	}
+}
+
+func TestPasswordResetUnknownEmail(t *testing.T) {
+	useTestDB(t)
+	server := startFakeSMTP(t)
+	server.Mailer(t)
+	t.Setenv("APP_BASE_URL", "https://vkr.college.test")
+
+	if err := RequestPasswordReset("nobody@college.test"); err != nil {
+		t.Fatalf("для неизвестного адреса вернулась ошибка: %v", err)
+	}
+	if n := len(server.Messages()); n != 0 {
+		t.Fatalf("на неизвестный адрес ушло писем: %d", n)
+	}
+}
+
+func TestVerificationFlow(t *testing.T) {
+	useTestDB(t)
+	server := startFakeSMTP(t)
+	server.Mailer(t)
+	t.Setenv("APP_BASE_URL", "https://vkr.college.test")
+	user := createTestUser(t, "verify@college.test")
+
+	if err := SendVerificationEmail(user); err != nil {
+		t.Fatalf("ошибка отправки письма: %v", err)
+	}
+	link, token := mailedLink(t, server, user.Email)
+	if link != "https://vkr.college.test/verify-email" {
+		t.Fatalf("ссылка ведёт на %s", link)
+	}
+
+	verified, err := VerifyEmail(token)
+	if err != nil {
+		t.Fatalf("ошибка подтверждения: %v", err)
+	}
+	if verified.EmailVerifiedAt == nil {
+		t.Fatal("адрес не отмечен подтверждённым")
+	}
+	if err := SendVerificationEmail(verified); !errors.Is(err, ErrEmailAlreadyValid) {
+		t.Fatalf("повторное письмо для подтверждённого адреса: %v", err)
+	}
+}
+
+// Без APP_BASE_URL ссылки не отправляются: адрес из заголовка Host не используется
+func TestEmailLinksRequireBaseURL(t *testing.T) {
+	useTestDB(t)
+	server := startFakeSMTP(t)
+	server.Mailer(t)
+	t.Setenv("APP_BASE_URL", "")
+	user := createTestUser(t, "nobase@college.test")
+
+	if err := RequestPasswordReset(user.Email); !errors.Is(err, utils.ErrNoBaseURL) {
+		t.Fatalf("сброс пароля без APP_BASE_URL: %v", err)
+	}
+	if err := SendVerificationEmail(user); !errors.Is(err, utils.ErrNoBaseURL) {
+		t.Fatalf("подтверждение адреса без APP_BASE_URL: %v", err)
+	}
+	if n := len(server.Messages()); n != 0 {
+		t.Fatalf("отправлено писем: %d", n)
+	}
+	if n := countEmailTokens(t); n != 0 {
+		t.Fatalf("выпущено токенов: %d", n)
+	}
+}
+
+func TestSiteLink(t *testing.T) {
+	t.Setenv("APP_BASE_URL", "")
+	if link := siteLink("Личный кабинет", "/student"); link != "" {
+		t.Fatalf("ссылка без APP_BASE_URL: %q", link)
+	}
+	t.Setenv("APP_BASE_URL", "https://vkr.college.test/")
+	if link := siteLink("Личный кабинет", "/student"); !strings.Contains(link, "Личный кабинет: https://vkr.college.test/student") {
+		t.Fatalf("ссылка %q", link)
+	}
+}
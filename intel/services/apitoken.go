@@ -0,0 +1,104 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"proj/intel/models"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix - по префиксу токен легко найти в коде и логах
+const APITokenPrefix = "pat_"
+
+// apiTokenTouchInterval - как часто обновлять время последнего использования
+const apiTokenTouchInterval = time.Minute
+
+var (
+	ErrAPITokenInvalid = errors.New("API-токен недействителен")
+	ErrAPITokenScopes  = errors.New("не выбрано ни одного права")
+)
+
+func hashAPIToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken - выпускает токен. Возвращает сам токен (показать один раз) и запись о нём
+func CreateAPIToken(userID uint, name string, scopes []string, ttl time.Duration) (string, *models.APIToken, error) {
+	if len(scopes) == 0 {
+		return "", nil, ErrAPITokenScopes
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, errors.New("укажите название токена")
+	}
+
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", nil, err
+	}
+	raw := APITokenPrefix + secret
+
+	token := &models.APIToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    raw[:len(APITokenPrefix)+6],
+		TokenHash: hashAPIToken(raw),
+		Scopes:    strings.Join(scopes, " "),
+	}
+	if ttl > 0 {
+		expires := time.Now().Add(ttl)
+		token.ExpiresAt = &expires
+	}
+	if err := db.Create(token).Error; err != nil {
+		return "", nil, err
+	}
+	return raw, token, nil
+}
+
+// AuthenticateAPIToken - находит действующий токен и отмечает его использование
+func AuthenticateAPIToken(raw, ip string) (*models.APIToken, error) {
+	if !strings.HasPrefix(raw, APITokenPrefix) {
+		return nil, ErrAPITokenInvalid
+	}
+
+	var token models.APIToken
+	if err := db.Where("token_hash = ?", hashAPIToken(raw)).First(&token).Error; err != nil {
+		return nil, ErrAPITokenInvalid
+	}
+	if !token.Active() {
+		return nil, ErrAPITokenInvalid
+	}
+
+	// Не пишем в БД на каждый запрос скрипта
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > apiTokenTouchInterval || token.LastUsedIP != ip {
+		token.LastUsedAt = &now
+		token.LastUsedIP = ip
+		db.Model(&token).Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip})
+	}
+	return &token, nil
+}
+
+// ListAPITokens - токены пользователя, новые сверху
+func ListAPITokens(userID uint) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeAPIToken - отзывает токен пользователя
+func RevokeAPIToken(userID, tokenID uint) error {
+	res := db.Model(&models.APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAPITokenInvalid
+	}
+	return nil
+}
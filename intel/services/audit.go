@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"proj/intel/models"
+	"strings"
+	"time"
+)
+
+// Действия, которые попадают в журнал
+const (
+	AuditTopicAssign   = "topic.assign"
+	AuditTopicUnassign = "topic.unassign"
+	AuditTopicAuto     = "topic.auto_assign"
+	AuditTopicAccept   = "topic.accept"
+	AuditTopicDecline  = "topic.decline"
+	AuditTopicEdit     = "topic.edit"
+	AuditTopicState    = "topic.state"
+	AuditTopicPropose  = "topic.propose"
+	AuditTopicReview   = "topic.review"
+	AuditTopicRequest  = "topic.request"
+	AuditRequestReview = "topic.request_review"
+	AuditUserRole      = "user.role"
+	AuditUserDisable   = "user.disable"
+	AuditImport        = "import"
+	AuditImpersonate   = "user.impersonate"
+	AuditGroupAlias    = "group.alias"
+	AuditGroupMerge    = "group.merge"
+	AuditTermRollover  = "term.rollover"
+)
+
+// AuditActions - для фильтра на странице журнала
+var AuditActions = []string{
+	AuditTopicAssign, AuditTopicUnassign, AuditTopicAuto,
+	AuditTopicAccept, AuditTopicDecline, AuditTopicEdit, AuditTopicState,
+	AuditTopicPropose, AuditTopicReview, AuditTopicRequest, AuditRequestReview,
+	AuditUserRole, AuditUserDisable, AuditImport, AuditImpersonate,
+	AuditGroupAlias, AuditGroupMerge, AuditTermRollover,
+}
+
+// Actor - кто выполняет действие. В режиме просмотра от имени пользователя
+// это администратор, а OnBehalfOf - пользователь, от чьего имени он действует
+type Actor struct {
+	UserID     uint
+	Email      string
+	Role       string
+	IP         string
+	OnBehalfOf string
+}
+
+// AuditRecord - одно действие для журнала
+type AuditRecord struct {
+	Action     string
+	TargetType string
+	TargetID   uint
+	Summary    string
+	Before     interface{}
+	After      interface{}
+}
+
+// Audit - записывает действие в журнал. Ошибка записи не должна
+// отменять само действие, поэтому она только логируется
+func Audit(actor Actor, rec AuditRecord) {
+	entry := models.AuditEntry{
+		CreatedAt:  time.Now(),
+		ActorID:    actor.UserID,
+		ActorEmail: actor.Email,
+		ActorRole:  actor.Role,
+		OnBehalfOf: actor.OnBehalfOf,
+		Action:     rec.Action,
+		TargetType: rec.TargetType,
+		TargetID:   rec.TargetID,
+		Summary:    rec.Summary,
+		Before:     auditJSON(rec.Before),
+		After:      auditJSON(rec.After),
+		IP:         actor.IP,
+	}
+	if len([]rune(entry.Summary)) > 500 {
+		entry.Summary = string([]rune(entry.Summary)[:500])
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		log.Printf("Ошибка записи в журнал аудита (%s): %v", rec.Action, err)
+	}
+}
+
+func auditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// AuditFilter - условия выборки журнала; пустые поля не ограничивают
+type AuditFilter struct {
+	Actor  string // email или его часть
+	Action string
+	Target string // поиск по описанию
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// ListAudit - записи журнала по фильтру, новые сверху
+func ListAudit(f AuditFilter) ([]models.AuditEntry, error) {
+	q := db.Model(&models.AuditEntry{})
+	if f.Actor != "" {
+		q = q.Where("actor_email LIKE ?", "%"+strings.TrimSpace(f.Actor)+"%")
+	}
+	if f.Action != "" {
+		q = q.Where("action = ?", f.Action)
+	}
+	if f.Target != "" {
+		q = q.Where("summary LIKE ?", "%"+strings.TrimSpace(f.Target)+"%")
+	}
+	if !f.From.IsZero() {
+		q = q.Where("created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		q = q.Where("created_at < ?", f.To)
+	}
+	if f.Limit > 0 {
+		q = q.Limit(f.Limit)
+	}
+
+	var entries []models.AuditEntry
+	err := q.Order("created_at DESC, id DESC").Find(&entries).Error
+	return entries, err
+}
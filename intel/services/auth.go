@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"proj/intel/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// authCacheTTL - сколько держим роль в памяти. Изменения через сервис
+// сбрасывают кэш сразу, TTL нужен для правок в БД в обход приложения (бот, SQL)
+const authCacheTTL = 30 * time.Second
+
+var ErrUserDisabled = errors.New("учётная запись отключена")
+
+// UserAuth - актуальные права пользователя
+type UserAuth struct {
+	UserID       uint
+	Email        string
+	Role         string
+	HeadmanGroup string
+	Disabled     bool
+	Pending      bool // ждёт одобрения регистрации
+}
+
+type cachedAuth struct {
+	auth     UserAuth
+	loadedAt time.Time
+}
+
+var (
+	authCache   = map[uint]cachedAuth{}
+	authCacheMu sync.RWMutex
+)
+
+// ResolveUserAuth - возвращает текущую роль пользователя из кэша или БД.
+// Удалённые и отключённые пользователи получают ErrUserDisabled
+func ResolveUserAuth(userID uint) (*UserAuth, error) {
+	authCacheMu.RLock()
+	cached, ok := authCache[userID]
+	authCacheMu.RUnlock()
+	if ok && time.Since(cached.loadedAt) < authCacheTTL {
+		return checkAuth(cached.auth)
+	}
+
+	var user models.User
+	if err := db.Select("id", "email", "role", "headman_group", "disabled", "pending").First(&user, userID).Error; err != nil {
+		// Пользователь удалён - сессию дальше не пускаем
+		return nil, ErrUserDisabled
+	}
+
+	auth := UserAuth{
+		UserID:       user.ID,
+		Email:        user.Email,
+		Role:         user.Role,
+		HeadmanGroup: user.HeadmanGroup,
+		Disabled:     user.Disabled,
+		Pending:      user.Pending,
+	}
+
+	authCacheMu.Lock()
+	authCache[userID] = cachedAuth{auth: auth, loadedAt: time.Now()}
+	authCacheMu.Unlock()
+
+	return checkAuth(auth)
+}
+
+func checkAuth(auth UserAuth) (*UserAuth, error) {
+	if auth.Disabled {
+		return nil, ErrUserDisabled
+	}
+	return &auth, nil
+}
+
+// InvalidateUserAuth - сбрасывает кэш прав, следующий запрос перечитает роль из БД
+func InvalidateUserAuth(userID uint) {
+	authCacheMu.Lock()
+	delete(authCache, userID)
+	authCacheMu.Unlock()
+}
+
+// SetUserRole - меняет роль пользователя; изменение видно со следующего запроса.
+// Группа старосты должна быть в справочнике групп
+func SetUserRole(user *models.User, role, headmanGroup string) error {
+	if strings.TrimSpace(headmanGroup) != "" {
+		group, err := CanonicalGroup(headmanGroup)
+		if err != nil {
+			return err
+		}
+		headmanGroup = group
+	}
+	user.Role = role
+	user.HeadmanGroup = headmanGroup
+	err := db.Model(user).Updates(map[string]interface{}{
+		"role":          role,
+		"headman_group": headmanGroup,
+	}).Error
+	InvalidateUserAuth(user.ID)
+	return err
+}
+
+// SetUserDisabled - отключает или включает учётную запись.
+// При отключении все сессии пользователя отзываются
+func SetUserDisabled(user *models.User, disabled bool) error {
+	user.Disabled = disabled
+	if err := db.Model(user).Update("disabled", disabled).Error; err != nil {
+		return err
+	}
+	InvalidateUserAuth(user.ID)
+	if disabled {
+		return RevokeUserSessions(user.ID)
+	}
+	return nil
+}
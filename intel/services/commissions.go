@@ -0,0 +1,285 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"proj/intel/models"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCommissionName    = errors.New("не указано название комиссии")
+	ErrCommissionUnknown = errors.New("комиссия не найдена в справочнике")
+	ErrCommissionExists  = errors.New("такая комиссия уже есть")
+	ErrHeadNotMember     = errors.New("председатель должен быть членом комиссии")
+)
+
+// commissionStopWords - слова, которые пишут по-разному и не отличают одну комиссию от другой
+var commissionStopWords = map[string]bool{
+	"пцк": true, "цк": true, "цмк": true, "пмк": true,
+	"предметно": true, "цикловая": true, "методическая": true, "комиссия": true,
+}
+
+// commissionKey - название комиссии без регистра, кавычек и служебных слов:
+// «ПЦК "Экология"» и «Экология (цикловая комиссия)» дают один ключ
+func commissionKey(name string) string {
+	name = strings.ReplaceAll(strings.ToLower(name), "ё", "е")
+	var words []string
+	for _, w := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !commissionStopWords[w] {
+			words = append(words, w)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// ListCommissions - справочник комиссий с председателями и членами
+func ListCommissions() ([]models.Commission, error) {
+	var list []models.Commission
+	err := db.Preload("Head").Preload("Members", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("name")
+	}).Order("name").Find(&list).Error
+	return list, err
+}
+
+// FindCommission - комиссия по названию в любом написании; nil - не найдена
+func FindCommission(name string) (*models.Commission, error) {
+	key := commissionKey(name)
+	if key == "" {
+		return nil, nil
+	}
+	var list []models.Commission
+	if err := db.Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if commissionKey(list[i].Name) == key {
+			return &list[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateCommission - новая комиссия; название проверяется на дубли в любом написании
+func CreateCommission(name string) (*models.Commission, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if commissionKey(name) == "" {
+		return nil, ErrCommissionName
+	}
+	existing, err := FindCommission(name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, ErrCommissionExists
+	}
+	c := models.Commission{Name: name}
+	if err := db.Create(&c).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// EnsureCommission - комиссия по названию, при отсутствии создаётся.
+// Пустое название - руководитель или тема без комиссии (nil)
+func EnsureCommission(name string) (*models.Commission, error) {
+	c, err := CreateCommission(name)
+	switch {
+	case errors.Is(err, ErrCommissionName):
+		return nil, nil
+	case errors.Is(err, ErrCommissionExists):
+		return c, nil
+	}
+	return c, err
+}
+
+// SetCommissionHead - назначает председателя; nil снимает его.
+// Председатель должен входить в комиссию
+func SetCommissionHead(commissionID uint, supervisorID *uint) error {
+	var c models.Commission
+	if err := db.First(&c, commissionID).Error; err != nil {
+		return err
+	}
+	if supervisorID != nil {
+		var s models.Supervisor
+		if err := db.First(&s, *supervisorID).Error; err != nil {
+			return err
+		}
+		if s.CommissionID == nil || *s.CommissionID != c.ID {
+			return ErrHeadNotMember
+		}
+	}
+	return db.Model(&c).Update("head_id", supervisorID).Error
+}
+
+// SetSupervisorCommission - переводит руководителя в другую комиссию (nil - без комиссии).
+// Председатель, ушедший из комиссии, перестаёт быть председателем
+func SetSupervisorCommission(supervisorID uint, commissionID *uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var s models.Supervisor
+		if err := tx.First(&s, supervisorID).Error; err != nil {
+			return err
+		}
+		name := ""
+		if commissionID != nil {
+			var c models.Commission
+			if err := tx.First(&c, *commissionID).Error; err != nil {
+				return err
+			}
+			name = c.Name
+		}
+		if err := tx.Model(&models.Commission{}).
+			Where("head_id = ? AND id <> ?", s.ID, commissionIDOrZero(commissionID)).
+			Update("head_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Model(&s).Updates(map[string]interface{}{
+			"commission_id": commissionID,
+			"commission":    name,
+		}).Error
+	})
+}
+
+func commissionIDOrZero(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+// migrateCommissions - первое заполнение справочника ПЦК из текстовых названий
+// у руководителей и тем. Выполняется один раз, когда таблица комиссий только создана
+func migrateCommissions() error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var names []string
+		for _, table := range []string{"supervisors", "topics"} {
+			var list []string
+			if err := tx.Table(table).Distinct("commission").Where("commission <> ''").Pluck("commission", &list).Error; err != nil {
+				return err
+			}
+			names = append(names, list...)
+		}
+		sort.Strings(names)
+
+		byKey := map[string]uint{}
+		for _, name := range names {
+			key := commissionKey(name)
+			if key == "" {
+				continue
+			}
+			if _, ok := byKey[key]; !ok {
+				c := models.Commission{Name: strings.Join(strings.Fields(name), " ")}
+				if err := tx.Create(&c).Error; err != nil {
+					return err
+				}
+				byKey[key] = c.ID
+			}
+			for _, table := range []string{"supervisors", "topics"} {
+				if err := tx.Table(table).Where("commission = ?", name).Update("commission_id", byKey[key]).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if len(byKey) > 0 {
+			log.Printf("Миграция: создано комиссий из названий в темах и у руководителей: %d", len(byKey))
+		}
+		return nil
+	})
+}
+
+// CommissionGroupRow - строка выгрузки ПЦК: студент на теме или свободные места темы
+type CommissionGroupRow struct {
+	Topic      models.Topic
+	Supervisor string
+	Student    *models.User
+	Status     string // Свободна, Свободно мест, Назначена, Принята руководителем
+}
+
+// CommissionGroup - темы комиссии одной группы
+type CommissionGroup struct {
+	Group    string
+	Rows     []CommissionGroupRow
+	Topics   int // тем группы; у командной темы строк больше одной
+	Free     int // свободных мест
+	Assigned int
+	Accepted int
+}
+
+// CommissionReport - данные для выгрузки комиссии за текущий период, разбитые по группам
+func CommissionReport(c models.Commission) ([]CommissionGroup, error) {
+	var topics []models.Topic
+	if err := db.Preload("Supervisor").Scopes(ActiveTermTopics, ApprovedTopics, WithMembers).Where("commission_id = ?", c.ID).Order("title").Find(&topics).Error; err != nil {
+		return nil, err
+	}
+
+	groups := map[string]*CommissionGroup{}
+	groupOf := func(name string) *CommissionGroup {
+		if name == "" {
+			name = "Без группы"
+		}
+		g, ok := groups[name]
+		if !ok {
+			g = &CommissionGroup{Group: name}
+			groups[name] = g
+		}
+		return g
+	}
+	for _, t := range topics {
+		counted := map[*CommissionGroup]bool{}
+		for _, m := range t.Members {
+			row := CommissionGroupRow{Topic: t, Supervisor: t.SupervisorLabel(), Student: m.Student, Status: "Назначена"}
+			// Группа студента точнее группы, для которой предлагалась тема
+			group := t.Group
+			if m.Student != nil && m.Student.Group != "" {
+				group = m.Student.Group
+			}
+			g := groupOf(group)
+			g.Assigned++
+			if m.AcceptedAt != nil {
+				row.Status = "Принята руководителем"
+				g.Accepted++
+			}
+			g.Rows = append(g.Rows, row)
+			counted[g] = true
+		}
+
+		if places := t.Places(); places > 0 {
+			row := CommissionGroupRow{Topic: t, Supervisor: t.SupervisorLabel(), Status: "Свободна"}
+			if len(t.Members) > 0 {
+				row.Status = fmt.Sprintf("Свободно мест: %d", places)
+			}
+			g := groupOf(t.Group)
+			g.Free += places
+			g.Rows = append(g.Rows, row)
+			counted[g] = true
+		}
+		for g := range counted {
+			g.Topics++
+		}
+	}
+
+	result := make([]CommissionGroup, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Group < result[j].Group })
+	return result, nil
+}
+
+// CommissionFileName - имя файла выгрузки без символов, недопустимых в именах файлов
+func CommissionFileName(c models.Commission) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			return r
+		}
+		return '_'
+	}, c.Name)
+	return fmt.Sprintf("commission_%d_%s.xlsx", c.ID, name)
+}
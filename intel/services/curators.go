@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"proj/intel/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotOwnGroup    = errors.New("группа закреплена за другим куратором")
+	ErrNotGroupMember = errors.New("студент не из этой группы")
+)
+
+// CuratorGroup - группа куратора с ходом распределения тем
+type CuratorGroup struct {
+	Group        models.Groupfromcur
+	Students     []models.User // студенты и старосты группы, с темами
+	WithoutTopic []models.User
+	Headmen      []models.User // старосты, отвечающие за группу
+	Assigned     int
+	Accepted     int
+	FreeTopics   int // темы группы и темы без группы, где остались места
+}
+
+// Progress - доля студентов группы с темой, в процентах
+func (g CuratorGroup) Progress() int {
+	if len(g.Students) == 0 {
+		return 0
+	}
+	return g.Assigned * 100 / len(g.Students)
+}
+
+// groupStudents - условие выборки студентов и старост группы
+func groupStudents(code string) func(tx *gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("users.`group` = ? AND users.role IN ?", code, []string{"student", "headman"})
+	}
+}
+
+// groupTopics - условие выборки тем группы; темы без группы подходят любой
+func groupTopics(code string) func(tx *gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("topics.`group` = ? OR topics.`group` = '' OR topics.`group` IS NULL", code)
+	}
+}
+
+// CuratorGroups - группы, закреплённые за куратором, с ходом распределения
+func CuratorGroups(curatorID uint) ([]CuratorGroup, error) {
+	var groups []models.Groupfromcur
+	if err := db.Where("curator_id = ?", curatorID).Order("`group`").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]CuratorGroup, 0, len(groups))
+	for _, g := range groups {
+		item := CuratorGroup{Group: g}
+		if err := db.Scopes(WithCurrentTopic, groupStudents(g.Code)).Order("name").Find(&item.Students).Error; err != nil {
+			return nil, err
+		}
+		for _, s := range item.Students {
+			switch {
+			case s.Membership == nil:
+				item.WithoutTopic = append(item.WithoutTopic, s)
+			case s.Membership.AcceptedAt != nil:
+				item.Accepted++
+				item.Assigned++
+			default:
+				item.Assigned++
+			}
+		}
+		if err := db.Where("role = ? AND headman_group = ?", "headman", g.Code).Order("name").Find(&item.Headmen).Error; err != nil {
+			return nil, err
+		}
+
+		var free int64
+		if err := db.Model(&models.Topic{}).Scopes(ActiveTermTopics, FreeTopics, groupTopics(g.Code)).Count(&free).Error; err != nil {
+			return nil, err
+		}
+		item.FreeTopics = int(free)
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// CuratorOwnGroup - группа справочника, если она закреплена за куратором
+func CuratorOwnGroup(curatorID, groupID uint) (*models.Groupfromcur, error) {
+	var group models.Groupfromcur
+	if err := db.First(&group, groupID).Error; err != nil {
+		return nil, err
+	}
+	if group.CuratorID == nil || *group.CuratorID != curatorID {
+		return nil, ErrNotOwnGroup
+	}
+	return &group, nil
+}
+
+// GroupStudentsWithoutTopic - студенты и старосты группы без назначенной темы
+func GroupStudentsWithoutTopic(code string) ([]models.User, error) {
+	var students []models.User
+	err := db.Scopes(WithoutTopic, groupStudents(code)).Find(&students).Error
+	return students, err
+}
+
+// GroupFreeTopics - темы текущего периода со свободными местами для группы и темы без группы
+func GroupFreeTopics(code string) ([]models.Topic, error) {
+	var topics []models.Topic
+	err := db.Preload("Members").Scopes(ActiveTermTopics, FreeTopics, groupTopics(code)).Find(&topics).Error
+	return topics, err
+}
+
+// GroupMember - студент или староста, который учится в группе
+func GroupMember(code string, userID uint) (*models.User, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.Group != code || (user.Role != "student" && user.Role != "headman") {
+		return nil, ErrNotGroupMember
+	}
+	return &user, nil
+}
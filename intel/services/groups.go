@@ -0,0 +1,442 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"proj/intel/models"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrGroupCode    = errors.New("не указан код группы")
+	ErrGroupUnknown = errors.New("группа не найдена в справочнике")
+	ErrGroupExists  = errors.New("такая группа уже есть в справочнике")
+	ErrAliasTaken   = errors.New("это написание уже относится к другой группе")
+	ErrSameGroup    = errors.New("группу нельзя объединить саму с собой")
+	ErrNotCurator   = errors.New("куратором может быть только пользователь с ролью куратора")
+	ErrOutsideScope = errors.New("группа вне вашей ответственности")
+)
+
+// groupLookalikes - латинские буквы, которые при наборе путают с кириллицей
+var groupLookalikes = strings.NewReplacer(
+	"A", "А", "B", "В", "C", "С", "E", "Е", "H", "Н", "K", "К",
+	"M", "М", "O", "О", "P", "Р", "T", "Т", "X", "Х", "Y", "У",
+)
+
+// groupKey - ключ сравнения групп: без регистра, пробелов и дефисов, с кириллицей вместо
+// похожей латиницы. «ис-202», «ИС 202» и «ИC-202» с латинской C дают один ключ
+func groupKey(name string) string {
+	name = groupLookalikes.Replace(strings.ToUpper(name))
+	name = strings.ReplaceAll(name, "Ё", "Е")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// groupTables - где хранятся коды групп: таблица и столбец
+var groupTables = [][2]string{
+	{"users", "group"},
+	{"users", "headman_group"},
+	{"topics", "group"},
+	{"enrollment_codes", "group"},
+}
+
+// groupIndex - группы справочника по ключу кода и ключам псевдонимов
+func groupIndex(tx *gorm.DB) (map[string]models.Groupfromcur, error) {
+	var groups []models.Groupfromcur
+	if err := tx.Preload("Aliases").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	index := make(map[string]models.Groupfromcur, len(groups))
+	for _, g := range groups {
+		for _, a := range g.Aliases {
+			index[groupKey(a.Alias)] = g
+		}
+	}
+	// Код группы важнее чужого псевдонима с тем же ключом
+	for _, g := range groups {
+		index[groupKey(g.Code)] = g
+	}
+	return index, nil
+}
+
+// ListGroups - справочник групп с кураторами и псевдонимами
+func ListGroups() ([]models.Groupfromcur, error) {
+	var list []models.Groupfromcur
+	err := db.Preload("Curator").Preload("Aliases").Order("`group`").Find(&list).Error
+	return list, err
+}
+
+// ResolveGroup - группа справочника по коду в любом написании или по псевдониму; nil - не найдена
+func ResolveGroup(name string) (*models.Groupfromcur, error) {
+	key := groupKey(name)
+	if key == "" {
+		return nil, nil
+	}
+	index, err := groupIndex(db)
+	if err != nil {
+		return nil, err
+	}
+	if g, ok := index[key]; ok {
+		return &g, nil
+	}
+	return nil, nil
+}
+
+// CanonicalGroup - код группы из справочника для введённого названия
+func CanonicalGroup(name string) (string, error) {
+	g, err := ResolveGroup(name)
+	if err != nil {
+		return "", err
+	}
+	if g == nil {
+		return "", ErrGroupUnknown
+	}
+	return g.Code, nil
+}
+
+// GroupScope - группы, с которыми работает пользователь
+type GroupScope struct {
+	All    bool     // администратор: любые группы
+	Groups []string // куратор - закреплённые за ним, староста - своя
+}
+
+// Allows - входит ли группа в зону ответственности
+func (s GroupScope) Allows(group string) bool {
+	if s.All {
+		return true
+	}
+	for _, g := range s.Groups {
+		if g != "" && g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Students - условие выборки студентов из групп зоны ответственности
+func (s GroupScope) Students(tx *gorm.DB) *gorm.DB {
+	if s.All {
+		return tx
+	}
+	return tx.Where("users.`group` IN ?", s.nonEmpty())
+}
+
+// Topics - условие выборки тем групп зоны ответственности; темы без группы подходят любой
+func (s GroupScope) Topics(tx *gorm.DB) *gorm.DB {
+	if s.All {
+		return tx
+	}
+	return tx.Where("topics.`group` IN ? OR topics.`group` = '' OR topics.`group` IS NULL", s.nonEmpty())
+}
+
+// nonEmpty - группы без пустых значений; пустой список заменяется недостижимым значением
+func (s GroupScope) nonEmpty() []string {
+	groups := make([]string, 0, len(s.Groups))
+	for _, g := range s.Groups {
+		if g != "" {
+			groups = append(groups, g)
+		}
+	}
+	if len(groups) == 0 {
+		return []string{""}
+	}
+	return groups
+}
+
+// ManagedGroups - зона ответственности пользователя при назначении тем и выгрузке
+func ManagedGroups(user models.User) (GroupScope, error) {
+	var scope GroupScope
+	switch user.Role {
+	case "admin":
+		scope.All = true
+	case "curator":
+		if err := db.Model(&models.Groupfromcur{}).Where("curator_id = ?", user.ID).
+			Order("`group`").Pluck("group", &scope.Groups).Error; err != nil {
+			return scope, err
+		}
+	case "headman":
+		if user.HeadmanGroup != "" {
+			scope.Groups = []string{user.HeadmanGroup}
+		}
+	}
+	return scope, nil
+}
+
+// checkCurator - куратором назначается только пользователь с ролью curator
+func checkCurator(tx *gorm.DB, curatorID *uint) error {
+	if curatorID == nil {
+		return nil
+	}
+	var user models.User
+	if err := tx.First(&user, *curatorID).Error; err != nil {
+		return err
+	}
+	if user.Role != "curator" {
+		return ErrNotCurator
+	}
+	return nil
+}
+
+// CreateGroup - новая группа справочника. Записи, где группа написана иначе, приводятся к её коду
+func CreateGroup(group models.Groupfromcur) (*models.Groupfromcur, error) {
+	group.Code = strings.ToUpper(strings.Join(strings.Fields(group.Code), " "))
+	if groupKey(group.Code) == "" {
+		return nil, ErrGroupCode
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		index, err := groupIndex(tx)
+		if err != nil {
+			return err
+		}
+		if _, ok := index[groupKey(group.Code)]; ok {
+			return ErrGroupExists
+		}
+		if err := checkCurator(tx, group.CuratorID); err != nil {
+			return err
+		}
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		_, err = normalizeGroupStrings(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// UpdateGroup - специальность, курс и куратор группы
+func UpdateGroup(id uint, specialty string, year int, curatorID *uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var group models.Groupfromcur
+		if err := tx.First(&group, id).Error; err != nil {
+			return err
+		}
+		if err := checkCurator(tx, curatorID); err != nil {
+			return err
+		}
+		return tx.Model(&group).Updates(map[string]interface{}{
+			"name":       strings.TrimSpace(specialty),
+			"year":       year,
+			"curator_id": curatorID,
+		}).Error
+	})
+}
+
+// AddGroupAlias - запоминает другое написание группы и исправляет записи с ним.
+// Возвращает, сколько записей приведено к коду группы
+func AddGroupAlias(groupID uint, alias string) (models.Groupfromcur, int64, error) {
+	alias = strings.Join(strings.Fields(alias), " ")
+	var group models.Groupfromcur
+	var fixed int64
+	if groupKey(alias) == "" {
+		return group, 0, ErrGroupCode
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&group, groupID).Error; err != nil {
+			return err
+		}
+		index, err := groupIndex(tx)
+		if err != nil {
+			return err
+		}
+		existing, ok := index[groupKey(alias)]
+		if ok && existing.ID != group.ID {
+			return ErrAliasTaken
+		}
+		// Написание, которое и так узнаётся, отдельно не храним
+		if !ok {
+			if err := tx.Create(&models.GroupAlias{Alias: alias, GroupID: group.ID}).Error; err != nil {
+				return err
+			}
+		}
+		fixed, err = normalizeGroupStrings(tx)
+		return err
+	})
+	return group, fixed, err
+}
+
+// MergeGroups - объединяет ошибочную группу с правильной: её код становится псевдонимом,
+// студенты, старосты, темы и коды приглашения переходят в правильную группу.
+// Возвращает, сколько записей приведено к коду группы
+func MergeGroups(fromID, intoID uint) (from, into models.Groupfromcur, fixed int64, err error) {
+	if fromID == intoID {
+		return from, into, 0, ErrSameGroup
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&from, fromID).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&into, intoID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.GroupAlias{}).Where("group_id = ?", from.ID).Update("group_id", into.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.GroupAlias{Alias: from.Code, GroupID: into.ID}).Error; err != nil {
+			return err
+		}
+
+		// Незаполненные поля берём у объединяемой группы
+		updates := map[string]interface{}{}
+		if into.Specialty == "" && from.Specialty != "" {
+			updates["name"] = from.Specialty
+		}
+		if into.Year == 0 && from.Year != 0 {
+			updates["year"] = from.Year
+		}
+		if into.CuratorID == nil && from.CuratorID != nil {
+			updates["curator_id"] = from.CuratorID
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&into).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		// Удаляем совсем: код уникален, мягко удалённая запись мешала бы завести его снова
+		if err := tx.Unscoped().Delete(&from).Error; err != nil {
+			return err
+		}
+		fixed, err = normalizeGroupStrings(tx)
+		return err
+	})
+	return from, into, fixed, err
+}
+
+// normalizeGroupStrings - приводит все узнаваемые написания групп к кодам из справочника
+func normalizeGroupStrings(tx *gorm.DB) (int64, error) {
+	index, err := groupIndex(tx)
+	if err != nil {
+		return 0, err
+	}
+	var fixed int64
+	for _, t := range groupTables {
+		var values []string
+		column := tx.Statement.Quote(t[1])
+		if err := tx.Table(t[0]).Select("DISTINCT "+column).Where(column+" <> ''").Pluck(t[1], &values).Error; err != nil {
+			return 0, err
+		}
+		for _, v := range values {
+			g, ok := index[groupKey(v)]
+			if !ok || g.Code == v {
+				continue
+			}
+			res := tx.Table(t[0]).Where(column+" = ?", v).Update(t[1], g.Code)
+			if res.Error != nil {
+				return 0, res.Error
+			}
+			fixed += res.RowsAffected
+		}
+	}
+	return fixed, nil
+}
+
+// UnknownGroup - написание группы, которого нет в справочнике
+type UnknownGroup struct {
+	Name   string
+	Users  int64
+	Topics int64
+}
+
+// UnknownGroups - группы у студентов и тем, не найденные в справочнике
+func UnknownGroups() ([]UnknownGroup, error) {
+	index, err := groupIndex(db)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*UnknownGroup{}
+	for _, t := range groupTables[:3] {
+		var rows []struct {
+			Name  string
+			Total int64
+		}
+		column := db.Statement.Quote(t[1])
+		if err := db.Table(t[0]).Select(column + " AS name, COUNT(*) AS total").
+			Where(column + " <> ''").Group(column).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if _, ok := index[groupKey(row.Name)]; ok {
+				continue
+			}
+			u, ok := byName[row.Name]
+			if !ok {
+				u = &UnknownGroup{Name: row.Name}
+				byName[row.Name] = u
+			}
+			if t[0] == "topics" {
+				u.Topics += row.Total
+			} else {
+				u.Users += row.Total
+			}
+		}
+	}
+
+	result := make([]UnknownGroup, 0, len(byName))
+	for _, u := range byName {
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// migrateGroups - первое заполнение справочника групп из кодов у студентов, старост и тем.
+// Написания с одним ключом сводятся к самому частому
+func migrateGroups() error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		usage := map[string]map[string]int64{}
+		for _, t := range groupTables {
+			var rows []struct {
+				Name  string
+				Total int64
+			}
+			column := tx.Statement.Quote(t[1])
+			if err := tx.Table(t[0]).Select(column + " AS name, COUNT(*) AS total").
+				Where(column + " <> ''").Group(column).Scan(&rows).Error; err != nil {
+				return err
+			}
+			for _, row := range rows {
+				key := groupKey(row.Name)
+				if key == "" {
+					continue
+				}
+				if usage[key] == nil {
+					usage[key] = map[string]int64{}
+				}
+				usage[key][strings.TrimSpace(row.Name)] += row.Total
+			}
+		}
+
+		for _, spellings := range usage {
+			var best string
+			for name, total := range spellings {
+				if best == "" || total > spellings[best] || (total == spellings[best] && name < best) {
+					best = name
+				}
+			}
+			if err := tx.Create(&models.Groupfromcur{Code: best}).Error; err != nil {
+				return err
+			}
+		}
+
+		fixed, err := normalizeGroupStrings(tx)
+		if err != nil {
+			return err
+		}
+		if len(usage) > 0 {
+			log.Printf("Миграция: создано групп в справочнике: %d, исправлено написаний: %d", len(usage), fixed)
+		}
+		return nil
+	})
+}
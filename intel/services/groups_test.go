@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"proj/intel/models"
+	"testing"
+)
+
+func TestManagedGroups(t *testing.T) {
+	useTestDB(t)
+	curator := &models.User{Name: "Куратор", Email: "cur@college.test", Password: "-", Role: "curator"}
+	if err := db.Create(curator).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range []models.Groupfromcur{
+		{Code: "ИС-202", CuratorID: &curator.ID},
+		{Code: "ИС-201", CuratorID: &curator.ID},
+		{Code: "ПИ-31"},
+	} {
+		if err := db.Create(&g).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name    string
+		user    models.User
+		allowed []string
+		denied  []string
+	}{
+		{"администратор", models.User{Role: "admin"}, []string{"ИС-202", "ПИ-31"}, nil},
+		{"куратор", *curator, []string{"ИС-201", "ИС-202"}, []string{"ПИ-31", ""}},
+		{"староста", models.User{Role: "headman", HeadmanGroup: "ПИ-31"}, []string{"ПИ-31"}, []string{"ИС-202", ""}},
+		{"староста без группы", models.User{Role: "headman"}, nil, []string{"ПИ-31", ""}},
+		{"студент", models.User{Role: "student", Group: "ПИ-31"}, nil, []string{"ПИ-31"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			scope, err := ManagedGroups(c.user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, g := range c.allowed {
+				if !scope.Allows(g) {
+					t.Errorf("группа %q недоступна", g)
+				}
+			}
+			for _, g := range c.denied {
+				if scope.Allows(g) {
+					t.Errorf("группа %q доступна", g)
+				}
+			}
+		})
+	}
+}
+
+func TestAssignTopicOnlyToStudents(t *testing.T) {
+	useTestDB(t)
+	term := models.Term{Year: 2026, Semester: 1, Active: true}
+	if err := db.Create(&term).Error; err != nil {
+		t.Fatal(err)
+	}
+	topic := models.Topic{Title: "Тема", Status: models.TopicOpen, TermID: &term.ID, Capacity: 1}
+	if err := db.Create(&topic).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, role := range []string{"admin", "curator", "supervisor"} {
+		user := &models.User{Name: role, Email: role + "@college.test", Password: "-", Role: role}
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := AssignTopic(topic.ID, user.ID, Actor{}); !errors.Is(err, ErrNotStudent) {
+			t.Errorf("тема назначена роли %s: %v", role, err)
+		}
+	}
+
+	student := createTestUser(t, "student@college.test")
+	if err := AssignTopic(topic.ID, student.ID, Actor{}); err != nil {
+		t.Fatalf("тема не назначена студенту: %v", err)
+	}
+}
+
+func TestGroupScopeQueries(t *testing.T) {
+	useTestDB(t)
+	for _, u := range []*models.User{
+		{Name: "Свой", Email: "own@college.test", Password: "-", Role: "student", Group: "ИС-202"},
+		{Name: "Чужой", Email: "other@college.test", Password: "-", Role: "student", Group: "ПИ-31"},
+	} {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, topic := range []*models.Topic{
+		{Title: "Своя", Group: "ИС-202"},
+		{Title: "Чужая", Group: "ПИ-31"},
+		{Title: "Общая"},
+	} {
+		if err := db.Create(topic).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name     string
+		scope    GroupScope
+		students int64
+		topics   int64
+	}{
+		{"все группы", GroupScope{All: true}, 2, 2},
+		{"одна группа", GroupScope{Groups: []string{"ИС-202"}}, 1, 1},
+		{"без групп", GroupScope{}, 0, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var students, topics int64
+			db.Model(&models.User{}).Scopes(c.scope.Students).Count(&students)
+			// Общую тему отсекает условие рядом: OR внутри Topics не должен его обойти
+			db.Model(&models.Topic{}).Where("title <> ?", "Общая").Scopes(c.scope.Topics).Count(&topics)
+			if students != c.students || topics != c.topics {
+				t.Fatalf("студентов %d, тем %d; ожидалось %d и %d", students, topics, c.students, c.topics)
+			}
+		})
+	}
+}
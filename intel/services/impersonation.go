@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"proj/intel/models"
+	"time"
+)
+
+// ImpersonationTTL - сколько длится просмотр от имени пользователя
+const ImpersonationTTL = time.Hour
+
+var (
+	ErrImpersonationTarget = errors.New("войти можно только от имени студента или старосты")
+	ErrNotImpersonating    = errors.New("сессия не является просмотром от имени пользователя")
+)
+
+// impersonationRoles - чьими глазами администратор может посмотреть на систему
+var impersonationRoles = map[string]bool{
+	"student": true,
+	"headman": true,
+}
+
+// StartImpersonation - открывает сессию от имени пользователя. В ней хранятся
+// и пользователь, и администратор, и исходная сессия администратора для возврата
+func StartImpersonation(adminID uint, parentSessionID, targetEmail string, allowWrite bool, userAgent, ip string) (*models.Session, *models.User, error) {
+	var target models.User
+	if err := db.Where("email = ?", targetEmail).First(&target).Error; err != nil {
+		return nil, nil, err
+	}
+	if !impersonationRoles[target.Role] || target.ID == adminID {
+		return nil, nil, ErrImpersonationTarget
+	}
+	if target.Disabled {
+		return nil, nil, ErrUserDisabled
+	}
+
+	session, err := CreateSession(target.ID, userAgent, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	session.ImpersonatorID = &adminID
+	session.ParentSessionID = parentSessionID
+	session.ImpersonationWrite = allowWrite
+	session.ExpiresAt = time.Now().Add(ImpersonationTTL)
+	err = db.Model(session).Updates(map[string]interface{}{
+		"impersonator_id":     adminID,
+		"parent_session_id":   parentSessionID,
+		"impersonation_write": allowWrite,
+		"expires_at":          session.ExpiresAt,
+	}).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, &target, nil
+}
+
+// StopImpersonation - закрывает просмотр и возвращает исходную сессию администратора,
+// если она ещё действует
+func StopImpersonation(session *models.Session) (*models.Session, error) {
+	if !session.Impersonated() {
+		return nil, ErrNotImpersonating
+	}
+	if err := RevokeSession(session.ID); err != nil {
+		return nil, err
+	}
+
+	parent, err := GetActiveSession(session.ParentSessionID)
+	if err != nil || parent.UserID != *session.ImpersonatorID {
+		return nil, ErrSessionInvalid
+	}
+	return parent, nil
+}
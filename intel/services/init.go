@@ -15,6 +15,17 @@ var (
 	once sync.Once
 )
 
+// schema - таблицы, которые создаёт и обновляет автомиграция
+var schema = []interface{}{
+	&models.User{}, &models.Groupfromcur{}, &models.Term{}, &models.Topic{}, &models.TopicMember{},
+	&models.Session{}, &models.FailedLogin{},
+	&models.TwoFactor{}, &models.RecoveryCode{}, &models.TwoFactorPolicy{},
+	&models.EmailToken{}, &models.EnrollmentCode{}, &models.RegistrationSettings{},
+	&models.AuditEntry{}, &models.APIToken{}, &models.Supervisor{},
+	&models.Commission{}, &models.GroupAlias{}, &models.TopicTransition{},
+	&models.TopicChangeRequest{},
+}
+
 func InitDB() error {
 	var err error
 	once.Do(func() {
@@ -25,12 +36,66 @@ func InitDB() error {
 			return
 		}
 
+		// Перенос данных, который нужно сделать до изменения схемы
+		if err = migrateTopicAssignments(); err != nil {
+			log.Fatal("Ошибка миграции назначений тем:", err)
+			return
+		}
+		if err = migrateTopicStudentIndex(); err != nil {
+			log.Fatal("Ошибка миграции индекса тем:", err)
+			return
+		}
+
+		// Справочник ПЦК при первом создании заполняется из текстовых названий
+		newCommissions := !db.Migrator().HasTable(&models.Commission{})
+		// Справочник групп заполняется из кодов групп, когда у групп появляются курс и куратор
+		newGroups := !db.Migrator().HasColumn(&models.Groupfromcur{}, "Year")
+		// Статусы тем становятся состояниями жизненного цикла вместе с появлением истории переходов
+		newLifecycle := !db.Migrator().HasTable(&models.TopicTransition{})
+
 		// Автомиграция
-		err = db.AutoMigrate(&models.User{}, &models.Groupfromcur{}, &models.Topic{})
+		err = db.AutoMigrate(schema...)
 		if err != nil {
 			log.Fatal("Ошибка миграции:", err)
 			return
 		}
+		if newCommissions {
+			if err = migrateCommissions(); err != nil {
+				log.Fatal("Ошибка миграции комиссий:", err)
+				return
+			}
+		}
+		if newGroups {
+			if err = migrateGroups(); err != nil {
+				log.Fatal("Ошибка миграции групп:", err)
+				return
+			}
+		}
+
+		// Темы без учебного периода относятся к текущему
+		if err = ensureActiveTerm(); err != nil {
+			log.Fatal("Ошибка миграции учебных периодов:", err)
+			return
+		}
+
+		// Назначения из topics.student_id переносятся в topic_members
+		if err = migrateTopicMembers(); err != nil {
+			log.Fatal("Ошибка миграции участников тем:", err)
+			return
+		}
+		if newLifecycle {
+			if err = migrateTopicStates(); err != nil {
+				log.Fatal("Ошибка миграции состояний тем:", err)
+				return
+			}
+		}
+
+		// Темы с руководителем, записанным только текстом, связываем со справочником
+		if linked, _, linkErr := LinkTopicSupervisors(); linkErr != nil {
+			log.Printf("Ошибка привязки тем к руководителям: %v", linkErr)
+		} else if linked > 0 {
+			log.Printf("Миграция: привязано тем к руководителям: %d", linked)
+		}
 
 		fmt.Println("✅ База данных SQLite создана/подключена")
 		createDefaultAdmin()
@@ -39,10 +104,16 @@ func InitDB() error {
 }
 
 func createDefaultAdmin() {
+	hash, err := HashPassword("admin123")
+	if err != nil {
+		log.Printf("Ошибка создания администратора: %v", err)
+		return
+	}
+
 	admin := models.User{
 		Name:     "Администратор",
 		Email:    "admin@system.com",
-		Password: "admin123",
+		Password: hash,
 		Role:     "admin",
 	}
 
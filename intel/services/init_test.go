@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB - пустая БД в памяти со всей схемой вместо ./attendance.db на время теста
+func useTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	testDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("ошибка открытия БД: %v", err)
+	}
+	sqlDB, err := testDB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// У каждого соединения с :memory: своя база - оставляем одно
+	sqlDB.SetMaxOpenConns(1)
+	if err := testDB.AutoMigrate(schema...); err != nil {
+		t.Fatalf("ошибка миграции: %v", err)
+	}
+
+	saved := db
+	db = testDB
+	t.Cleanup(func() {
+		db = saved
+		sqlDB.Close()
+	})
+	return testDB
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"proj/intel/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTopicMove       = errors.New("недопустимый переход состояния темы")
+	ErrTopicChanged    = errors.New("состояние темы уже изменилось, обновите страницу")
+	ErrTopicNotOpen    = errors.New("тема не открыта для выбора")
+	ErrTopicAutoMove   = errors.New("состояния «Открыта» и «Назначена» меняются при назначении и снятии студентов")
+	ErrTopicHasMembers = errors.New("на теме есть студенты - сначала снимите их")
+	ErrTopicInWork     = errors.New("по теме уже идёт работа, снять студента нельзя")
+	ErrTopicNoMembers  = errors.New("на теме нет студентов - начинать работу некому")
+)
+
+// ApprovedTopics - условие выборки утверждённых тем: без черновиков, предложений на рассмотрении и архива
+func ApprovedTopics(tx *gorm.DB) *gorm.DB {
+	return tx.Where("topics.status NOT IN ?", []string{models.TopicDraft, models.TopicProposed, models.TopicArchived})
+}
+
+// moveTopic - единственное место, где меняется состояние темы: проверяет переход,
+// сохраняет новое состояние и записывает, кто и когда его сменил
+func moveTopic(tx *gorm.DB, topic *models.Topic, to string, actor Actor, note string) error {
+	from := topic.Status
+	if from == to {
+		return nil
+	}
+	if !models.CanMoveTopic(from, to) {
+		return fmt.Errorf("%w: «%s» → «%s»", ErrTopicMove, models.TopicStateLabel(from), models.TopicStateLabel(to))
+	}
+	// Открытую тему берут в работу, не дожидаясь полного набора, но хотя бы с одним студентом
+	if from == models.TopicOpen && to == models.TopicInProgress {
+		count, err := topicMemberCount(tx, topic.ID)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrTopicNoMembers
+		}
+	}
+	// Условие на прежнее состояние защищает от одновременной смены
+	res := tx.Model(&models.Topic{}).Where("id = ? AND status = ?", topic.ID, from).Update("status", to)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrTopicChanged
+	}
+	if err := tx.Create(&models.TopicTransition{
+		TopicID:    topic.ID,
+		From:       from,
+		To:         to,
+		ActorID:    actor.UserID,
+		ActorEmail: actor.Email,
+		OnBehalfOf: actor.OnBehalfOf,
+		Note:       strings.TrimSpace(note),
+		CreatedAt:  time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+	topic.Status = to
+	return nil
+}
+
+// topicMemberCount - сколько студентов назначено на тему
+func topicMemberCount(tx *gorm.DB, topicID uint) (int, error) {
+	var count int64
+	err := tx.Model(&models.TopicMember{}).Where("topic_id = ?", topicID).Count(&count).Error
+	return int(count), err
+}
+
+// syncTopicFill - переводит тему между «Открыта» и «Назначена» по числу назначенных студентов
+func syncTopicFill(tx *gorm.DB, topicID uint, actor Actor) error {
+	var topic models.Topic
+	if err := tx.First(&topic, topicID).Error; err != nil {
+		return err
+	}
+	count, err := topicMemberCount(tx, topic.ID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case topic.Status == models.TopicOpen && count >= topic.Capacity:
+		return moveTopic(tx, &topic, models.TopicAssigned, actor, "")
+	case topic.Status == models.TopicAssigned && count < topic.Capacity:
+		return moveTopic(tx, &topic, models.TopicOpen, actor, "")
+	}
+	return nil
+}
+
+// ChangeTopicState - смена состояния темы вручную. Возвращает тему и её прежнее состояние
+func ChangeTopicState(topicID uint, to string, actor Actor, note string) (models.Topic, string, error) {
+	var topic models.Topic
+	var from string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&topic, topicID).Error; err != nil {
+			return err
+		}
+		from = topic.Status
+		return changeTopicState(tx, &topic, to, actor, note)
+	})
+	return topic, from, err
+}
+
+func changeTopicState(tx *gorm.DB, topic *models.Topic, to string, actor Actor, note string) error {
+	if !models.IsTopicState(to) {
+		return ErrTopicMove
+	}
+	if models.AutoTopicMove(topic.Status, to) {
+		return ErrTopicAutoMove
+	}
+	// Открытую тему со студентами нельзя снять с выбора или закрыть: студенты остались бы без темы
+	if (topic.Status == models.TopicOpen || topic.Status == models.TopicAssigned) &&
+		(to == models.TopicApproved || to == models.TopicArchived) {
+		count, err := topicMemberCount(tx, topic.ID)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrTopicHasMembers
+		}
+	}
+	return moveTopic(tx, topic, to, actor, note)
+}
+
+// SupervisorTopicState - руководитель ведёт свою тему: в работе, сдана, защищена
+func SupervisorTopicState(s models.Supervisor, topicID uint, to string, actor Actor, note string) (models.Topic, string, error) {
+	var topic models.Topic
+	var from string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if topic, err = supervisorTopic(tx, s.ID, topicID); err != nil {
+			return err
+		}
+		from = topic.Status
+		if !models.SupervisorCanMoveTopic(from, to) {
+			return fmt.Errorf("%w: «%s» → «%s»", ErrTopicMove, models.TopicStateLabel(from), models.TopicStateLabel(to))
+		}
+		return changeTopicState(tx, &topic, to, actor, note)
+	})
+	return topic, from, err
+}
+
+// TopicTransitions - история смены состояний темы, новые сверху
+func TopicTransitions(topicID uint) ([]models.TopicTransition, error) {
+	var list []models.TopicTransition
+	err := db.Where("topic_id = ?", topicID).Order("id DESC").Find(&list).Error
+	return list, err
+}
+
+// LifecycleTopics - темы текущего периода с историей смены состояний
+func LifecycleTopics(state string) ([]models.Topic, error) {
+	var topics []models.Topic
+	q := db.Preload("Supervisor").Preload("Transitions", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("topic_transitions.id DESC")
+	}).Scopes(ActiveTermTopics, WithMembers)
+	if state != "" {
+		q = q.Where("status = ?", state)
+	}
+	err := q.Order("title").Find(&topics).Error
+	return topics, err
+}
+
+// migrateTopicStates - статусы «free»/«assigned» становятся состояниями жизненного цикла:
+// темы прошедших периодов уходят в архив, остальные открыты или назначены по числу студентов
+func migrateTopicStates() error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Topic{}).
+			Where("status NOT IN ? OR status IS NULL", models.TopicStates).
+			Update("status", models.TopicOpen).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Topic{}).
+			Where("term_id IS NOT NULL AND term_id <> (SELECT id FROM terms WHERE active = ? LIMIT 1)", true).
+			Update("status", models.TopicArchived).Error; err != nil {
+			return err
+		}
+		return syncAllTopicStatuses(tx)
+	})
+}
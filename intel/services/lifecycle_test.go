@@ -0,0 +1,40 @@
+package services
+
+import (
+	"errors"
+	"proj/intel/models"
+	"testing"
+)
+
+// Командную тему, набранную не полностью, можно взять в работу, пустую - нельзя
+func TestOpenTeamTopicToInProgress(t *testing.T) {
+	useTestDB(t)
+	term := models.Term{Year: 2026, Semester: 1, Active: true}
+	if err := db.Create(&term).Error; err != nil {
+		t.Fatal(err)
+	}
+	team := models.Topic{Title: "Командная", Status: models.TopicOpen, TermID: &term.ID, Capacity: 3}
+	empty := models.Topic{Title: "Пустая", Status: models.TopicOpen, TermID: &term.ID, Capacity: 3}
+	for _, topic := range []*models.Topic{&team, &empty} {
+		if err := db.Create(topic).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, email := range []string{"a@college.test", "b@college.test"} {
+		student := createTestUser(t, email)
+		if err := AssignTopic(team.ID, student.ID, Actor{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := ChangeTopicState(empty.ID, models.TopicInProgress, Actor{}, ""); !errors.Is(err, ErrTopicNoMembers) {
+		t.Fatalf("в работу взята тема без студентов: %v", err)
+	}
+	topic, from, err := ChangeTopicState(team.ID, models.TopicInProgress, Actor{}, "")
+	if err != nil {
+		t.Fatalf("тема 2 из 3 не взята в работу: %v", err)
+	}
+	if from != models.TopicOpen || topic.Status != models.TopicInProgress {
+		t.Fatalf("переход %s → %s", from, topic.Status)
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"proj/utils"
+	"strings"
+	"sync"
+)
+
+// Mailer - отправка писем. Реализация выбирается при запуске
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer - отправка через SMTP-сервер (STARTTLS включается автоматически, если сервер его поддерживает)
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + m.From,
+		"To: " + to,
+		"Subject: " + mimeHeader(subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Content-Transfer-Encoding: 8bit",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("ошибка отправки письма на %s: %w", to, err)
+	}
+	return nil
+}
+
+// LogMailer - пишет письма в лог; используется, если SMTP не настроен
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	log.Printf("📧 Письмо для %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+var (
+	mailer   Mailer
+	mailerMu sync.RWMutex
+)
+
+// MailerFromEnv - SMTP из переменных SMTP_HOST, SMTP_PORT, SMTP_USER, SMTP_PASSWORD, SMTP_FROM
+func MailerFromEnv() Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Printf("⚠️ SMTP_HOST не задан, письма будут выводиться в лог")
+		return LogMailer{}
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = os.Getenv("SMTP_USER")
+	}
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USER"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}
+}
+
+// SetMailer - подменяет способ отправки писем
+func SetMailer(m Mailer) {
+	mailerMu.Lock()
+	mailer = m
+	mailerMu.Unlock()
+}
+
+// GetMailer - текущий Mailer (по умолчанию из окружения)
+func GetMailer() Mailer {
+	mailerMu.RLock()
+	m := mailer
+	mailerMu.RUnlock()
+	if m != nil {
+		return m
+	}
+
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	if mailer == nil {
+		mailer = MailerFromEnv()
+	}
+	return mailer
+}
+
+// siteLink - строка со ссылкой на страницу сайта для уведомления.
+// Без APP_BASE_URL ссылку не добавляем: адрес из запроса клиента в письмо не попадает
+func siteLink(label, path string) string {
+	base, err := utils.BaseURL()
+	if err != nil {
+		return ""
+	}
+	return "\n" + label + ": " + base + path + "\n"
+}
+
+// mimeHeader - кодирует заголовок с кириллицей (RFC 2047)
+func mimeHeader(s string) string {
+	return mime.BEncoding.Encode("UTF-8", s)
+}
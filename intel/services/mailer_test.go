@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// smtpMessage - письмо, принятое тестовым SMTP-сервером
+type smtpMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// fakeSMTP - минимальный SMTP-сервер на 127.0.0.1 без TLS и авторизации
+type fakeSMTP struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+func startFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("не удалось открыть порт: %v", err)
+	}
+	s := &fakeSMTP{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	var msg smtpMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg = smtpMessage{From: smtpAddr(line)}
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.To = append(msg.To, smtpAddr(line))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// smtpAddr - адрес в угловых скобках из команды MAIL FROM или RCPT TO
+func smtpAddr(line string) string {
+	start, end := strings.Index(line, "<"), strings.Index(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+// Messages - принятые письма
+func (s *fakeSMTP) Messages() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+// Mailer - SMTPMailer, который отправляет на этот сервер, подключённый на время теста
+func (s *fakeSMTP) Mailer(t *testing.T) *SMTPMailer {
+	t.Helper()
+	_, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	m := &SMTPMailer{Host: "127.0.0.1", Port: port, From: "noreply@college.test"}
+	SetMailer(m)
+	t.Cleanup(func() { SetMailer(nil) })
+	return m
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := startFakeSMTP(t)
+	m := server.Mailer(t)
+
+	if err := m.Send("student@college.test", "Тема утверждена", "Здравствуйте!\nТема назначена."); err != nil {
+		t.Fatalf("ошибка отправки: %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("ожидалось одно письмо, получено %d", len(messages))
+	}
+	msg := messages[0]
+	if msg.From != "noreply@college.test" {
+		t.Errorf("отправитель %q", msg.From)
+	}
+	if len(msg.To) != 1 || msg.To[0] != "student@college.test" {
+		t.Errorf("получатели %v", msg.To)
+	}
+	for _, want := range []string{
+		"To: student@college.test\r\n",
+		"Subject: " + mimeHeader("Тема утверждена") + "\r\n",
+		"Content-Type: text/plain; charset=UTF-8\r\n",
+		"Здравствуйте!\r\nТема назначена.",
+	} {
+		if !strings.Contains(msg.Data, want) {
+			t.Errorf("в письме нет %q:\n%s", want, msg.Data)
+		}
+	}
+}
+
+func TestSMTPMailerSendError(t *testing.T) {
+	server := startFakeSMTP(t)
+	m := server.Mailer(t)
+	server.ln.Close()
+
+	if err := m.Send("student@college.test", "Тема", "Текст"); err == nil {
+		t.Fatal("ошибка соединения не возвращена")
+	}
+}
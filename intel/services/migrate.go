@@ -0,0 +1,210 @@
+package services
+
+import (
+	"log"
+	"proj/intel/models"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrateTopicAssignments - переносит назначения из устаревшего столбца users.topic
+// в topics.student_id и приводит данные в порядок перед созданием внешнего ключа:
+//   - student_id = 0 и ссылки на удалённых пользователей сбрасываются в NULL;
+//   - если за студентом числится несколько тем, остаётся та, что записана у него
+//     в users.topic (иначе - с меньшим ID), остальные освобождаются;
+//   - студенту с заполненным users.topic без темы назначается свободная тема
+//     с тем же названием (сначала ищется тема его группы);
+//   - статус темы выставляется по student_id.
+//
+// Выполняется, пока в users есть столбец topic; в конце столбец удаляется
+func migrateTopicAssignments() error {
+	m := db.Migrator()
+	if !m.HasTable("users") || !m.HasColumn("users", "topic") {
+		return nil
+	}
+	log.Printf("Миграция: перенос назначений тем из users.topic")
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if m.HasTable("topics") {
+			if err := reconcileTopicAssignments(tx); err != nil {
+				return err
+			}
+		}
+		return tx.Exec("ALTER TABLE users DROP COLUMN topic").Error
+	})
+}
+
+type legacyUser struct {
+	ID    uint
+	Group string
+	Topic string
+}
+
+func reconcileTopicAssignments(tx *gorm.DB) error {
+	var users []legacyUser
+	if err := tx.Table("users").Select("id, `group`, topic").Where("deleted_at IS NULL").Find(&users).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]legacyUser, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	var topics []struct {
+		ID        uint
+		Title     string
+		Group     string
+		StudentID *uint
+	}
+	if err := tx.Table("topics").Select("id, title, `group`, student_id").Order("id").Find(&topics).Error; err != nil {
+		return err
+	}
+
+	owner := map[uint]uint{}    // тема -> студент после сверки
+	taken := map[uint]uint{}    // студент -> тема
+	claims := map[uint][]uint{} // студент -> все темы, где он записан
+	titles := make(map[uint]string, len(topics))
+	for _, t := range topics {
+		titles[t.ID] = t.Title
+		if t.StudentID == nil {
+			continue
+		}
+		if _, ok := byID[*t.StudentID]; !ok {
+			continue // 0 или удалённый пользователь
+		}
+		claims[*t.StudentID] = append(claims[*t.StudentID], t.ID)
+	}
+	for studentID, ids := range claims {
+		keep := ids[0]
+		for _, id := range ids {
+			if titles[id] == byID[studentID].Topic {
+				keep = id
+				break
+			}
+		}
+		if len(ids) > 1 {
+			log.Printf("Миграция: у студента %d несколько тем %v, оставлена %d", studentID, ids, keep)
+		}
+		owner[keep] = studentID
+		taken[studentID] = keep
+	}
+
+	// Студенты, у которых тема записана только в users.topic
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	for _, u := range users {
+		if u.Topic == "" {
+			continue
+		}
+		if _, ok := taken[u.ID]; ok {
+			continue
+		}
+		var match uint
+		for _, t := range topics {
+			if _, busy := owner[t.ID]; busy || t.Title != u.Topic {
+				continue
+			}
+			if t.Group == u.Group {
+				match = t.ID
+				break
+			}
+			if match == 0 {
+				match = t.ID
+			}
+		}
+		if match == 0 {
+			log.Printf("Миграция: для студента %d не найдена свободная тема «%s», назначение потеряно", u.ID, u.Topic)
+			continue
+		}
+		owner[match] = u.ID
+		taken[u.ID] = match
+	}
+
+	// Сначала освобождаем все темы, чтобы не нарушить уникальность student_id при переносе
+	if err := tx.Table("topics").Where("1 = 1").
+		Updates(map[string]interface{}{"student_id": nil, "status": models.TopicOpen}).Error; err != nil {
+		return err
+	}
+	for topicID, studentID := range owner {
+		if err := tx.Table("topics").Where("id = ?", topicID).
+			Updates(map[string]interface{}{"student_id": studentID, "status": models.TopicAssigned}).Error; err != nil {
+			return err
+		}
+	}
+	log.Printf("Миграция: назначений тем после сверки: %d", len(owner))
+	return nil
+}
+
+// migrateTopicStudentIndex - уникальность темы студента теперь в пределах учебного периода
+// (idx_topics_term_student); прежний индекс только по student_id мешал бы назначению
+// в новом периоде, поэтому удаляется до автомиграции
+func migrateTopicStudentIndex() error {
+	m := db.Migrator()
+	if !m.HasTable("topics") || !m.HasIndex("topics", "idx_topics_student_id") {
+		return nil
+	}
+	log.Printf("Миграция: уникальность назначения темы - в пределах учебного периода")
+	return db.Exec("DROP INDEX idx_topics_student_id").Error
+}
+
+// migrateTopicMembers - назначения переезжают из topics.student_id и topics.accepted_at
+// в topic_members, чтобы на тему можно было назначить несколько студентов.
+// Выполняется после автомиграции, когда у тем уже есть учебный период; SQLite удаляет
+// столбцы пересозданием таблицы, поэтому индексы тем затем создаются заново
+func migrateTopicMembers() error {
+	m := db.Migrator()
+	if !m.HasColumn("topics", "student_id") {
+		return nil
+	}
+	log.Printf("Миграция: перенос назначений тем в topic_members")
+
+	// В старых базах руководитель ещё не принимал студентов
+	accepted := "NULL"
+	if m.HasColumn("topics", "accepted_at") {
+		accepted = "accepted_at"
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Exec("INSERT INTO topic_members (topic_id, student_id, term_id, accepted_at, created_at)"+
+			" SELECT id, student_id, term_id, "+accepted+", ? FROM topics"+
+			" WHERE student_id IS NOT NULL AND term_id IS NOT NULL AND student_id IN (SELECT id FROM users)", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		log.Printf("Миграция: перенесено назначений: %d", res.RowsAffected)
+
+		tm := tx.Migrator()
+		if tm.HasIndex("topics", "idx_topics_term_student") {
+			if err := tx.Exec("DROP INDEX idx_topics_term_student").Error; err != nil {
+				return err
+			}
+		}
+		if tm.HasConstraint(&models.Topic{}, "fk_users_topic") {
+			if err := tm.DropConstraint(&models.Topic{}, "fk_users_topic"); err != nil {
+				return err
+			}
+		}
+		for _, column := range []string{"student_id", "accepted_at"} {
+			if !tm.HasColumn("topics", column) {
+				continue
+			}
+			if err := tm.DropColumn(&models.Topic{}, column); err != nil {
+				return err
+			}
+		}
+		return syncAllTopicStatuses(tx)
+	})
+	if err != nil {
+		return err
+	}
+	return db.AutoMigrate(&models.Topic{})
+}
+
+// syncAllTopicStatuses - открытые и назначенные темы переводятся друг в друга по числу студентов.
+// Это исправление данных при миграции, поэтому переходы не записываются
+func syncAllTopicStatuses(tx *gorm.DB) error {
+	return tx.Model(&models.Topic{}).Where("status IN ?", []string{models.TopicOpen, models.TopicAssigned}).
+		Update("status", gorm.Expr("CASE WHEN capacity > (SELECT COUNT(*) FROM topic_members WHERE topic_members.topic_id = topics.id) THEN ? ELSE ? END",
+			models.TopicOpen, models.TopicAssigned)).Error
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"proj/intel/models"
+	"proj/utils"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// Переменные окружения для входа через провайдера OpenID Connect:
+//
+//	OIDC_ISSUER        - адрес провайдера (discovery: <issuer>/.well-known/openid-configuration)
+//	OIDC_CLIENT_ID     - идентификатор клиента
+//	OIDC_CLIENT_SECRET - секрет клиента (для публичного клиента можно не задавать, PKCE используется всегда)
+//	OIDC_REDIRECT_URL  - адрес возврата; по умолчанию <APP_BASE_URL>/login/oidc/callback
+//	OIDC_SCOPES        - дополнительные scope через пробел (openid, email, profile добавляются всегда)
+//	OIDC_NAME          - название провайдера на кнопке входа
+//	OIDC_PROVISION     - "true": создавать студента, если учётной записи с таким email нет
+//	OIDC_TRUST_EMAIL   - "true": доверять email без claim email_verified
+var (
+	ErrOIDCDisabled        = errors.New("вход через провайдера не настроен")
+	ErrOIDCEmailUnverified = errors.New("провайдер не подтвердил адрес электронной почты")
+	ErrOIDCNoAccount       = errors.New("учётная запись с этим адресом не найдена")
+	ErrOIDCNoRedirect      = errors.New("не задан адрес возврата: укажите OIDC_REDIRECT_URL или APP_BASE_URL")
+)
+
+// OIDCConfig - настройки провайдера
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Name         string
+	Provision    bool
+	TrustEmail   bool
+}
+
+// OIDCIdentity - проверенные данные из ID-токена
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OIDCClient - клиент провайдера после discovery
+type OIDCClient struct {
+	cfg      OIDCConfig
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+var (
+	oidcConfig     OIDCConfig
+	oidcConfigOnce sync.Once
+	oidcClient     *OIDCClient
+	oidcMu         sync.Mutex
+)
+
+// OIDCConfigFromEnv - настройки из окружения; без OIDC_ISSUER вход выключен
+func OIDCConfigFromEnv() OIDCConfig {
+	cfg := OIDCConfig{
+		Issuer:       strings.TrimRight(os.Getenv("OIDC_ISSUER"), "/"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Name:         os.Getenv("OIDC_NAME"),
+		Provision:    os.Getenv("OIDC_PROVISION") == "true",
+		TrustEmail:   os.Getenv("OIDC_TRUST_EMAIL") == "true",
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}
+	cfg.Scopes = append(cfg.Scopes, strings.Fields(os.Getenv("OIDC_SCOPES"))...)
+	if cfg.RedirectURL == "" {
+		if base, err := utils.BaseURL(); err == nil {
+			cfg.RedirectURL = base + "/login/oidc/callback"
+		}
+	}
+	if cfg.Name == "" {
+		cfg.Name = "единый вход колледжа"
+	}
+	return cfg
+}
+
+// SetOIDCConfig - подменяет настройки провайдера (сбрасывает discovery)
+func SetOIDCConfig(cfg OIDCConfig) {
+	oidcConfigOnce.Do(func() {})
+	oidcMu.Lock()
+	oidcConfig = cfg
+	oidcClient = nil
+	oidcMu.Unlock()
+}
+
+func currentOIDCConfig() OIDCConfig {
+	oidcConfigOnce.Do(func() {
+		oidcMu.Lock()
+		oidcConfig = OIDCConfigFromEnv()
+		oidcMu.Unlock()
+	})
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	return oidcConfig
+}
+
+// OIDCEnabled - показывать ли кнопку входа через провайдера
+func OIDCEnabled() bool {
+	cfg := currentOIDCConfig()
+	return cfg.Issuer != "" && cfg.ClientID != ""
+}
+
+// OIDCProviderName - подпись для кнопки входа; пусто, если вход выключен
+func OIDCProviderName() string {
+	if !OIDCEnabled() {
+		return ""
+	}
+	return currentOIDCConfig().Name
+}
+
+// GetOIDCClient - клиент провайдера. Discovery выполняется при первом входе,
+// а не при старте: недоступный провайдер не должен мешать запуску сервера
+func GetOIDCClient(ctx context.Context) (*OIDCClient, error) {
+	if !OIDCEnabled() {
+		return nil, ErrOIDCDisabled
+	}
+	cfg := currentOIDCConfig()
+	if cfg.RedirectURL == "" {
+		return nil, ErrOIDCNoRedirect
+	}
+
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	if oidcClient != nil {
+		return oidcClient, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка discovery провайдера %s: %w", cfg.Issuer, err)
+	}
+	oidcClient = &OIDCClient{
+		cfg: cfg,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}
+	log.Printf("Провайдер входа %s подключён", cfg.Issuer)
+	return oidcClient, nil
+}
+
+// AuthCodeURL - адрес, куда отправить пользователя (authorization code + PKCE S256)
+func (c *OIDCClient) AuthCodeURL(state, nonce, verifier string) string {
+	return c.oauth.AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(verifier),
+	)
+}
+
+// Exchange - обменивает код на токены и проверяет ID-токен
+func (c *OIDCClient) Exchange(ctx context.Context, code, nonce, verifier string) (*OIDCIdentity, error) {
+	token, err := c.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обмена кода: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("провайдер не вернул id_token")
+	}
+	idToken, err := c.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("неверный id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("неверный nonce в id_token")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified *bool  `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	identity := &OIDCIdentity{
+		Issuer:  idToken.Issuer,
+		Subject: idToken.Subject,
+		Email:   strings.ToLower(strings.TrimSpace(claims.Email)),
+		Name:    strings.TrimSpace(claims.Name),
+	}
+	if claims.EmailVerified != nil {
+		identity.EmailVerified = *claims.EmailVerified
+	} else {
+		identity.EmailVerified = c.cfg.TrustEmail
+	}
+	return identity, nil
+}
+
+// OIDCUser - находит учётную запись по subject или email, при необходимости создаёт студента
+func OIDCUser(id *OIDCIdentity) (*models.User, error) {
+	subject := id.Issuer + "|" + id.Subject
+
+	var user models.User
+	err := db.Where("oidc_subject = ?", subject).First(&user).Error
+	if err == nil {
+		return checkOIDCUser(&user)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// По email связываем только подтверждённый провайдером адрес,
+	// иначе можно было бы войти в чужую учётную запись
+	if id.Email == "" || !id.EmailVerified {
+		return nil, ErrOIDCEmailUnverified
+	}
+
+	err = db.Where("LOWER(email) = ?", id.Email).First(&user).Error
+	switch {
+	case err == nil:
+		if user.EmailVerifiedAt == nil {
+			// Адрес не подтверждён: учётную запись мог заранее создать кто угодно.
+			// Владелец адреса забирает её целиком, чужой пароль и сессии перестают действовать
+			if err := claimUnverifiedUser(&user, subject); err != nil {
+				return nil, err
+			}
+			log.Printf("Неподтверждённая учётная запись %s связана с провайдером входа, пароль и сессии сброшены", user.Email)
+			return checkOIDCUser(&user)
+		}
+		if err := db.Model(&user).Update("oidc_subject", subject).Error; err != nil {
+			return nil, err
+		}
+		log.Printf("Учётная запись %s связана с провайдером входа", user.Email)
+		return checkOIDCUser(&user)
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	return provisionOIDCUser(id, subject)
+}
+
+// claimUnverifiedUser - связывает с провайдером учётную запись с неподтверждённым адресом:
+// пароль заменяется случайным, 2FA снимается, все сессии отзываются
+func claimUnverifiedUser(user *models.User, subject string) error {
+	hash, err := unusablePassword()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"oidc_subject":      subject,
+			"email_verified_at": now,
+			"password":          hash,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.TwoFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		return err
+	}
+	InvalidateUserAuth(user.ID)
+	return nil
+}
+
+// unusablePassword - хэш случайного пароля, который никто не знает
+func unusablePassword() (string, error) {
+	random, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	return HashPassword(random)
+}
+
+func checkOIDCUser(user *models.User) (*models.User, error) {
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	return user, nil
+}
+
+// provisionOIDCUser - новый студент по данным провайдера, по правилам регистрации.
+// Группу провайдер не сообщает: до её выбора на странице ожидания кабинет закрыт
+func provisionOIDCUser(id *OIDCIdentity, subject string) (*models.User, error) {
+	settings := GetRegistrationSettings()
+	if !currentOIDCConfig().Provision || settings.RequireCode {
+		return nil, ErrOIDCNoAccount
+	}
+	if !EmailDomainAllowed(settings, id.Email) {
+		return nil, ErrDomainNotAllowed
+	}
+
+	// Пароля у такой учётной записи нет; при желании его можно задать через сброс пароля
+	hash, err := unusablePassword()
+	if err != nil {
+		return nil, err
+	}
+
+	name := id.Name
+	if name == "" {
+		name = id.Email
+	}
+	user := &models.User{
+		Name:        name,
+		Email:       id.Email,
+		Password:    hash,
+		Role:        "student",
+		Pending:     true,
+		OIDCSubject: subject,
+	}
+	if err := db.Create(user).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(user).Update("email_verified_at", gorm.Expr("CURRENT_TIMESTAMP")).Error; err != nil {
+		log.Printf("Ошибка отметки подтверждения email %s: %v", user.Email, err)
+	}
+	log.Printf("Создана учётная запись %s через провайдера входа", user.Email)
+	return user, nil
+}
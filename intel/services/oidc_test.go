@@ -0,0 +1,516 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"proj/intel/models"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testClientID    = "vkr-portal"
+	testRedirectURL = "https://vkr.college.test/login/oidc/callback"
+)
+
+// oidcGrant - выданный код авторизации и то, что провайдер запомнил о запросе
+type oidcGrant struct {
+	challenge string
+	nonce     string
+	redirect  string
+	claims    jwt.MapClaims
+}
+
+// mockIssuer - провайдер OpenID Connect на httptest: discovery, JWKS, авторизация и обмен кода с PKCE
+type mockIssuer struct {
+	srv      *httptest.Server
+	key      *rsa.PrivateKey // ключ из JWKS
+	signWith *rsa.PrivateKey // чем подписывать id_token; по умолчанию key
+
+	mu     sync.Mutex
+	claims jwt.MapClaims // данные пользователя для следующей авторизации
+	codes  map[string]oidcGrant
+}
+
+func startMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key, codes: map[string]oidcGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/authorize", m.authorize)
+	mux.HandleFunc("/token", m.token)
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+// useMockIssuer - вход через mockIssuer на время теста
+func useMockIssuer(t *testing.T, m *mockIssuer, cfg OIDCConfig) {
+	t.Helper()
+	cfg.Issuer = m.srv.URL
+	cfg.ClientID = testClientID
+	cfg.ClientSecret = "secret"
+	if cfg.RedirectURL == "" {
+		cfg.RedirectURL = testRedirectURL
+	}
+	cfg.Scopes = []string{"openid", "email", "profile"}
+	SetOIDCConfig(cfg)
+	t.Cleanup(func() { SetOIDCConfig(OIDCConfig{}) })
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                m.srv.URL,
+		"authorization_endpoint":                m.srv.URL + "/authorize",
+		"token_endpoint":                        m.srv.URL + "/token",
+		"jwks_uri":                              m.srv.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (m *mockIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   b64(m.key.N.Bytes()),
+			"e":   b64(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize - пользователь «вошёл» у провайдера: выдаём код и возвращаем на redirect_uri
+func (m *mockIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != testClientID || q.Get("response_type") != "code" ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	code := randomTestToken()
+	m.codes[code] = oidcGrant{
+		challenge: q.Get("code_challenge"),
+		nonce:     q.Get("nonce"),
+		redirect:  q.Get("redirect_uri"),
+		claims:    m.claims,
+	}
+	m.mu.Unlock()
+
+	back := q.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+	http.Redirect(w, r, back, http.StatusFound)
+}
+
+// token - обмен кода: код одноразовый, verifier должен совпасть с challenge
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	clientID, _, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+	}
+
+	m.mu.Lock()
+	grant, found := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	signWith := m.signWith
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !found || clientID != testClientID || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("redirect_uri") != grant.redirect ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   m.srv.URL,
+		"aud":   testClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": grant.nonce,
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+	if signWith == nil {
+		signWith = m.key
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = "test-key"
+	signed, err := idToken.SignedString(signWith)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func randomTestToken() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// login - проходит авторизацию у провайдера с данными пользователя claims и возвращает код
+func (m *mockIssuer) login(t *testing.T, client *OIDCClient, claims jwt.MapClaims, state, nonce, verifier string) string {
+	t.Helper()
+	m.mu.Lock()
+	m.claims = claims
+	m.mu.Unlock()
+
+	authURL := client.AuthCodeURL(state, nonce, verifier)
+	if !strings.HasPrefix(authURL, m.srv.URL+"/authorize?") {
+		t.Fatalf("адрес авторизации не из discovery: %s", authURL)
+	}
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("провайдер отклонил авторизацию: %d", resp.StatusCode)
+	}
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(back.String(), testRedirectURL+"?") {
+		t.Fatalf("возврат не на адрес из настроек: %s", back)
+	}
+	if back.Query().Get("state") != state {
+		t.Fatalf("провайдер вернул state %q вместо %q", back.Query().Get("state"), state)
+	}
+	return back.Query().Get("code")
+}
+
+func studentClaims(email string, verified interface{}) jwt.MapClaims {
+	claims := jwt.MapClaims{"sub": "u-" + email, "email": email, "name": "Петров Пётр"}
+	if verified != nil {
+		claims["email_verified"] = verified
+	}
+	return claims
+}
+
+func TestOIDCDiscoveryAndExchange(t *testing.T) {
+	issuer := startMockIssuer(t)
+	useMockIssuer(t, issuer, OIDCConfig{})
+
+	client, err := GetOIDCClient(context.Background())
+	if err != nil {
+		t.Fatalf("ошибка discovery: %v", err)
+	}
+	verifier := oauth2.GenerateVerifier()
+	authURL, _ := url.Parse(client.AuthCodeURL("st", "nn", verifier))
+	q := authURL.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") != oauth2.S256ChallengeFromVerifier(verifier) {
+		t.Fatalf("в адресе авторизации нет PKCE S256: %s", authURL)
+	}
+	if q.Get("nonce") != "nn" || q.Get("state") != "st" || q.Get("redirect_uri") != testRedirectURL {
+		t.Fatalf("неверные параметры авторизации: %s", authURL)
+	}
+
+	code := issuer.login(t, client, studentClaims("Petrov@College.test", true), "st", "nn", verifier)
+	identity, err := client.Exchange(context.Background(), code, "nn", verifier)
+	if err != nil {
+		t.Fatalf("ошибка обмена кода: %v", err)
+	}
+	if identity.Issuer != issuer.srv.URL || identity.Subject != "u-Petrov@College.test" {
+		t.Errorf("issuer/subject: %q %q", identity.Issuer, identity.Subject)
+	}
+	if identity.Email != "petrov@college.test" || !identity.EmailVerified || identity.Name != "Петров Пётр" {
+		t.Errorf("данные пользователя: %+v", identity)
+	}
+
+	// Код одноразовый
+	if _, err := client.Exchange(context.Background(), code, "nn", verifier); err == nil {
+		t.Fatal("код принят повторно")
+	}
+}
+
+func TestOIDCExchangeRejectsWrongVerifier(t *testing.T) {
+	issuer := startMockIssuer(t)
+	useMockIssuer(t, issuer, OIDCConfig{})
+	client, err := GetOIDCClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := issuer.login(t, client, studentClaims("a@college.test", true), "st", "nn", oauth2.GenerateVerifier())
+	if _, err := client.Exchange(context.Background(), code, "nn", oauth2.GenerateVerifier()); err == nil {
+		t.Fatal("код обменян с чужим PKCE verifier")
+	}
+}
+
+func TestOIDCExchangeRejectsNonceMismatch(t *testing.T) {
+	issuer := startMockIssuer(t)
+	useMockIssuer(t, issuer, OIDCConfig{})
+	client, err := GetOIDCClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := oauth2.GenerateVerifier()
+	code := issuer.login(t, client, studentClaims("a@college.test", true), "st", "nonce-from-provider", verifier)
+	_, err = client.Exchange(context.Background(), code, "nonce-from-cookie", verifier)
+	if err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Fatalf("id_token с чужим nonce принят: %v", err)
+	}
+}
+
+func TestOIDCExchangeRejectsUnknownKey(t *testing.T) {
+	issuer := startMockIssuer(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.signWith = other
+	useMockIssuer(t, issuer, OIDCConfig{})
+	client, err := GetOIDCClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := oauth2.GenerateVerifier()
+	code := issuer.login(t, client, studentClaims("a@college.test", true), "st", "nn", verifier)
+	if _, err := client.Exchange(context.Background(), code, "nn", verifier); err == nil {
+		t.Fatal("принят id_token, подписанный ключом не из JWKS")
+	}
+}
+
+func TestOIDCRequiresRedirectURL(t *testing.T) {
+	t.Setenv("APP_BASE_URL", "")
+	SetOIDCConfig(OIDCConfig{Issuer: "http://127.0.0.1:1", ClientID: testClientID})
+	t.Cleanup(func() { SetOIDCConfig(OIDCConfig{}) })
+
+	if _, err := GetOIDCClient(context.Background()); !errors.Is(err, ErrOIDCNoRedirect) {
+		t.Fatalf("ожидалась ошибка адреса возврата: %v", err)
+	}
+}
+
+// email_verified: без claim решает OIDC_TRUST_EMAIL, явное false - никогда не подтверждён
+func TestOIDCEmailVerifiedClaim(t *testing.T) {
+	cases := []struct {
+		name     string
+		verified interface{}
+		trust    bool
+		want     bool
+	}{
+		{"подтверждён", true, false, true},
+		{"не подтверждён", false, true, false},
+		{"без claim", nil, false, false},
+		{"без claim с доверием", nil, true, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			issuer := startMockIssuer(t)
+			useMockIssuer(t, issuer, OIDCConfig{TrustEmail: c.trust})
+			client, err := GetOIDCClient(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier := oauth2.GenerateVerifier()
+			code := issuer.login(t, client, studentClaims("a@college.test", c.verified), "st", "nn", verifier)
+			identity, err := client.Exchange(context.Background(), code, "nn", verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.EmailVerified != c.want {
+				t.Fatalf("EmailVerified = %v, ожидалось %v", identity.EmailVerified, c.want)
+			}
+		})
+	}
+}
+
+func TestOIDCUserLinksByVerifiedEmail(t *testing.T) {
+	useTestDB(t)
+	SetOIDCConfig(OIDCConfig{})
+	existing := createTestUser(t, "Ivanov@College.test")
+	db.Model(existing).Update("email_verified_at", time.Now())
+
+	identity := &OIDCIdentity{Issuer: "https://sso.college.test", Subject: "42", Email: "ivanov@college.test"}
+	if _, err := OIDCUser(identity); !errors.Is(err, ErrOIDCEmailUnverified) {
+		t.Fatalf("учётная запись связана по неподтверждённому адресу: %v", err)
+	}
+	var user models.User
+	db.First(&user, existing.ID)
+	if user.OIDCSubject != "" {
+		t.Fatal("subject сохранён без подтверждения адреса")
+	}
+
+	identity.EmailVerified = true
+	linked, err := OIDCUser(identity)
+	if err != nil {
+		t.Fatalf("ошибка связывания: %v", err)
+	}
+	if linked.ID != existing.ID {
+		t.Fatalf("связана другая учётная запись: %d", linked.ID)
+	}
+	db.First(&user, existing.ID)
+	if user.OIDCSubject != "https://sso.college.test|42" || user.EmailVerifiedAt == nil {
+		t.Fatalf("связь не сохранена: subject=%q verified=%v", user.OIDCSubject, user.EmailVerifiedAt)
+	}
+	if user.Password != existing.Password {
+		t.Fatal("у подтверждённой учётной записи сброшен пароль")
+	}
+
+	// Дальше учётная запись находится по subject, даже если адрес у провайдера сменился
+	again, err := OIDCUser(&OIDCIdentity{Issuer: "https://sso.college.test", Subject: "42", Email: "new@college.test"})
+	if err != nil || again.ID != existing.ID {
+		t.Fatalf("вход по subject: %v", err)
+	}
+}
+
+// Учётную запись с неподтверждённым адресом мог заранее создать злоумышленник:
+// после связывания его пароль, 2FA и сессии больше не действуют
+func TestOIDCUserClaimsUnverifiedAccount(t *testing.T) {
+	useTestDB(t)
+	SetOIDCConfig(OIDCConfig{})
+	hash, err := HashPassword("attacker-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := &models.User{Name: "Иванов Иван", Email: "ivanov@college.test", Password: hash, Role: "student", Group: "ИС-21"}
+	if err := db.Create(existing).Error; err != nil {
+		t.Fatal(err)
+	}
+	session, err := CreateSession(existing.ID, "test", "203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.TwoFactor{UserID: existing.ID, Secret: "JBSWY3DPEHPK3PXP", Enabled: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	linked, err := OIDCUser(&OIDCIdentity{Issuer: "https://sso.college.test", Subject: "42", Email: "ivanov@college.test", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("ошибка связывания: %v", err)
+	}
+	if linked.ID != existing.ID {
+		t.Fatalf("связана другая учётная запись: %d", linked.ID)
+	}
+
+	var user models.User
+	db.First(&user, existing.ID)
+	if user.OIDCSubject != "https://sso.college.test|42" || user.EmailVerifiedAt == nil {
+		t.Fatalf("связь не сохранена: subject=%q verified=%v", user.OIDCSubject, user.EmailVerifiedAt)
+	}
+	if ok, _ := CheckPassword(user.Password, "attacker-password"); ok {
+		t.Fatal("прежний пароль по-прежнему подходит")
+	}
+	var saved models.Session
+	db.First(&saved, "id = ?", session.ID)
+	if saved.RevokedAt == nil {
+		t.Fatal("прежняя сессия не отозвана")
+	}
+	if TwoFactorEnabled(existing.ID) {
+		t.Fatal("чужая 2FA осталась включённой")
+	}
+}
+
+func TestOIDCUserUnknownWithoutProvision(t *testing.T) {
+	useTestDB(t)
+	SetOIDCConfig(OIDCConfig{})
+
+	_, err := OIDCUser(&OIDCIdentity{Issuer: "https://sso.college.test", Subject: "7", Email: "new@college.test", EmailVerified: true})
+	if !errors.Is(err, ErrOIDCNoAccount) {
+		t.Fatalf("ожидалось отсутствие учётной записи: %v", err)
+	}
+}
+
+// Созданный через провайдера студент без группы ждёт её выбора и не может быть одобрен раньше
+func TestOIDCProvisionedStudentChoosesGroup(t *testing.T) {
+	useTestDB(t)
+	SetOIDCConfig(OIDCConfig{Provision: true})
+	t.Cleanup(func() { SetOIDCConfig(OIDCConfig{}) })
+	if err := db.Create(&models.Groupfromcur{Code: "ИС-202"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := OIDCUser(&OIDCIdentity{Issuer: "https://sso.college.test", Subject: "7", Email: "new@college.test", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("ошибка создания: %v", err)
+	}
+	if user.Role != "student" || user.Group != "" || !user.Pending {
+		t.Fatalf("созданный студент: role=%q group=%q pending=%v", user.Role, user.Group, user.Pending)
+	}
+	if _, err := ApproveUser(models.User{Role: "admin"}, user.ID); !errors.Is(err, ErrGroupMissing) {
+		t.Fatalf("одобрен студент без группы: %v", err)
+	}
+
+	if err := ChooseGroup(user, "ИС-999"); !errors.Is(err, ErrGroupUnknown) {
+		t.Fatalf("принята группа не из справочника: %v", err)
+	}
+	if err := ChooseGroup(user, "ис 202"); err != nil {
+		t.Fatalf("ошибка выбора группы: %v", err)
+	}
+	var saved models.User
+	db.First(&saved, user.ID)
+	if saved.Group != "ИС-202" || saved.Pending {
+		t.Fatalf("после выбора группы: group=%q pending=%v", saved.Group, saved.Pending)
+	}
+	if err := ChooseGroup(&saved, "ИС-202"); !errors.Is(err, ErrGroupChosen) {
+		t.Fatalf("группа сменена повторно: %v", err)
+	}
+}
+
+func TestChooseGroupKeepsApprovalQueue(t *testing.T) {
+	useTestDB(t)
+	if err := SaveRegistrationSettings(models.RegistrationSettings{RequireApproval: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Groupfromcur{Code: "ИС-202"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Name: "Сидоров", Email: "s@college.test", Password: "-", Role: "student", Pending: true}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ChooseGroup(user, "ИС-202"); err != nil {
+		t.Fatal(err)
+	}
+	if !user.Pending {
+		t.Fatal("при обязательном одобрении выбор группы открыл кабинет")
+	}
+	if _, err := ApproveUser(models.User{Role: "admin"}, user.ID); err != nil {
+		t.Fatalf("студент с группой не одобрен: %v", err)
+	}
+}
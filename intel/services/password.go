@@ -0,0 +1,74 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"proj/intel/models"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidCredentials = errors.New("неверный email или пароль")
+
+// dummyHash - используется, когда email не найден, чтобы время ответа
+// не выдавало существование учётной записи
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+// HashPassword - хэширует пароль перед сохранением в БД
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("ошибка хэширования пароля: %w", err)
+	}
+	return string(hash), nil
+}
+
+// isPasswordHash - проверяет, что в поле лежит bcrypt-хэш, а не старый открытый пароль
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") ||
+		strings.HasPrefix(stored, "$2b$") ||
+		strings.HasPrefix(stored, "$2y$")
+}
+
+// CheckPassword - сравнивает пароль с сохранённым значением.
+// needsRehash = true, если в БД лежал пароль в открытом виде
+func CheckPassword(stored, password string) (ok bool, needsRehash bool) {
+	if isPasswordHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil, false
+	}
+	ok = stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+	return ok, ok
+}
+
+// Authenticate - проверяет email и пароль. Старые пароли в открытом виде
+// при первом успешном входе заменяются на хэш
+func Authenticate(email, password string) (*models.User, error) {
+	var user models.User
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	ok, needsRehash := CheckPassword(user.Password, password)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	if needsRehash {
+		hash, err := HashPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Model(&user).Update("password", hash).Error; err != nil {
+			return nil, fmt.Errorf("ошибка обновления пароля: %w", err)
+		}
+		user.Password = hash
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"proj/intel/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrProposalTitle      = errors.New("не указано название темы")
+	ErrProposalWorkType   = errors.New("укажите вид работы: курсовая или дипломная")
+	ErrProposalSupervisor = errors.New("выберите руководителя из списка")
+	ErrProposalPending    = errors.New("предыдущее предложение ещё рассматривается")
+	ErrProposalHasTopic   = errors.New("тема на этот период уже назначена")
+	ErrProposalReason     = errors.New("укажите причину отказа")
+	ErrNotProposal        = errors.New("тема не ждёт рассмотрения")
+	ErrNotReviewer        = errors.New("предложение рассматривает выбранный руководитель или председатель его ПЦК")
+)
+
+// TopicProposal - тема, которую предлагает студент. При утверждении рецензент может её поправить
+type TopicProposal struct {
+	Title        string
+	Subject      string
+	WorkType     string // "course" или "diploma"
+	SupervisorID uint   // желаемый руководитель, при утверждении не меняется
+}
+
+func (p *TopicProposal) normalize() error {
+	p.Title = strings.Join(strings.Fields(p.Title), " ")
+	p.Subject = strings.Join(strings.Fields(p.Subject), " ")
+	if p.Title == "" {
+		return ErrProposalTitle
+	}
+	if p.WorkType != "course" && p.WorkType != "diploma" {
+		return ErrProposalWorkType
+	}
+	return nil
+}
+
+// ProposeTopic - студент предлагает свою тему выбранному руководителю. Тема создаётся
+// черновиком текущего периода и сразу уходит на рассмотрение
+func ProposeTopic(student models.User, p TopicProposal, actor Actor) (models.Topic, error) {
+	var topic models.Topic
+	if err := p.normalize(); err != nil {
+		return topic, err
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var term models.Term
+		if err := tx.Where("active = ?", true).First(&term).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNoActiveTerm
+			}
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.TopicMember{}).Where("term_id = ? AND student_id = ?", term.ID, student.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrProposalHasTopic
+		}
+		if err := tx.Model(&models.Topic{}).
+			Where("term_id = ? AND proposed_by_id = ? AND status IN ?", term.ID, student.ID, []string{models.TopicDraft, models.TopicProposed}).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrProposalPending
+		}
+
+		var supervisor models.Supervisor
+		if err := tx.First(&supervisor, p.SupervisorID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrProposalSupervisor
+			}
+			return err
+		}
+
+		topic = models.Topic{
+			Title:          p.Title,
+			Subject:        p.Subject,
+			WorkType:       p.WorkType,
+			CommissionName: supervisor.CommissionName,
+			CommissionID:   supervisor.CommissionID,
+			SupervisorName: supervisor.Name,
+			SupervisorID:   &supervisor.ID,
+			Status:         models.TopicDraft,
+			TermID:         &term.ID,
+			Capacity:       1,
+			Group:          student.Group,
+			ProposedByID:   &student.ID,
+		}
+		if err := tx.Create(&topic).Error; err != nil {
+			return err
+		}
+		return moveTopic(tx, &topic, models.TopicProposed, actor, "")
+	})
+	return topic, err
+}
+
+// StudentProposals - темы, которые студент предложил в текущем периоде, новые сверху
+func StudentProposals(studentID uint) ([]models.Topic, error) {
+	var topics []models.Topic
+	err := db.Preload("Transitions", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("topic_transitions.id DESC")
+	}).Scopes(ActiveTermTopics).Where("proposed_by_id = ?", studentID).Order("id DESC").Find(&topics).Error
+	return topics, err
+}
+
+// reviewedBy - условие выборки предложений, которые рассматривает руководитель:
+// свои и предложения руководителям ПЦК, где он председатель
+func reviewedBy(supervisorID uint) func(tx *gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("topics.supervisor_id = ? OR topics.commission_id IN (SELECT id FROM commissions WHERE head_id = ?)",
+			supervisorID, supervisorID)
+	}
+}
+
+// ProposalsForReview - предложения студентов, ждущие решения руководителя, старые сверху
+func ProposalsForReview(s models.Supervisor) ([]models.Topic, error) {
+	var topics []models.Topic
+	err := db.Preload("ProposedBy").Scopes(ActiveTermTopics, reviewedBy(s.ID)).
+		Where("topics.status = ? AND topics.proposed_by_id IS NOT NULL", models.TopicProposed).
+		Order("topics.id").Find(&topics).Error
+	return topics, err
+}
+
+// reviewerProposal - предложение текущего периода, которое может рассмотреть руководитель
+func reviewerProposal(tx *gorm.DB, s models.Supervisor, topicID uint) (models.Topic, error) {
+	var topic models.Topic
+	if err := tx.Preload("ProposedBy").Scopes(ActiveTermTopics).First(&topic, topicID).Error; err != nil {
+		return topic, err
+	}
+	var count int64
+	if err := tx.Model(&models.Topic{}).Scopes(reviewedBy(s.ID)).Where("topics.id = ?", topic.ID).Count(&count).Error; err != nil {
+		return topic, err
+	}
+	if count == 0 {
+		return topic, ErrNotReviewer
+	}
+	if topic.Status != models.TopicProposed || topic.ProposedBy == nil {
+		return topic, ErrNotProposal
+	}
+	return topic, nil
+}
+
+// ApproveProposal - рецензент утверждает предложение, при необходимости поправив название,
+// предмет и вид работы. Тема открывается и назначается автору; если утверждает сам руководитель
+// темы, студент сразу считается принятым. Возвращает тему до и после утверждения
+func ApproveProposal(s models.Supervisor, topicID uint, edit TopicProposal, actor Actor) (models.Topic, models.Topic, error) {
+	var before, topic models.Topic
+	if err := edit.normalize(); err != nil {
+		return before, topic, err
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if before, err = reviewerProposal(tx, s, topicID); err != nil {
+			return err
+		}
+		topic = before
+		topic.Title, topic.Subject, topic.WorkType = edit.Title, edit.Subject, edit.WorkType
+		if err := tx.Model(&models.Topic{}).Where("id = ?", topic.ID).Updates(map[string]interface{}{
+			"title": topic.Title, "subject": topic.Subject, "work_type": topic.WorkType,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := moveTopic(tx, &topic, models.TopicApproved, actor, "Предложение студента утверждено"); err != nil {
+			return err
+		}
+		if err := moveTopic(tx, &topic, models.TopicOpen, actor, ""); err != nil {
+			return err
+		}
+		if err := assignTopic(tx, topic.ID, topic.ProposedBy.ID, actor); err != nil {
+			return err
+		}
+		if topic.SupervisorID != nil && *topic.SupervisorID == s.ID {
+			var member models.TopicMember
+			if err := tx.Where("topic_id = ? AND student_id = ?", topic.ID, topic.ProposedBy.ID).First(&member).Error; err != nil {
+				return err
+			}
+			if err := acceptMember(tx, s, &member); err != nil {
+				return err
+			}
+		}
+		return tx.First(&topic, topic.ID).Error
+	})
+	if err != nil {
+		return before, topic, err
+	}
+
+	notifyStudent(*before.ProposedBy, "Тема утверждена", fmt.Sprintf(
+		"Здравствуйте, %s!\n\nПредложенная вами тема утверждена и назначена вам: «%s».\nРуководитель: %s\n%s",
+		before.ProposedBy.Name, topic.Title, topic.SupervisorLabel(), siteLink("Личный кабинет", "/student")))
+	return before, topic, nil
+}
+
+// RejectProposal - рецензент отклоняет предложение с указанием причины, тема уходит в архив
+func RejectProposal(s models.Supervisor, topicID uint, reason string, actor Actor) (models.Topic, error) {
+	var topic models.Topic
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return topic, ErrProposalReason
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if topic, err = reviewerProposal(tx, s, topicID); err != nil {
+			return err
+		}
+		return moveTopic(tx, &topic, models.TopicArchived, actor, reason)
+	})
+	if err != nil {
+		return topic, err
+	}
+
+	notifyStudent(*topic.ProposedBy, "Тема отклонена", fmt.Sprintf(
+		"Здравствуйте, %s!\n\nПредложенная вами тема «%s» отклонена.\nПричина: %s\n\nМожно предложить другую тему в личном кабинете.\n%s",
+		topic.ProposedBy.Name, topic.Title, reason, siteLink("Личный кабинет", "/student")))
+	return topic, nil
+}
+
+// notifyStudent - письмо студенту о решении; ошибка отправки не отменяет само решение
+func notifyStudent(student models.User, subject, body string) {
+	if err := GetMailer().Send(student.Email, subject, body); err != nil {
+		log.Printf("Ошибка отправки уведомления %s: %v", student.Email, err)
+	}
+}
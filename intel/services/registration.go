@@ -0,0 +1,321 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"proj/intel/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCodeRequired     = errors.New("регистрация возможна только по коду приглашения")
+	ErrCodeInvalid      = errors.New("код приглашения недействителен")
+	ErrDomainNotAllowed = errors.New("регистрация с этого почтового домена не разрешена")
+	ErrEmailTaken       = errors.New("пользователь с таким email уже зарегистрирован")
+	ErrNotPending       = errors.New("учётная запись не ожидает одобрения")
+	ErrGroupMissing     = errors.New("студент ещё не выбрал группу")
+	ErrGroupChosen      = errors.New("группа уже указана")
+)
+
+// codeAlphabet - без похожих символов (0/O, 1/I), чтобы код легко продиктовать
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Registration - данные формы регистрации
+type Registration struct {
+	Name     string
+	Group    string
+	Email    string
+	Password string
+	Code     string
+}
+
+// GetRegistrationSettings - текущие правила регистрации (по умолчанию всё открыто)
+func GetRegistrationSettings() models.RegistrationSettings {
+	settings := models.RegistrationSettings{ID: 1}
+	db.FirstOrInit(&settings, 1)
+	return settings
+}
+
+// SaveRegistrationSettings - сохраняет правила; домены приводятся к виду "a.ru,b.ru"
+func SaveRegistrationSettings(settings models.RegistrationSettings) error {
+	settings.ID = 1
+	settings.AllowedDomains = strings.Join(parseDomains(settings.AllowedDomains), ",")
+	return db.Save(&settings).Error
+}
+
+func parseDomains(list string) []string {
+	var domains []string
+	for _, d := range strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\n' || r == '\r'
+	}) {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))
+		if d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// EmailDomainAllowed - разрешён ли домен адреса. Пустой список разрешает всё
+func EmailDomainAllowed(settings models.RegistrationSettings, email string) bool {
+	domains := parseDomains(settings.AllowedDomains)
+	if len(domains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, d := range domains {
+		if domain == d {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterStudent - проверяет правила регистрации и создаёт студента.
+// Если указан код приглашения, группа берётся из кода
+func RegisterStudent(reg Registration) (*models.User, error) {
+	settings := GetRegistrationSettings()
+	reg.Email = strings.TrimSpace(reg.Email)
+	reg.Code = strings.ToUpper(strings.TrimSpace(reg.Code))
+
+	if !EmailDomainAllowed(settings, reg.Email) {
+		return nil, ErrDomainNotAllowed
+	}
+	if settings.RequireCode && reg.Code == "" {
+		return nil, ErrCodeRequired
+	}
+	if len([]rune(reg.Password)) < minPasswordLength {
+		return nil, ErrPasswordTooShort
+	}
+
+	// Без кода группа должна быть в справочнике; с кодом она берётся из кода
+	group := ""
+	if reg.Code == "" {
+		var err error
+		if group, err = CanonicalGroup(reg.Group); err != nil {
+			return nil, err
+		}
+	}
+
+	hash, err := HashPassword(reg.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Name:     strings.TrimSpace(reg.Name),
+		Group:    group,
+		Email:    reg.Email,
+		Password: hash,
+		Role:     "student",
+		Pending:  settings.RequireApproval,
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		tx.Model(&models.User{}).Where("email = ?", user.Email).Count(&count)
+		if count > 0 {
+			return ErrEmailTaken
+		}
+
+		if reg.Code != "" {
+			var code models.EnrollmentCode
+			if err := tx.Where("code = ?", reg.Code).First(&code).Error; err != nil || !code.Usable(time.Now()) {
+				return ErrCodeInvalid
+			}
+			// Условие на uses защищает от одновременного использования последнего места
+			res := tx.Model(&models.EnrollmentCode{}).
+				Where("id = ? AND (max_uses = 0 OR uses < max_uses)", code.ID).
+				Update("uses", gorm.Expr("uses + 1"))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return ErrCodeInvalid
+			}
+			user.Group = code.Group
+		}
+
+		return tx.Create(user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Pending {
+		log.Printf("Новая учётная запись %s (%s) ожидает одобрения", user.Email, user.Group)
+	}
+	return user, nil
+}
+
+// ChooseGroup - студент без группы (созданный через провайдера входа) выбирает её сам.
+// Группа проверяется по справочнику; если одобрение не требуется, кабинет сразу открывается
+func ChooseGroup(user *models.User, name string) error {
+	if user.Role != "student" || user.Group != "" {
+		return ErrGroupChosen
+	}
+	group, err := CanonicalGroup(name)
+	if err != nil {
+		return err
+	}
+	pending := GetRegistrationSettings().RequireApproval
+	res := db.Model(&models.User{}).Where("id = ? AND `group` = ''", user.ID).
+		Updates(map[string]interface{}{"group": group, "pending": pending})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrGroupChosen
+	}
+	InvalidateUserAuth(user.ID)
+	user.Group, user.Pending = group, pending
+
+	if pending {
+		log.Printf("Учётная запись %s (%s) ожидает одобрения", user.Email, user.Group)
+	}
+	return nil
+}
+
+// CreateEnrollmentCode - выпускает код приглашения в группу
+func CreateEnrollmentCode(group string, maxUses int, ttl time.Duration, createdBy uint) (*models.EnrollmentCode, error) {
+	group = strings.TrimSpace(group)
+	if group == "" {
+		return nil, errors.New("не указана группа")
+	}
+	group, err := CanonicalGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	if maxUses < 0 {
+		return nil, errors.New("неверное число использований")
+	}
+
+	value, err := randomCode(10)
+	if err != nil {
+		return nil, err
+	}
+	code := &models.EnrollmentCode{
+		Code:      value,
+		Group:     group,
+		MaxUses:   maxUses,
+		CreatedBy: createdBy,
+	}
+	if ttl > 0 {
+		expires := time.Now().Add(ttl)
+		code.ExpiresAt = &expires
+	}
+	if err := db.Create(code).Error; err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// ListEnrollmentCodes - все коды, новые сверху
+func ListEnrollmentCodes() ([]models.EnrollmentCode, error) {
+	var codes []models.EnrollmentCode
+	err := db.Order("created_at DESC").Find(&codes).Error
+	return codes, err
+}
+
+// RevokeEnrollmentCode - код больше не принимается
+func RevokeEnrollmentCode(id uint) error {
+	return db.Model(&models.EnrollmentCode{}).Where("id = ?", id).Update("revoked", true).Error
+}
+
+// pendingFor - условие выборки заявок на регистрацию, которые рассматривает пользователь:
+// администратор - все, куратор - своих групп
+func pendingFor(reviewer models.User) func(tx *gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		switch reviewer.Role {
+		case "admin":
+			return tx
+		case "curator":
+			return tx.Where("users.`group` IN (SELECT `group` FROM groupfromcurs WHERE curator_id = ? AND deleted_at IS NULL)", reviewer.ID)
+		}
+		return tx.Where("1 = 0")
+	}
+}
+
+// ListPendingUsers - очередь на одобрение, доступная пользователю, старые заявки сверху
+func ListPendingUsers(reviewer models.User) ([]models.User, error) {
+	var users []models.User
+	err := db.Scopes(pendingFor(reviewer)).Where("pending = ?", true).Order("created_at").Find(&users).Error
+	return users, err
+}
+
+// pendingUser - заявка на регистрацию, если её рассматривает этот пользователь
+func pendingUser(reviewer models.User, userID uint) (*models.User, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	var count int64
+	if err := db.Model(&models.User{}).Scopes(pendingFor(reviewer)).Where("users.id = ?", user.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrOutsideScope
+	}
+	if !user.Pending {
+		return nil, ErrNotPending
+	}
+	return &user, nil
+}
+
+// ApproveUser - открывает доступ к личному кабинету
+func ApproveUser(reviewer models.User, userID uint) (*models.User, error) {
+	user, err := pendingUser(reviewer, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == "student" && user.Group == "" {
+		return nil, ErrGroupMissing
+	}
+	if err := db.Model(user).Update("pending", false).Error; err != nil {
+		return nil, err
+	}
+	InvalidateUserAuth(user.ID)
+
+	body := fmt.Sprintf("Здравствуйте, %s!\n\nВаша учётная запись одобрена.\n%s", user.Name, siteLink("Войти", "/login/"))
+	if err := GetMailer().Send(user.Email, "Учётная запись одобрена", body); err != nil {
+		log.Printf("Ошибка отправки уведомления %s: %v", user.Email, err)
+	}
+	return user, nil
+}
+
+// RejectUser - отклоняет заявку: учётная запись удаляется, сессии завершаются
+func RejectUser(reviewer models.User, userID uint) (*models.User, error) {
+	user, err := pendingUser(reviewer, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := RevokeUserSessions(user.ID); err != nil {
+		return nil, err
+	}
+	// Удаляем полностью, чтобы с этим адресом можно было зарегистрироваться снова
+	if err := db.Unscoped().Delete(user).Error; err != nil {
+		return nil, err
+	}
+	InvalidateUserAuth(user.ID)
+	return user, nil
+}
+
+func randomCode(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+	"proj/intel/models"
+	"testing"
+)
+
+// Куратор видит и рассматривает только заявки студентов своих групп
+func TestPendingUsersScopedToCurator(t *testing.T) {
+	useTestDB(t)
+	curator := models.User{Name: "Куратор", Email: "cur@college.test", Password: "-", Role: "curator"}
+	if err := db.Create(&curator).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Groupfromcur{Code: "ИС-202", CuratorID: &curator.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Groupfromcur{Code: "ПИ-31"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	own := &models.User{Name: "Свой", Email: "own@college.test", Password: "-", Role: "student", Group: "ИС-202", Pending: true}
+	other := &models.User{Name: "Чужой", Email: "other@college.test", Password: "-", Role: "student", Group: "ПИ-31", Pending: true}
+	noGroup := &models.User{Name: "Без группы", Email: "new@college.test", Password: "-", Role: "student", Pending: true}
+	for _, u := range []*models.User{own, other, noGroup} {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := ListPendingUsers(curator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != own.ID {
+		t.Fatalf("куратору видны чужие заявки: %v", list)
+	}
+	if list, _ := ListPendingUsers(models.User{Role: "admin"}); len(list) != 3 {
+		t.Fatalf("администратору видно %d заявок из 3", len(list))
+	}
+	if list, _ := ListPendingUsers(models.User{Role: "headman", HeadmanGroup: "ИС-202"}); len(list) != 0 {
+		t.Fatalf("старосте видны заявки: %v", list)
+	}
+
+	for _, u := range []*models.User{other, noGroup} {
+		if _, err := ApproveUser(curator, u.ID); !errors.Is(err, ErrOutsideScope) {
+			t.Errorf("куратор одобрил заявку %s: %v", u.Email, err)
+		}
+		if _, err := RejectUser(curator, u.ID); !errors.Is(err, ErrOutsideScope) {
+			t.Errorf("куратор отклонил заявку %s: %v", u.Email, err)
+		}
+	}
+	if _, err := ApproveUser(curator, own.ID); err != nil {
+		t.Fatalf("куратор не одобрил заявку своей группы: %v", err)
+	}
+	if _, err := RejectUser(models.User{Role: "admin"}, other.ID); err != nil {
+		t.Fatalf("администратор не отклонил заявку: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"proj/intel/models"
+	"time"
+)
+
+const (
+	// SessionTTL - время жизни сессии без активности
+	SessionTTL = 24 * time.Hour
+	// sessionTouchInterval - как часто обновлять LastSeenAt, чтобы не писать в БД на каждый запрос
+	sessionTouchInterval = time.Minute
+)
+
+var ErrSessionInvalid = errors.New("сессия недействительна")
+
+// CreateSession - создаёт серверную сессию для пользователя
+func CreateSession(userID uint, userAgent, ip string) (*models.Session, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		ID:         id,
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		CSRFToken:  csrf,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(SessionTTL),
+	}
+	if err := db.Create(session).Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetActiveSession - возвращает сессию, если она не отозвана и не истекла
+func GetActiveSession(id string) (*models.Session, error) {
+	if id == "" {
+		return nil, ErrSessionInvalid
+	}
+	var session models.Session
+	if err := db.First(&session, "id = ?", id).Error; err != nil {
+		return nil, ErrSessionInvalid
+	}
+	if !session.Active() {
+		return nil, ErrSessionInvalid
+	}
+	return &session, nil
+}
+
+// EnsureCSRFToken - выдаёт CSRF-токен сессиям, созданным до его появления
+func EnsureCSRFToken(session *models.Session) error {
+	if session.CSRFToken != "" {
+		return nil
+	}
+	token, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	session.CSRFToken = token
+	return db.Model(session).Update("csrf_token", token).Error
+}
+
+// TouchSession - продлевает сессию (скользящее окно) и запоминает последний IP.
+// Возвращает true, если сессия была продлена
+func TouchSession(session *models.Session, ip string) (bool, error) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval && session.IP == ip {
+		return false, nil
+	}
+	session.LastSeenAt = now
+	// Просмотр от имени пользователя не продлевается - у него жёсткий срок
+	if !session.Impersonated() {
+		session.ExpiresAt = now.Add(SessionTTL)
+	}
+	session.IP = ip
+	err := db.Model(session).Updates(map[string]interface{}{
+		"last_seen_at": session.LastSeenAt,
+		"expires_at":   session.ExpiresAt,
+		"ip":           session.IP,
+	}).Error
+	return err == nil, err
+}
+
+// RevokeSession - отзывает одну сессию
+func RevokeSession(id string) error {
+	return db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserSessions - отзывает все сессии пользователя ("выйти везде")
+func RevokeUserSessions(userID uint) error {
+	return db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// ListActiveSessions - активные сессии пользователя, последние сверху
+func ListActiveSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
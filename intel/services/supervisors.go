@@ -0,0 +1,359 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"proj/intel/models"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSupervisorName      = errors.New("не указано ФИО руководителя")
+	ErrNoSupervisorProfile = errors.New("учётная запись не связана со справочником руководителей")
+	ErrNotOwnTopic         = errors.New("тема закреплена за другим руководителем")
+	ErrNoStudent           = errors.New("студент не назначен на эту тему")
+	ErrSupervisorFull      = errors.New("достигнута предельная нагрузка руководителя")
+)
+
+// SupervisorWorkload - темы руководителя и его нагрузка
+type SupervisorWorkload struct {
+	Supervisor models.Supervisor
+	Topics     []models.Topic // с подгруженными студентами
+	Assigned   int            // назначено студентов
+	Accepted   int            // из них принято руководителем
+	FreeTopics int            // тем со свободными местами
+	FreeSlots  int            // сколько ещё студентов можно принять, -1 - без ограничения
+}
+
+// ListSupervisors - справочник руководителей по алфавиту
+func ListSupervisors() ([]models.Supervisor, error) {
+	var list []models.Supervisor
+	err := db.Order("name").Find(&list).Error
+	return list, err
+}
+
+// SaveSupervisor - добавляет руководителя или обновляет существующего.
+// Существующий ищется по email, а без email - по ФИО с точностью до регистра и пробелов
+func SaveSupervisor(s models.Supervisor) (created bool, err error) {
+	s.Name = strings.Join(strings.Fields(s.Name), " ")
+	s.Email = strings.ToLower(strings.TrimSpace(s.Email))
+	s.CommissionName = strings.TrimSpace(s.CommissionName)
+	if s.Name == "" {
+		return false, ErrSupervisorName
+	}
+
+	var existing models.Supervisor
+	found := false
+	if s.Email != "" {
+		found = db.Where("email = ?", s.Email).First(&existing).Error == nil
+	}
+	if !found {
+		// Запись с другим email - другой человек, даже если ФИО совпадает
+		query := db.Model(&models.Supervisor{})
+		if s.Email != "" {
+			query = query.Where("email = ''")
+		}
+		var list []models.Supervisor
+		if err := query.Find(&list).Error; err != nil {
+			return false, err
+		}
+		key := strings.Join(nameTokens(s.Name), " ")
+		for _, e := range list {
+			if strings.Join(nameTokens(e.Name), " ") == key {
+				existing, found = e, true
+				break
+			}
+		}
+	}
+
+	if !found {
+		return true, db.Create(&s).Error
+	}
+	existing.Name = s.Name
+	existing.Email = s.Email
+	existing.CommissionName = s.CommissionName
+	existing.CommissionID = s.CommissionID
+	existing.MaxStudents = s.MaxStudents
+	return false, db.Save(&existing).Error
+}
+
+// SupervisorForUser - запись справочника для учётной записи руководителя.
+// При первом входе запись находится по email и связывается с учётной записью
+func SupervisorForUser(user models.User) (*models.Supervisor, error) {
+	var s models.Supervisor
+	err := db.Where("user_id = ?", user.ID).First(&s).Error
+	if err == nil {
+		return &s, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	err = db.Where("email = ? AND user_id IS NULL", strings.ToLower(user.Email)).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoSupervisorProfile
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.UserID = &user.ID
+	if err := db.Model(&s).Update("user_id", user.ID).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("Руководитель %s связан с учётной записью %s", s.Name, user.Email)
+	return &s, nil
+}
+
+// GetSupervisorWorkload - темы руководителя со студентами и свободные места
+func GetSupervisorWorkload(s models.Supervisor) (SupervisorWorkload, error) {
+	result := SupervisorWorkload{Supervisor: s, FreeSlots: -1}
+
+	if err := db.Scopes(ActiveTermTopics, ApprovedTopics, WithMembers).Where("supervisor_id = ?", s.ID).Order("title").Find(&result.Topics).Error; err != nil {
+		return result, err
+	}
+	for _, t := range result.Topics {
+		result.Assigned += len(t.Members)
+		for _, m := range t.Members {
+			if m.AcceptedAt != nil {
+				result.Accepted++
+			}
+		}
+		if t.Places() > 0 {
+			result.FreeTopics++
+		}
+	}
+	if s.MaxStudents > 0 {
+		result.FreeSlots = max(s.MaxStudents-result.Accepted, 0)
+	}
+	return result, nil
+}
+
+// supervisorTopic - тема текущего периода, которая принадлежит руководителю
+func supervisorTopic(tx *gorm.DB, supervisorID, topicID uint) (models.Topic, error) {
+	var topic models.Topic
+	if err := tx.Scopes(ActiveTermTopics).First(&topic, topicID).Error; err != nil {
+		return topic, err
+	}
+	if topic.SupervisorID == nil || *topic.SupervisorID != supervisorID {
+		return topic, ErrNotOwnTopic
+	}
+	return topic, nil
+}
+
+// supervisorMember - назначение студента на тему руководителя, с темой и студентом
+func supervisorMember(tx *gorm.DB, supervisorID, topicID, studentID uint) (models.TopicMember, error) {
+	var member models.TopicMember
+	topic, err := supervisorTopic(tx, supervisorID, topicID)
+	if err != nil {
+		return member, err
+	}
+	err = tx.Preload("Student").Where("topic_id = ? AND student_id = ?", topic.ID, studentID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && member.Student == nil) {
+		return member, ErrNoStudent
+	}
+	member.Topic = &topic
+	return member, err
+}
+
+// AcceptStudent - руководитель подтверждает студента, назначенного на его тему.
+// Принятые студенты учитываются в предельной нагрузке
+func AcceptStudent(s models.Supervisor, topicID, studentID uint) (models.TopicMember, error) {
+	var member models.TopicMember
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if member, err = supervisorMember(tx, s.ID, topicID, studentID); err != nil {
+			return err
+		}
+		return acceptMember(tx, s, &member)
+	})
+	return member, err
+}
+
+// acceptMember - отмечает студента принятым, если руководитель не превысит предельную нагрузку
+func acceptMember(tx *gorm.DB, s models.Supervisor, member *models.TopicMember) error {
+	if member.AcceptedAt != nil {
+		return nil
+	}
+	if s.MaxStudents > 0 {
+		var accepted int64
+		if err := tx.Model(&models.TopicMember{}).Scopes(ActiveTermMembers).
+			Where("accepted_at IS NOT NULL AND topic_id IN (SELECT id FROM topics WHERE supervisor_id = ?)", s.ID).
+			Count(&accepted).Error; err != nil {
+			return err
+		}
+		if int(accepted) >= s.MaxStudents {
+			return ErrSupervisorFull
+		}
+	}
+	now := time.Now()
+	member.AcceptedAt = &now
+	return tx.Model(&models.TopicMember{}).Where("id = ?", member.ID).Update("accepted_at", now).Error
+}
+
+// DeclineStudent - руководитель отказывает студенту: место на теме освобождается.
+// Возвращает назначение в состоянии до отказа
+func DeclineStudent(s models.Supervisor, topicID, studentID uint, actor Actor) (models.TopicMember, error) {
+	member, err := supervisorMember(db, s.ID, topicID, studentID)
+	if err != nil {
+		return member, err
+	}
+	return member, ReleaseTopic(member.TopicID, member.StudentID, actor)
+}
+
+// UpdateTopicDescription - руководитель меняет описание своей темы
+func UpdateTopicDescription(s models.Supervisor, topicID uint, description string) (models.Topic, error) {
+	topic, err := supervisorTopic(db, s.ID, topicID)
+	if err != nil {
+		return topic, err
+	}
+	description = strings.TrimSpace(description)
+	if err := db.Model(&models.Topic{}).Where("id = ?", topic.ID).Update("description", description).Error; err != nil {
+		return topic, err
+	}
+	return topic, nil
+}
+
+// FindSupervisor - ищет руководителя по ФИО так же, как при привязке тем; nil - не найден
+func FindSupervisor(name string) (*models.Supervisor, error) {
+	list, err := ListSupervisors()
+	if err != nil {
+		return nil, err
+	}
+	s, _ := MatchSupervisor(name, list)
+	return s, nil
+}
+
+// LinkTopicSupervisors - привязывает темы без руководителя из справочника по тексту,
+// указанному при импорте. Неоднозначные и ненайденные имена остаются без привязки
+func LinkTopicSupervisors() (linked, unresolved int, err error) {
+	list, err := ListSupervisors()
+	if err != nil || len(list) == 0 {
+		return 0, 0, err
+	}
+
+	var topics []models.Topic
+	if err := db.Where("supervisor_id IS NULL AND supervisor <> ''").Find(&topics).Error; err != nil {
+		return 0, 0, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, t := range topics {
+			s, ambiguous := MatchSupervisor(t.SupervisorName, list)
+			if s == nil {
+				if ambiguous {
+					log.Printf("Руководитель «%s» темы %d подходит под несколько записей справочника", t.SupervisorName, t.ID)
+				}
+				unresolved++
+				continue
+			}
+			if err := tx.Model(&models.Topic{}).Where("id = ?", t.ID).Update("supervisor_id", s.ID).Error; err != nil {
+				return err
+			}
+			linked++
+		}
+		return nil
+	})
+	return linked, unresolved, err
+}
+
+// MatchSupervisor - нечёткое сопоставление ФИО из темы со справочником.
+// Проверки идут от строгой к мягкой, на каждой нужен ровно один кандидат:
+//  1. ФИО совпадает без учёта регистра, «ё» и знаков препинания;
+//  2. совпадает фамилия, инициалы не противоречат («Иванов И.И.» = «Иванов Иван Иванович»);
+//  3. фамилия отличается не больше чем на одну букву, инициалы не противоречат.
+//
+// ambiguous = true, если на первой сработавшей проверке кандидатов несколько
+func MatchSupervisor(raw string, list []models.Supervisor) (match *models.Supervisor, ambiguous bool) {
+	tokens := nameTokens(raw)
+	if len(tokens) == 0 {
+		return nil, false
+	}
+	surname, initials := splitName(tokens)
+	full := strings.Join(tokens, " ")
+
+	stages := []func(models.Supervisor) bool{
+		func(s models.Supervisor) bool {
+			return strings.Join(nameTokens(s.Name), " ") == full
+		},
+		func(s models.Supervisor) bool {
+			sn, si := splitName(nameTokens(s.Name))
+			return sn == surname && initialsMatch(initials, si)
+		},
+		func(s models.Supervisor) bool {
+			sn, si := splitName(nameTokens(s.Name))
+			return utf8.RuneCountInString(surname) > 3 && levenshtein(sn, surname) <= 1 && initialsMatch(initials, si)
+		},
+	}
+
+	for _, matches := range stages {
+		var found []int
+		for i := range list {
+			if matches(list[i]) {
+				found = append(found, i)
+			}
+		}
+		switch {
+		case len(found) == 1:
+			return &list[found[0]], false
+		case len(found) > 1:
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// nameTokens - ФИО в нижнем регистре, без знаков препинания, «ё» заменена на «е»
+func nameTokens(name string) []string {
+	name = strings.ReplaceAll(strings.ToLower(name), "ё", "е")
+	return strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '-'
+	})
+}
+
+// splitName - фамилия и инициалы. Понимает и «И.И. Иванов», и «Иванов И.И.»
+func splitName(tokens []string) (surname, initials string) {
+	if len(tokens) == 0 {
+		return "", ""
+	}
+	last := len(tokens) - 1
+	if utf8.RuneCountInString(tokens[0]) == 1 && utf8.RuneCountInString(tokens[last]) > 1 {
+		tokens = append([]string{tokens[last]}, tokens[:last]...)
+	}
+	var b strings.Builder
+	for _, t := range tokens[1:] {
+		r, _ := utf8.DecodeRuneInString(t)
+		b.WriteRune(r)
+	}
+	return tokens[0], b.String()
+}
+
+// initialsMatch - инициалы не противоречат друг другу: одни являются началом других
+func initialsMatch(a, b string) bool {
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
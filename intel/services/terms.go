@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"proj/intel/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoActiveTerm = errors.New("не задан текущий учебный период")
+	ErrTermExists   = errors.New("такой учебный период уже есть")
+	ErrTermOrder    = errors.New("новый период должен идти после текущего")
+	ErrTermInvalid  = errors.New("неверный учебный год или семестр")
+)
+
+// ActiveTermTopics - условие выборки тем текущего учебного периода
+func ActiveTermTopics(tx *gorm.DB) *gorm.DB {
+	return tx.Where("topics.term_id = (SELECT id FROM terms WHERE active = ? LIMIT 1)", true)
+}
+
+// termForDate - семестр, который идёт в указанный день: с сентября по январь осенний
+func termForDate(t time.Time) models.Term {
+	switch {
+	case t.Month() >= time.September:
+		return models.Term{Year: t.Year(), Semester: 1}
+	case t.Month() == time.January:
+		return models.Term{Year: t.Year() - 1, Semester: 1}
+	default:
+		return models.Term{Year: t.Year() - 1, Semester: 2}
+	}
+}
+
+// ActiveTerm - текущий учебный период
+func ActiveTerm() (models.Term, error) {
+	var term models.Term
+	err := db.Where("active = ?", true).First(&term).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return term, ErrNoActiveTerm
+	}
+	return term, err
+}
+
+// ListTerms - все периоды, новые сверху
+func ListTerms() ([]models.Term, error) {
+	var terms []models.Term
+	err := db.Order("year DESC, semester DESC").Find(&terms).Error
+	return terms, err
+}
+
+// TermStats - темы периода: всего, со студентами, без студентов
+type TermStats struct {
+	Term     models.Term
+	Topics   int64
+	Assigned int64
+}
+
+// Free - тем периода без единого студента
+func (s TermStats) Free() int64 {
+	return s.Topics - s.Assigned
+}
+
+// ListTermStats - периоды с числом тем и назначений
+func ListTermStats() ([]TermStats, error) {
+	terms, err := ListTerms()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]TermStats, 0, len(terms))
+	for _, t := range terms {
+		item := TermStats{Term: t}
+		if err := db.Model(&models.Topic{}).Where("term_id = ?", t.ID).Count(&item.Topics).Error; err != nil {
+			return nil, err
+		}
+		if err := db.Model(&models.Topic{}).Where("term_id = ? AND id IN (SELECT topic_id FROM topic_members)", t.ID).Count(&item.Assigned).Error; err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// ensureActiveTerm - при первом запуске заводит период по текущей дате,
+// темы без периода относит к активному
+func ensureActiveTerm() error {
+	term, err := ActiveTerm()
+	if errors.Is(err, ErrNoActiveTerm) {
+		term = termForDate(time.Now())
+		term.Active = true
+		if err = db.Create(&term).Error; err != nil {
+			return err
+		}
+		log.Printf("Создан учебный период %s", term.Name())
+	}
+	if err != nil {
+		return err
+	}
+
+	res := db.Model(&models.Topic{}).Where("term_id IS NULL").Update("term_id", term.ID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("Миграция: тем отнесено к периоду %s: %d", term.Name(), res.RowsAffected)
+	}
+	return nil
+}
+
+// RolloverResult - итог перехода на новый период
+type RolloverResult struct {
+	Archived models.Term
+	Active   models.Term
+	Carried  int64 // тем без студентов перенесено в новый период
+	Closed   int   // тем старого периода отправлено в архив
+}
+
+// RolloverTerm - завершает текущий период и открывает следующий. Старый период
+// уходит в архив вместе с темами и назначениями; темы без студентов по запросу
+// переносятся в новый период в прежнем состоянии
+func RolloverTerm(next models.Term, carryFree bool, actor Actor) (RolloverResult, error) {
+	var result RolloverResult
+	if next.Year < 2000 || next.Year > 2100 || (next.Semester != 1 && next.Semester != 2) {
+		return result, ErrTermInvalid
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var current models.Term
+		if err := tx.Where("active = ?", true).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNoActiveTerm
+			}
+			return err
+		}
+		if !current.Before(next) {
+			return ErrTermOrder
+		}
+		var exists int64
+		if err := tx.Model(&models.Term{}).Where("year = ? AND semester = ?", next.Year, next.Semester).Count(&exists).Error; err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrTermExists
+		}
+
+		now := time.Now()
+		if err := tx.Model(&current).Updates(map[string]interface{}{"active": false, "archived_at": now}).Error; err != nil {
+			return err
+		}
+		current.Active = false
+		current.ArchivedAt = &now
+
+		next.ID = 0
+		next.Active = true
+		next.ArchivedAt = nil
+		if err := tx.Create(&next).Error; err != nil {
+			return err
+		}
+
+		if carryFree {
+			res := tx.Model(&models.Topic{}).
+				Where("term_id = ? AND status <> ? AND id NOT IN (SELECT topic_id FROM topic_members)", current.ID, models.TopicArchived).
+				Update("term_id", next.ID)
+			if res.Error != nil {
+				return res.Error
+			}
+			result.Carried = res.RowsAffected
+		}
+
+		// Оставшиеся темы закрываются вместе с периодом
+		var left []models.Topic
+		if err := tx.Where("term_id = ? AND status <> ?", current.ID, models.TopicArchived).Find(&left).Error; err != nil {
+			return err
+		}
+		for i := range left {
+			if err := moveTopic(tx, &left[i], models.TopicArchived, actor, "Период "+current.Name()+" завершён"); err != nil {
+				return err
+			}
+		}
+		result.Closed = len(left)
+
+		result.Archived = current
+		result.Active = next
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"proj/intel/models"
+	"time"
+)
+
+const (
+	// loginWindow - за какой период считаем неудачные попытки
+	loginWindow = 15 * time.Minute
+	// maxAccountFailures - после стольких ошибок учётная запись блокируется на lockoutDuration
+	maxAccountFailures = 5
+	// maxIPFailures - то же для одного IP (перебор по многим email)
+	maxIPFailures   = 20
+	lockoutDuration = 15 * time.Minute
+	// backoffAfter - с какой ошибки начинается экспоненциальная задержка
+	backoffAfter = 2
+	backoffBase  = time.Second
+)
+
+var (
+	ErrLoginThrottled = errors.New("слишком много попыток входа")
+	ErrAccountLocked  = errors.New("вход временно заблокирован")
+)
+
+// ThrottleError - отказ с указанием, через сколько можно повторить
+type ThrottleError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	return fmt.Sprintf("%v, повторите через %s", e.Err, e.RetryAfter.Round(time.Second))
+}
+
+func (e *ThrottleError) Unwrap() error {
+	return e.Err
+}
+
+// failureStats - число неснятых ошибок в окне и время последней
+func failureStats(column, value string) (int64, time.Time, error) {
+	var count int64
+	since := time.Now().Add(-loginWindow)
+	q := db.Model(&models.FailedLogin{}).
+		Where(column+" = ? AND cleared = ? AND created_at > ?", value, false, since)
+	if err := q.Count(&count).Error; err != nil {
+		return 0, time.Time{}, err
+	}
+	if count == 0 {
+		return 0, time.Time{}, nil
+	}
+	var last models.FailedLogin
+	err := db.Where(column+" = ? AND cleared = ? AND created_at > ?", value, false, since).
+		Order("created_at DESC").First(&last).Error
+	return count, last.CreatedAt, err
+}
+
+// retryAfter - сколько ещё ждать при count ошибках, последняя в момент last
+func retryAfter(count int64, max int64, last time.Time) (time.Duration, error) {
+	if count >= max {
+		if wait := time.Until(last.Add(lockoutDuration)); wait > 0 {
+			return wait, ErrAccountLocked
+		}
+		return 0, nil
+	}
+	if count < backoffAfter {
+		return 0, nil
+	}
+	// 1с, 2с, 4с, ... после каждой следующей ошибки, но не дольше блокировки
+	delay := min(backoffBase<<uint(min(count-backoffAfter, 30)), lockoutDuration)
+	if wait := time.Until(last.Add(delay)); wait > 0 {
+		return wait, ErrLoginThrottled
+	}
+	return 0, nil
+}
+
+// CheckLoginAllowed - проверяет ограничения по учётной записи и по IP
+func CheckLoginAllowed(email, ip string) error {
+	checks := []struct {
+		column, value string
+		max           int64
+	}{
+		{"email", email, maxAccountFailures},
+		{"ip", ip, maxIPFailures},
+	}
+
+	for _, c := range checks {
+		if c.value == "" {
+			continue
+		}
+		count, last, err := failureStats(c.column, c.value)
+		if err != nil {
+			return err
+		}
+		wait, err := retryAfter(count, c.max, last)
+		if err != nil {
+			return &ThrottleError{Err: err, RetryAfter: wait}
+		}
+	}
+	return nil
+}
+
+// RecordLoginFailure - сохраняет неудачную попытку входа
+func RecordLoginFailure(email, ip, userAgent, reason string) error {
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	return db.Create(&models.FailedLogin{
+		Email:     email,
+		IP:        ip,
+		UserAgent: userAgent,
+		Reason:    reason,
+	}).Error
+}
+
+// ClearLoginFailures - снимает счётчик ошибок учётной записи (успешный вход или разблокировка)
+func ClearLoginFailures(email string) error {
+	return db.Model(&models.FailedLogin{}).
+		Where("email = ? AND cleared = ?", email, false).
+		Update("cleared", true).Error
+}
+
+// ListFailedLogins - журнал неудачных входов с фильтром по email и IP
+func ListFailedLogins(email, ip string, limit int) ([]models.FailedLogin, error) {
+	var attempts []models.FailedLogin
+	q := db.Order("created_at DESC").Limit(limit)
+	if email != "" {
+		q = q.Where("email = ?", email)
+	}
+	if ip != "" {
+		q = q.Where("ip = ?", ip)
+	}
+	err := q.Find(&attempts).Error
+	return attempts, err
+}
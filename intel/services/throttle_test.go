@@ -0,0 +1,47 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterCappedByLockout(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		count int64
+		want  time.Duration
+		err   error
+	}{
+		{1, 0, nil},
+		{2, time.Second, ErrLoginThrottled},
+		{5, 8 * time.Second, ErrLoginThrottled},
+		{maxIPFailures - 1, lockoutDuration, ErrLoginThrottled},
+		{maxIPFailures, lockoutDuration, ErrAccountLocked},
+	}
+	for _, c := range cases {
+		wait, err := retryAfter(c.count, maxIPFailures, now)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%d ошибок: %v, ожидалось %v", c.count, err, c.err)
+		}
+		if wait > c.want || wait < c.want-time.Second {
+			t.Errorf("%d ошибок: ждать %s, ожидалось %s", c.count, wait, c.want)
+		}
+	}
+}
+
+// Ошибки без email ограничивают только IP и не блокируют учётную запись
+func TestIPOnlyFailuresThrottleIP(t *testing.T) {
+	useTestDB(t)
+	for range maxIPFailures {
+		if err := RecordLoginFailure("", "203.0.113.7", "test", "запрос сброса пароля"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CheckLoginAllowed("", "203.0.113.7"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("IP не ограничен: %v", err)
+	}
+	if err := CheckLoginAllowed("ivanov@college.test", "198.51.100.2"); err != nil {
+		t.Fatalf("ограничен вход с другого IP: %v", err)
+	}
+}
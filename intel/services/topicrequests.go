@@ -0,0 +1,224 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"proj/intel/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRequestReason   = errors.New("укажите причину")
+	ErrRequestKind     = errors.New("неизвестный вид заявки")
+	ErrRequestNoTopic  = errors.New("тема ещё не назначена - её можно выбрать или предложить")
+	ErrRequestNewTopic = errors.New("выберите другую открытую тему")
+	ErrRequestTitle    = errors.New("укажите новое название темы")
+	ErrRequestPending  = errors.New("предыдущая заявка ещё рассматривается")
+	ErrRequestReviewed = errors.New("заявка уже рассмотрена")
+	ErrRequestStale    = errors.New("тема студента изменилась после подачи заявки")
+	ErrNotRequestOwner = errors.New("заявку рассматривает староста группы, куратор или администратор")
+)
+
+// TopicRequestInput - заявка, которую подаёт студент
+type TopicRequestInput struct {
+	Kind       string
+	NewTopicID uint
+	NewTitle   string
+	Reason     string
+}
+
+// CreateTopicRequest - студент просит другую тему или уточнение названия текущей
+func CreateTopicRequest(student models.User, in TopicRequestInput) (models.TopicChangeRequest, error) {
+	req := models.TopicChangeRequest{
+		StudentID: student.ID,
+		Kind:      in.Kind,
+		NewTitle:  strings.Join(strings.Fields(in.NewTitle), " "),
+		Reason:    strings.TrimSpace(in.Reason),
+		Status:    models.RequestPending,
+	}
+	switch {
+	case in.Kind != models.RequestChange && in.Kind != models.RequestRename:
+		return req, ErrRequestKind
+	case req.Reason == "":
+		return req, ErrRequestReason
+	case in.Kind == models.RequestRename && req.NewTitle == "":
+		return req, ErrRequestTitle
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var member models.TopicMember
+		err := tx.Preload("Topic").Scopes(ActiveTermMembers).Where("student_id = ?", student.ID).First(&member).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRequestNoTopic
+		}
+		if err != nil {
+			return err
+		}
+		req.TermID, req.TopicID = member.TermID, member.TopicID
+
+		var count int64
+		if err := tx.Model(&models.TopicChangeRequest{}).
+			Where("student_id = ? AND term_id = ? AND status = ?", student.ID, req.TermID, models.RequestPending).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRequestPending
+		}
+
+		if in.Kind == models.RequestChange {
+			var topic models.Topic
+			if err := tx.Scopes(ActiveTermTopics, FreeTopics).First(&topic, in.NewTopicID).Error; err != nil || topic.ID == req.TopicID {
+				if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+					return err
+				}
+				return ErrRequestNewTopic
+			}
+			req.NewTopicID = &topic.ID
+		} else if req.NewTitle == member.Topic.Title {
+			return ErrRequestTitle
+		}
+		return tx.Create(&req).Error
+	})
+	return req, err
+}
+
+// StudentTopicRequests - заявки студента в текущем периоде, новые сверху
+func StudentTopicRequests(studentID uint) ([]models.TopicChangeRequest, error) {
+	var list []models.TopicChangeRequest
+	err := db.Preload("Topic").Preload("NewTopic").
+		Where("student_id = ? AND term_id = (SELECT id FROM terms WHERE active = ? LIMIT 1)", studentID, true).
+		Order("id DESC").Find(&list).Error
+	return list, err
+}
+
+// requestsFor - условие выборки заявок, которые рассматривает пользователь: администратор - все,
+// куратор - своих групп, староста - своей группы, кроме собственных
+func requestsFor(reviewer models.User) func(tx *gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		switch reviewer.Role {
+		case "admin":
+			return tx
+		case "curator":
+			return tx.Where("topic_change_requests.student_id IN (SELECT id FROM users WHERE `group` IN"+
+				" (SELECT `group` FROM groupfromcurs WHERE curator_id = ? AND deleted_at IS NULL))", reviewer.ID)
+		case "headman":
+			return tx.Where("topic_change_requests.student_id <> ? AND topic_change_requests.student_id IN"+
+				" (SELECT id FROM users WHERE `group` = ? AND `group` <> '')", reviewer.ID, reviewer.HeadmanGroup)
+		}
+		return tx.Where("1 = 0")
+	}
+}
+
+// ReviewTopicRequests - заявки текущего периода, доступные пользователю: сначала ждущие решения
+func ReviewTopicRequests(reviewer models.User) ([]models.TopicChangeRequest, error) {
+	var list []models.TopicChangeRequest
+	err := db.Preload("Student").Preload("Topic").Preload("NewTopic").Scopes(requestsFor(reviewer)).
+		Where("topic_change_requests.term_id = (SELECT id FROM terms WHERE active = ? LIMIT 1)", true).
+		Order("CASE WHEN topic_change_requests.status = 'pending' THEN 0 ELSE 1 END, topic_change_requests.id DESC").
+		Find(&list).Error
+	return list, err
+}
+
+// ReviewTopicRequest - одобряет или отклоняет заявку. При одобрении смены темы студент
+// в одной транзакции освобождает прежнюю тему и получает новую; при уточнении меняется название.
+// Студенту уходит письмо с решением. Возвращает заявку с подгруженными темами и студентом
+func ReviewTopicRequest(reviewer models.User, requestID uint, approve bool, note string, actor Actor) (models.TopicChangeRequest, error) {
+	var req models.TopicChangeRequest
+	note = strings.TrimSpace(note)
+	if !approve && note == "" {
+		return req, ErrProposalReason
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Student").Preload("Topic").Preload("NewTopic").First(&req, requestID).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.TopicChangeRequest{}).Scopes(requestsFor(reviewer)).
+			Where("topic_change_requests.id = ?", req.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotRequestOwner
+		}
+		if req.Status != models.RequestPending {
+			return ErrRequestReviewed
+		}
+
+		if approve {
+			var member int64
+			if err := tx.Model(&models.TopicMember{}).
+				Where("term_id = ? AND student_id = ? AND topic_id = ?", req.TermID, req.StudentID, req.TopicID).
+				Count(&member).Error; err != nil {
+				return err
+			}
+			if member == 0 {
+				return ErrRequestStale
+			}
+			switch req.Kind {
+			case models.RequestChange:
+				if req.NewTopicID == nil {
+					return ErrRequestNewTopic
+				}
+				if err := assignTopic(tx, *req.NewTopicID, req.StudentID, actor); err != nil {
+					return err
+				}
+			case models.RequestRename:
+				if err := tx.Model(&models.Topic{}).Where("id = ?", req.TopicID).Update("title", req.NewTitle).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		now := time.Now()
+		status := models.RequestRejected
+		if approve {
+			status = models.RequestApproved
+		}
+		// Условие на состояние защищает от двух одновременных решений
+		res := tx.Model(&models.TopicChangeRequest{}).Where("id = ? AND status = ?", req.ID, models.RequestPending).
+			Updates(map[string]interface{}{
+				"status": status, "reviewer_id": reviewer.ID, "reviewer_email": actor.Email,
+				"review_note": note, "reviewed_at": now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRequestReviewed
+		}
+		req.Status, req.ReviewerID, req.ReviewerEmail, req.ReviewNote, req.ReviewedAt = status, &reviewer.ID, actor.Email, note, &now
+		return nil
+	})
+	if err != nil {
+		return req, err
+	}
+
+	notifyTopicRequest(req)
+	return req, nil
+}
+
+// notifyTopicRequest - письмо студенту о решении по заявке
+func notifyTopicRequest(req models.TopicChangeRequest) {
+	if req.Student == nil || req.Topic == nil {
+		return
+	}
+	var decision string
+	switch {
+	case req.Status == models.RequestRejected:
+		decision = fmt.Sprintf("Заявка отклонена. Ваша тема остаётся прежней: «%s».", req.Topic.Title)
+	case req.Kind == models.RequestChange && req.NewTopic != nil:
+		decision = fmt.Sprintf("Заявка одобрена. Тема «%s» освобождена, вам назначена тема «%s».", req.Topic.Title, req.NewTopic.Title)
+	default:
+		decision = fmt.Sprintf("Заявка одобрена. Название темы изменено на «%s».", req.NewTitle)
+	}
+	if req.ReviewNote != "" {
+		decision += "\nКомментарий: " + req.ReviewNote
+	}
+	body := fmt.Sprintf("Здравствуйте, %s!\n\n%s\n%s", req.Student.Name, decision, siteLink("Личный кабинет", "/student"))
+	notifyStudent(*req.Student, "Заявка по теме: "+strings.ToLower(req.KindLabel()), body)
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"proj/intel/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTopicFull     = errors.New("на теме не осталось свободных мест")
+	ErrNotAssigned   = errors.New("тема не назначена этому студенту")
+	ErrTopicArchived = errors.New("тема относится к прошедшему учебному периоду")
+	ErrNotStudent    = errors.New("тему можно назначить только студенту или старосте")
+)
+
+// ActiveTermMembers - условие выборки назначений текущего учебного периода
+func ActiveTermMembers(tx *gorm.DB) *gorm.DB {
+	return tx.Where("topic_members.term_id = (SELECT id FROM terms WHERE active = ? LIMIT 1)", true)
+}
+
+// WithCurrentTopic - подгружает пользователю участие в теме текущего периода вместе с темой
+func WithCurrentTopic(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("Membership", ActiveTermMembers).Preload("Membership.Topic")
+}
+
+// WithMembers - подгружает теме назначенных студентов
+func WithMembers(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("Members", func(tx *gorm.DB) *gorm.DB { return tx.Order("topic_members.id") }).Preload("Members.Student")
+}
+
+// StudentTopic - тема, назначенная студенту в текущем периоде; nil, если темы нет
+func StudentTopic(studentID uint) (*models.Topic, error) {
+	var topic models.Topic
+	err := db.Scopes(ActiveTermTopics).
+		Where("id IN (SELECT topic_id FROM topic_members WHERE student_id = ?)", studentID).
+		First(&topic).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &topic, nil
+}
+
+// WithoutTopic - условие выборки пользователей без темы в текущем периоде
+func WithoutTopic(tx *gorm.DB) *gorm.DB {
+	return tx.Where("users.id NOT IN (SELECT student_id FROM topic_members"+
+		" WHERE term_id = (SELECT id FROM terms WHERE active = ? LIMIT 1))", true)
+}
+
+// FreeTopics - условие выборки тем, открытых для выбора: на них остались места
+func FreeTopics(tx *gorm.DB) *gorm.DB {
+	return tx.Where("topics.status = ?", models.TopicOpen)
+}
+
+// releasable - со студентами открытой или назначенной темы ещё не начата работа
+func releasable(status string) bool {
+	return status == models.TopicOpen || status == models.TopicAssigned
+}
+
+// AssignTopic - назначает студента на открытую тему текущего периода. Прежняя тема студента
+// в этом периоде освобождается; на заполненную тему назначить нельзя - сначала нужно кого-то снять
+func AssignTopic(topicID, studentID uint, actor Actor) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return assignTopic(tx, topicID, studentID, actor)
+	})
+}
+
+func assignTopic(tx *gorm.DB, topicID, studentID uint, actor Actor) error {
+	var topic models.Topic
+	if err := tx.First(&topic, topicID).Error; err != nil {
+		return err
+	}
+	var current int64
+	if err := tx.Model(&models.Topic{}).Scopes(ActiveTermTopics).Where("id = ?", topic.ID).Count(&current).Error; err != nil {
+		return err
+	}
+	if current == 0 {
+		return ErrTopicArchived
+	}
+	var student models.User
+	if err := tx.Select("id", "role").First(&student, studentID).Error; err != nil {
+		return err
+	}
+	if student.Role != "student" && student.Role != "headman" {
+		return ErrNotStudent
+	}
+
+	var previous models.TopicMember
+	err := tx.Preload("Topic").Where("term_id = ? AND student_id = ?", *topic.TermID, studentID).First(&previous).Error
+	if err == nil && previous.TopicID == topic.ID {
+		return nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	switch {
+	case topic.Status == models.TopicAssigned:
+		return ErrTopicFull
+	case topic.Status != models.TopicOpen:
+		return fmt.Errorf("%w: «%s»", ErrTopicNotOpen, topic.StateLabel())
+	}
+
+	if err == nil {
+		if previous.Topic != nil && !releasable(previous.Topic.Status) {
+			return ErrTopicInWork
+		}
+		if err := tx.Delete(&previous).Error; err != nil {
+			return err
+		}
+		if err := syncTopicFill(tx, previous.TopicID, actor); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Create(&models.TopicMember{TopicID: topic.ID, StudentID: studentID, TermID: *topic.TermID}).Error; err != nil {
+		return err
+	}
+	// Места считаем после вставки: так одновременное назначение на последнее место не пройдёт
+	taken, err := topicMemberCount(tx, topic.ID)
+	if err != nil {
+		return err
+	}
+	if taken > topic.Capacity {
+		return ErrTopicFull
+	}
+	return syncTopicFill(tx, topic.ID, actor)
+}
+
+// ReleaseTopic - снимает студента с темы, пока по ней не началась работа;
+// назначения прошедших периодов остаются в архиве
+func ReleaseTopic(topicID, studentID uint, actor Actor) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var topic models.Topic
+		if err := tx.First(&topic, topicID).Error; err != nil {
+			return err
+		}
+		if !releasable(topic.Status) {
+			return ErrTopicInWork
+		}
+		res := tx.Scopes(ActiveTermMembers).
+			Where("topic_id = ? AND student_id = ?", topicID, studentID).
+			Delete(&models.TopicMember{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotAssigned
+		}
+		return syncTopicFill(tx, topicID, actor)
+	})
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"proj/intel/models"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+const (
+	totpIssuer        = "Дипломные работы"
+	recoveryCodeCount = 10
+	// totpReuseWindow - код нельзя использовать повторно, пока он может быть валиден
+	totpReuseWindow = 90 * time.Second
+)
+
+// TwoFactorRoles - роли, для которых доступна 2FA
+var TwoFactorRoles = []string{"admin", "curator", "supervisor", "headman"}
+
+var (
+	ErrTwoFactorNotAllowed = errors.New("двухфакторная аутентификация недоступна для этой роли")
+	ErrTwoFactorNotStarted = errors.New("подключение 2FA не начато")
+	ErrInvalidTOTPCode     = errors.New("неверный код подтверждения")
+	ErrTwoFactorRequired   = errors.New("2FA обязательна для вашей роли")
+)
+
+// RoleSupportsTwoFactor - можно ли подключить 2FA пользователю с этой ролью
+func RoleSupportsTwoFactor(role string) bool {
+	for _, r := range TwoFactorRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// TwoFactorRequired - обязательна ли 2FA для роли по политике администратора
+func TwoFactorRequired(role string) bool {
+	var policy models.TwoFactorPolicy
+	if err := db.First(&policy, "role = ?", role).Error; err != nil {
+		return false
+	}
+	return policy.Required
+}
+
+// TwoFactorPolicies - политика по всем ролям с 2FA
+func TwoFactorPolicies() map[string]bool {
+	result := map[string]bool{}
+	for _, role := range TwoFactorRoles {
+		result[role] = TwoFactorRequired(role)
+	}
+	return result
+}
+
+// SetTwoFactorRequired - включает или выключает обязательную 2FA для роли
+func SetTwoFactorRequired(role string, required bool) error {
+	if !RoleSupportsTwoFactor(role) {
+		return ErrTwoFactorNotAllowed
+	}
+	return db.Save(&models.TwoFactorPolicy{Role: role, Required: required}).Error
+}
+
+// TwoFactorEnabled - подтверждена ли у пользователя 2FA
+func TwoFactorEnabled(userID uint) bool {
+	var tf models.TwoFactor
+	if err := db.First(&tf, "user_id = ?", userID).Error; err != nil {
+		return false
+	}
+	return tf.Enabled
+}
+
+// BeginTOTPEnrollment - создаёт новый секрет. До подтверждения кодом 2FA не включена
+func BeginTOTPEnrollment(user *models.User) (*otp.Key, error) {
+	if !RoleSupportsTwoFactor(user.Role) {
+		return nil, ErrTwoFactorNotAllowed
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tf := models.TwoFactor{UserID: user.ID, Secret: key.Secret()}
+	if err := db.Save(&tf).Error; err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// PendingTOTPKey - ключ начатого, но не подтверждённого подключения (для повторного показа QR)
+func PendingTOTPKey(user *models.User) (*otp.Key, error) {
+	var tf models.TwoFactor
+	if err := db.First(&tf, "user_id = ?", user.ID).Error; err != nil || tf.Enabled || tf.Secret == "" {
+		return nil, ErrTwoFactorNotStarted
+	}
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Email,
+		Secret:      decodeSecret(tf.Secret),
+	})
+}
+
+// ConfirmTOTPEnrollment - включает 2FA после проверки первого кода и выдаёт коды восстановления
+func ConfirmTOTPEnrollment(userID uint, code string) ([]string, error) {
+	var tf models.TwoFactor
+	if err := db.First(&tf, "user_id = ?", userID).Error; err != nil || tf.Secret == "" {
+		return nil, ErrTwoFactorNotStarted
+	}
+	if !totp.Validate(normalizeCode(code), tf.Secret) {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&tf).Updates(map[string]interface{}{
+			"enabled":      true,
+			"enabled_at":   now,
+			"last_code":    normalizeCode(code),
+			"last_used_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for i := 0; i < recoveryCodeCount; i++ {
+			raw, err := randomHex(5)
+			if err != nil {
+				return err
+			}
+			code := raw[:5] + "-" + raw[5:]
+			if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)}).Error; err != nil {
+				return err
+			}
+			codes = append(codes, code)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifySecondFactor - проверяет TOTP-код или одноразовый код восстановления
+func VerifySecondFactor(userID uint, code string) error {
+	var tf models.TwoFactor
+	if err := db.First(&tf, "user_id = ?", userID).Error; err != nil || !tf.Enabled {
+		return ErrTwoFactorNotStarted
+	}
+
+	code = normalizeCode(code)
+	if totp.Validate(code, tf.Secret) {
+		if tf.LastCode == code && tf.LastUsedAt != nil && time.Since(*tf.LastUsedAt) < totpReuseWindow {
+			return ErrInvalidTOTPCode
+		}
+		return db.Model(&tf).Updates(map[string]interface{}{
+			"last_code":    code,
+			"last_used_at": time.Now(),
+		}).Error
+	}
+
+	// Код восстановления: помечаем использованным, повторно не сработает
+	res := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// RemainingRecoveryCodes - сколько кодов восстановления ещё не использовано
+func RemainingRecoveryCodes(userID uint) int64 {
+	var count int64
+	db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count)
+	return count
+}
+
+// DisableTwoFactor - отключает 2FA (если она не обязательна для роли)
+func DisableTwoFactor(user *models.User) error {
+	if TwoFactorRequired(user.Role) {
+		return ErrTwoFactorRequired
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.TwoFactor{}).Error
+	})
+}
+
+// normalizeCode - убирает пробелы, коды восстановления приводит к нижнему регистру
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// decodeSecret - секрет хранится в base32 без выравнивания, как его выдаёт otp
+func decodeSecret(secret string) []byte {
+	b, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	return b
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"proj/intel/handlers"
 	"proj/intel/services"
+	"proj/utils"
 )
 
 func main() {
@@ -14,6 +15,15 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Загружаем ключи подписи JWT заранее, чтобы ошибка конфигурации была видна при старте
+	utils.Keys()
+	if len(utils.TrustedProxies()) == 0 {
+		log.Printf("TRUSTED_PROXIES не задан: X-Forwarded-For не учитывается, IP клиента берётся из соединения")
+	}
+	if _, err := utils.BaseURL(); err != nil {
+		log.Printf("⚠️ %v: письма со ссылками сброса пароля и подтверждения адреса отправляться не будут", err)
+	}
+
 	handlers.LoadTemplates()
 	handlers.RegisterRouter()
 	fmt.Println("Сервер запустился на :8080")
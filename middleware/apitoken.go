@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"proj/intel/models"
+	"proj/intel/services"
+	"proj/utils"
+	"strings"
+)
+
+type apiTokenKey struct{}
+
+// bearerToken - токен из заголовка Authorization: Bearer
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// checkAPIToken - вход по персональному токену. Сессии и CSRF здесь нет:
+// токен передаётся явно в заголовке, браузер его сам не подставит
+func checkAPIToken(w http.ResponseWriter, r *http.Request, raw string, next http.HandlerFunc) {
+	token, err := services.AuthenticateAPIToken(raw, utils.ClientIP(r))
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Роль берём актуальную: токен не даёт больше, чем есть у владельца сейчас
+	auth, err := services.ResolveUserAuth(token.UserID)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if auth.Pending {
+		http.Error(w, "Учётная запись ожидает одобрения", http.StatusForbidden)
+		return
+	}
+
+	claims := &utils.Claims{UserID: auth.UserID, Email: auth.Email, Role: auth.Role}
+	r = utils.WithClaims(r, claims)
+	r = r.WithContext(context.WithValue(r.Context(), apiTokenKey{}, token))
+	next(w, r)
+}
+
+// APITokenFromRequest - токен, по которому пришёл запрос (nil для обычной сессии)
+func APITokenFromRequest(r *http.Request) *models.APIToken {
+	token, _ := r.Context().Value(apiTokenKey{}).(*models.APIToken)
+	return token
+}
+
+// sessionOnly - маршруты без права в политике (личный кабинет, сессии, 2FA, токены)
+// доступны только из браузерной сессии
+func sessionOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := APITokenFromRequest(r); token != nil {
+			log.Printf("API-токен %s отклонён для %s: маршрут без права", token.Prefix, r.URL.Path)
+			http.Error(w, "Маршрут недоступен для API-токенов", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"proj/intel/models"
+	"proj/utils"
+)
+
+const csrfRejectedPage = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>Запрос отклонён</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 40px; }
+        .container { max-width: 500px; margin: 0 auto; }
+        a { color: #007bff; text-decoration: none; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h2>Запрос отклонён</h2>
+        <p>Не удалось подтвердить, что запрос отправлен со страницы этого сайта.
+        Возможно, страница устарела или сессия была обновлена.</p>
+        <p>Вернитесь назад, обновите страницу и повторите действие.</p>
+        <p><a href="/dashboard/">На главную</a></p>
+    </div>
+</body>
+</html>`
+
+// isSafeMethod - методы, которые не меняют состояние и не требуют CSRF-токена
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// verifyCSRF - проверяет CSRF-токен изменяющего запроса. Токен берётся
+// из заголовка X-CSRF-Token (fetch) или из поля csrf_token (формы)
+func verifyCSRF(w http.ResponseWriter, r *http.Request, session *models.Session) bool {
+	if isSafeMethod(r.Method) {
+		return true
+	}
+
+	token := r.Header.Get(utils.CSRFHeader)
+	if token == "" {
+		token = r.FormValue(utils.CSRFField)
+	}
+
+	if session.CSRFToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) != 1 {
+		log.Printf("CSRF: отклонён %s %s от %s", r.Method, r.URL.Path, utils.ClientIP(r))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(csrfRejectedPage))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"proj/intel/models"
+)
+
+// ImpersonationStopPath - выход из просмотра доступен всегда
+const ImpersonationStopPath = "/impersonation/stop"
+
+// impersonationBlockedPaths - настройки безопасности пользователя недоступны
+// администратору даже при разрешённых изменениях
+var impersonationBlockedPaths = map[string]bool{
+	"/2fa":                 true,
+	"/tokens":              true,
+	"/tokens/revoke":       true,
+	"/sessions/revoke":     true,
+	"/sessions/logout-all": true,
+	"/verify-email/resend": true,
+}
+
+// checkImpersonation - в режиме просмотра пропускаем только чтение,
+// если при входе администратор явно не разрешил изменения
+func checkImpersonation(w http.ResponseWriter, r *http.Request, session *models.Session) bool {
+	if !session.Impersonated() || r.URL.Path == ImpersonationStopPath {
+		return true
+	}
+	if impersonationBlockedPaths[r.URL.Path] {
+		http.Error(w, "Недоступно в режиме просмотра от имени пользователя", http.StatusForbidden)
+		return false
+	}
+	if !isSafeMethod(r.Method) && !session.ImpersonationWrite {
+		log.Printf("Изменение %s %s заблокировано в режиме просмотра (администратор %d)",
+			r.Method, r.URL.Path, *session.ImpersonatorID)
+		http.Error(w, "Изменения запрещены в режиме просмотра от имени пользователя", http.StatusForbidden)
+		return false
+	}
+	return true
+}
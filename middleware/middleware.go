@@ -28,12 +28,28 @@ package middleware
 import (
 	"log"
 	"net/http"
+	"proj/intel/services"
 	"proj/utils"
+	"time"
 )
 
+// pendingAllowedPaths - куда пускаем пользователя, чья регистрация ещё не одобрена
+var pendingAllowedPaths = map[string]bool{
+	"/pending":             true,
+	"/pending/group":       true,
+	"/verify-email/resend": true,
+	ImpersonationStopPath:  true,
+}
+
 // CheckAuth - основной middleware для проверки аутентификации
 func CheckAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Скрипты и интеграции приходят с персональным токеном вместо cookie
+		if raw, ok := bearerToken(r); ok {
+			checkAPIToken(w, r, raw, next)
+			return
+		}
+
 		claims, err := utils.GetUserFromCookie(r)
 		if err != nil {
 			// Если нет токена, перенаправляем на страницу логина
@@ -48,48 +64,71 @@ func CheckAuth(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// Если пользователь аутентифицирован, передаем управление следующему обработчику
-		next(w, r)
-	}
-}
+		// Проверяем серверную сессию: отозванный или истёкший токен не принимаем
+		session, err := services.GetActiveSession(claims.SessionID())
+		if err != nil || session.UserID != claims.UserID {
+			utils.ClearJWTCookie(w)
+			http.Redirect(w, r, "/login/", http.StatusFound)
+			return
+		}
 
-// AdminOnly - middleware для проверки прав администратора
-func AdminOnly(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		claims, err := utils.GetUserFromCookie(r)
-		if err != nil || claims.Role != "admin" {
-			http.Error(w, "Доступ запрещен. Требуются права администратора.", http.StatusForbidden)
+		// Роль берём не из токена, а актуальную: повышение, понижение или
+		// отключение учётной записи вступают в силу со следующего запроса
+		auth, err := services.ResolveUserAuth(claims.UserID)
+		if err != nil {
+			services.RevokeSession(session.ID)
+			utils.ClearJWTCookie(w)
+			http.Redirect(w, r, "/login/", http.StatusFound)
 			return
 		}
-		next(w, r)
-	}
-}
+		roleChanged := auth.Role != claims.Role
+		claims.Role = auth.Role
 
-// CuratorOnly - middleware для проверки прав куратора
-func CuratorOnly(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		claims, err := utils.GetUserFromCookie(r)
-		if err != nil || (claims.Role != "curator" && claims.Role != "admin") {
-			http.Error(w, "Доступ запрещен. Требуются права куратора или администратора.", http.StatusForbidden)
+		// Просмотр от имени пользователя: администратор должен оставаться администратором
+		if session.Impersonated() {
+			admin, err := services.ResolveUserAuth(*session.ImpersonatorID)
+			if err != nil || !HasPermission(admin.Role, PermImpersonate) {
+				services.RevokeSession(session.ID)
+				utils.ClearJWTCookie(w)
+				http.Redirect(w, r, "/login/", http.StatusFound)
+				return
+			}
+			claims.ImpersonatorID = admin.UserID
+			claims.ImpersonatorEmail = admin.Email
+		}
+		r = utils.WithClaims(r, claims)
+
+		if err := services.EnsureCSRFToken(session); err != nil {
+			log.Printf("Ошибка выдачи CSRF-токена: %v", err)
+		}
+		if !verifyCSRF(w, r, session) {
 			return
 		}
-		next(w, r)
-	}
-}
+		r = utils.WithCSRFToken(r, session.CSRFToken)
 
-// HeadmanOrAbove - middleware для проверки прав старосты и выше
-func HeadmanOrAbove(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		claims, err := utils.GetUserFromCookie(r)
-		if err != nil {
-			http.Redirect(w, r, "/login/", http.StatusFound)
+		// Неодобренная учётная запись видит только страницу ожидания
+		if auth.Pending && !pendingAllowedPaths[r.URL.Path] {
+			http.Redirect(w, r, "/pending", http.StatusFound)
 			return
 		}
 
-		if claims.Role != "headman" && claims.Role != "curator" && claims.Role != "admin" {
-			http.Error(w, "Доступ запрещен. Требуются права старосты или выше.", http.StatusForbidden)
+		if !checkImpersonation(w, r, session) {
 			return
 		}
+
+		if _, err := services.TouchSession(session, utils.ClientIP(r)); err != nil {
+			log.Printf("Ошибка обновления сессии %s: %v", session.ID, err)
+		}
+
+		// Скользящее продление: перевыпускаем токен, когда прошла половина срока
+		// или когда роль в токене устарела
+		if roleChanged || time.Until(time.Unix(claims.ExpiresAt, 0)) < utils.TokenTTL/2 {
+			if err := utils.SetJWTCookie(w, session.ID, claims.UserID, claims.Email, claims.Role); err != nil {
+				log.Printf("Ошибка продления токена: %v", err)
+			}
+		}
+
+		// Если пользователь аутентифицирован, передаем управление следующему обработчику
 		next(w, r)
 	}
 }
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"net/http"
+	"proj/utils"
+)
+
+// Permission - именованное право доступа
+type Permission string
+
+const (
+	PermStudentsView        Permission = "students:view"        // списки студентов и тем
+	PermStudentsManage      Permission = "students:manage"      // полная панель студентов
+	PermStudentsImport      Permission = "students:import"      // загрузка Excel со студентами, темами, руководителями
+	PermTopicsAssign        Permission = "topics:assign"        // ручное назначение и снятие тем
+	PermTopicsAutoAssign    Permission = "topics:auto-assign"   // случайное распределение тем
+	PermHeadmenAssign       Permission = "headmen:assign"       // назначение старост
+	PermExportGroup         Permission = "export:group"         // выгрузка по группе
+	PermExportSupervisor    Permission = "export:supervisor"    // выгрузка по руководителю
+	PermUsersManage         Permission = "users:manage"         // смена ролей, отключение учётных записей
+	PermSessionsManage      Permission = "sessions:manage"      // просмотр и отзыв чужих сессий
+	PermLoginsReview        Permission = "logins:review"        // журнал неудачных входов, разблокировка
+	PermKeysRotate          Permission = "keys:rotate"          // смена ключа подписи JWT
+	PermSecurityPolicy      Permission = "security:policy"      // обязательная 2FA по ролям
+	PermRegistrationSetup   Permission = "registration:setup"   // коды приглашения, разрешённые домены, режим одобрения
+	PermRegistrationApprove Permission = "registration:approve" // очередь новых учётных записей
+	PermAuditView           Permission = "audit:view"           // журнал действий и его выгрузка
+	PermImpersonate         Permission = "users:impersonate"    // просмотр системы от имени студента или старосты
+	PermSupervisorDesk      Permission = "supervisor:desk"      // кабинет руководителя: свои темы и студенты
+	PermCommissionsManage   Permission = "commissions:manage"   // справочник ПЦК: председатели и состав
+	PermExportCommission    Permission = "export:commission"    // выгрузка по ПЦК
+	PermGroupsManage        Permission = "groups:manage"        // справочник групп: кураторы, псевдонимы, объединение
+	PermCuratorDesk         Permission = "curator:desk"         // кабинет куратора: свои группы
+	PermTermsManage         Permission = "terms:manage"         // учебные периоды и переход на новый
+	PermTopicsLifecycle     Permission = "topics:lifecycle"     // состояния тем и история переходов
+	PermTopicsPropose       Permission = "topics:propose"       // студент предлагает свою тему или просит сменить назначенную
+	PermTopicRequests       Permission = "topics:requests"      // рассмотрение заявок на смену темы
+)
+
+// rolePermissions - какие права есть у каждой роли. Администратор получает все права
+var rolePermissions = map[string][]Permission{
+	"curator": {
+		PermStudentsView, PermTopicsAssign, PermTopicsAutoAssign, PermHeadmenAssign,
+		PermExportGroup, PermExportSupervisor, PermExportCommission, PermRegistrationApprove,
+		PermCuratorDesk, PermTopicRequests,
+	},
+	"headman": {
+		PermStudentsView, PermTopicsAssign, PermTopicsAutoAssign, PermExportGroup,
+		PermTopicsPropose, PermTopicRequests,
+	},
+	"supervisor": {
+		PermSupervisorDesk, PermExportSupervisor,
+	},
+	"student": {PermTopicsPropose},
+}
+
+// PermissionInfo - право с описанием для интерфейса
+type PermissionInfo struct {
+	Permission  Permission
+	Description string
+}
+
+// Permissions - все права в порядке показа (области действия API-токенов)
+var Permissions = []PermissionInfo{
+	{PermStudentsView, "Просмотр списков студентов и тем"},
+	{PermStudentsManage, "Полная панель студентов"},
+	{PermStudentsImport, "Загрузка Excel"},
+	{PermTopicsAssign, "Назначение и снятие тем"},
+	{PermTopicsAutoAssign, "Автораспределение тем"},
+	{PermHeadmenAssign, "Назначение старост"},
+	{PermExportGroup, "Выгрузка по группе"},
+	{PermExportSupervisor, "Выгрузка по руководителю"},
+	{PermUsersManage, "Управление учётными записями"},
+	{PermSessionsManage, "Управление сессиями"},
+	{PermLoginsReview, "Журнал неудачных входов"},
+	{PermKeysRotate, "Смена ключа подписи"},
+	{PermSecurityPolicy, "Политика 2FA"},
+	{PermRegistrationSetup, "Правила регистрации"},
+	{PermRegistrationApprove, "Одобрение регистраций"},
+	{PermAuditView, "Журнал действий"},
+	{PermSupervisorDesk, "Кабинет руководителя"},
+	{PermCommissionsManage, "Справочник ПЦК"},
+	{PermExportCommission, "Выгрузка по ПЦК"},
+	{PermGroupsManage, "Справочник групп"},
+	{PermCuratorDesk, "Кабинет куратора"},
+	{PermTermsManage, "Учебные периоды"},
+	{PermTopicsLifecycle, "Состояния тем"},
+	{PermTopicsPropose, "Предложение и смена своей темы"},
+	{PermTopicRequests, "Заявки на смену темы"},
+}
+
+// RolePermissions - права, которые есть у роли (их можно выдать токену)
+func RolePermissions(role string) []PermissionInfo {
+	var result []PermissionInfo
+	for _, p := range Permissions {
+		if HasPermission(role, p.Permission) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// HasPermission - есть ли у роли право
+func HasPermission(role string, perm Permission) bool {
+	if role == "admin" {
+		return true
+	}
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy - правило доступа к маршруту
+type Policy struct {
+	Public     bool       // доступно без входа
+	Permission Permission // требуемое право; пустое - достаточно войти
+}
+
+var (
+	// Public - маршрут без авторизации
+	Public = Policy{Public: true}
+	// Authenticated - любой вошедший пользователь
+	Authenticated = Policy{}
+)
+
+// Require - маршрут доступен ролям с указанным правом
+func Require(perm Permission) Policy {
+	return Policy{Permission: perm}
+}
+
+// RequirePermission - middleware для проверки права. Ставится после CheckAuth
+func RequirePermission(perm Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := utils.GetUserFromCookie(r)
+		if err != nil {
+			http.Redirect(w, r, "/login/", http.StatusFound)
+			return
+		}
+		if !HasPermission(claims.Role, perm) {
+			http.Error(w, "Доступ запрещен. Недостаточно прав: "+string(perm), http.StatusForbidden)
+			return
+		}
+		// Токену нужно и право роли владельца, и право в самом токене
+		if token := APITokenFromRequest(r); token != nil && !token.HasScope(string(perm)) {
+			http.Error(w, "Доступ запрещен. У токена нет права: "+string(perm), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Protect - оборачивает обработчик согласно политике маршрута
+func Protect(policy Policy, next http.HandlerFunc) http.HandlerFunc {
+	if policy.Public {
+		return RecoveryMiddleware(next)
+	}
+	if policy.Permission == "" {
+		return RecoveryMiddleware(CheckAuth(sessionOnly(next)))
+	}
+	return RecoveryMiddleware(CheckAuth(RequirePermission(policy.Permission, next)))
+}
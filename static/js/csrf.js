@@ -0,0 +1,44 @@
+// CSRF-защита: токен сессии берётся из <meta name="csrf-token">
+// и добавляется во все POST-формы (поле csrf_token) и fetch-запросы (заголовок X-CSRF-Token)
+(function() {
+    function getToken() {
+        const meta = document.querySelector('meta[name="csrf-token"]');
+        return meta ? meta.content : '';
+    }
+
+    function addTokenToForm(form) {
+        if ((form.getAttribute('method') || 'get').toLowerCase() !== 'post') {
+            return;
+        }
+        let input = form.querySelector('input[name="csrf_token"]');
+        if (!input) {
+            input = document.createElement('input');
+            input.type = 'hidden';
+            input.name = 'csrf_token';
+            form.appendChild(input);
+        }
+        input.value = getToken();
+    }
+
+    // Формы, которые есть на странице при загрузке
+    document.addEventListener('DOMContentLoaded', function() {
+        document.querySelectorAll('form').forEach(addTokenToForm);
+    });
+
+    // Формы, добавленные динамически, получают токен при отправке
+    document.addEventListener('submit', function(e) {
+        addTokenToForm(e.target);
+    }, true);
+
+    const originalFetch = window.fetch;
+    window.fetch = function(resource, options) {
+        options = options || {};
+        const method = (options.method || 'GET').toUpperCase();
+        if (method !== 'GET' && method !== 'HEAD') {
+            const headers = new Headers(options.headers || {});
+            headers.set('X-CSRF-Token', getToken());
+            options.headers = headers;
+        }
+        return originalFetch(resource, options);
+    };
+})();
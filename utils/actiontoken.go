@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Назначения одноразовых ссылок из писем
+const (
+	PurposeResetPassword = "reset_password"
+	PurposeVerifyEmail   = "verify_email"
+)
+
+var ErrActionTokenInvalid = errors.New("ссылка недействительна или устарела")
+
+// ActionClaims - подписанный токен для ссылки из письма.
+// Одноразовость обеспечивается записью в БД по jti
+type ActionClaims struct {
+	UserID  uint   `json:"user_id"`
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"`
+	jwt.StandardClaims
+}
+
+// GenerateActionToken - подписывает токен текущим ключом связки
+func GenerateActionToken(id string, userID uint, email, purpose string, ttl time.Duration) (string, error) {
+	claims := &ActionClaims{
+		UserID:  userID,
+		Email:   email,
+		Purpose: purpose,
+		StandardClaims: jwt.StandardClaims{
+			Id:        id,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		},
+	}
+
+	key := Keys().Current()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString([]byte(key.Secret))
+}
+
+// ParseActionToken - проверяет подпись, срок и назначение токена
+func ParseActionToken(tokenString, purpose string) (*ActionClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &ActionClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return Keys().Lookup(kid)
+	})
+	if err != nil {
+		return nil, ErrActionTokenInvalid
+	}
+
+	claims, ok := token.Claims.(*ActionClaims)
+	if !ok || !token.Valid || claims.Purpose != purpose || claims.Id == "" || claims.UserID == 0 {
+		return nil, ErrActionTokenInvalid
+	}
+	return claims, nil
+}
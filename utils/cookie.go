@@ -79,14 +79,22 @@
 package utils
 
 import (
+	"context"
 	"net/http"
 	"time"
 )
 
 var CookieName = "jwt_token"
 
-func SetJWTCookie(w http.ResponseWriter, userID uint, email, role string) error {
-	tokenString, err := GenerateJWT(userID, email, role)
+type claimsKey struct{}
+
+// WithClaims - кладёт актуальные claims в контекст запроса (роль могла измениться после выдачи токена)
+func WithClaims(r *http.Request, claims *Claims) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims))
+}
+
+func SetJWTCookie(w http.ResponseWriter, sessionID string, userID uint, email, role string) error {
+	tokenString, err := GenerateJWT(sessionID, userID, email, role)
 	if err != nil {
 		return err
 	}
@@ -94,7 +102,7 @@ func SetJWTCookie(w http.ResponseWriter, userID uint, email, role string) error
 	http.SetCookie(w, &http.Cookie{
 		Name:     CookieName,
 		Value:    tokenString,
-		Expires:  time.Now().Add(24 * time.Hour),
+		Expires:  time.Now().Add(TokenTTL),
 		HttpOnly: true,
 		Secure:   false, // true в production
 		Path:     "/",
@@ -105,6 +113,11 @@ func SetJWTCookie(w http.ResponseWriter, userID uint, email, role string) error
 }
 
 func GetUserFromCookie(r *http.Request) (*Claims, error) {
+	// Если middleware уже проверил пользователя, берём claims с актуальной ролью
+	if claims, ok := r.Context().Value(claimsKey{}).(*Claims); ok {
+		return claims, nil
+	}
+
 	cookie, err := r.Cookie(CookieName)
 	if err != nil {
 		return nil, err
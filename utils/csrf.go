@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+)
+
+// CSRFHeader - заголовок, в котором fetch-запросы передают CSRF-токен
+const CSRFHeader = "X-CSRF-Token"
+
+// CSRFField - имя скрытого поля в HTML-формах
+const CSRFField = "csrf_token"
+
+type csrfKey struct{}
+
+// WithCSRFToken - кладёт CSRF-токен сессии в контекст запроса
+func WithCSRFToken(r *http.Request, token string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), csrfKey{}, token))
+}
+
+// CSRFToken - CSRF-токен текущей сессии (пустой для неавторизованных запросов)
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey{}).(string)
+	return token
+}
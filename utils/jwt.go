@@ -2,37 +2,60 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 )
 
-var SecretKey = []byte("your-secret-key")
+// TokenTTL - время жизни токена; сессия продлевается перевыпуском токена
+const TokenTTL = 24 * time.Hour
 
 type Claims struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
 	Role   string `json:"role"`
 	jwt.StandardClaims
+
+	// Заполняются middleware из серверной сессии, в токен не попадают
+	ImpersonatorID    uint   `json:"-"`
+	ImpersonatorEmail string `json:"-"`
+}
+
+// Impersonated - запрос от имени пользователя, выполняемый администратором
+func (c *Claims) Impersonated() bool {
+	return c.ImpersonatorID != 0
+}
+
+// SessionID - ID серверной сессии (jti)
+func (c *Claims) SessionID() string {
+	return c.Id
 }
 
-func GenerateJWT(userID uint, email, role string) (string, error) {
+func GenerateJWT(sessionID string, userID uint, email, role string) (string, error) {
 	claims := &Claims{
 		UserID: userID,
 		Email:  email,
 		Role:   role,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
+			Id:        sessionID,
+			ExpiresAt: time.Now().Add(TokenTTL).Unix(),
 		},
 	}
 
+	key := Keys().Current()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(SecretKey)
+	token.Header["kid"] = key.ID
+	return token.SignedString([]byte(key.Secret))
 }
 
 func ParseJWT(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return SecretKey, nil
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return Keys().Lookup(kid)
 	})
 
 	if err != nil {
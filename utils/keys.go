@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Переменные окружения для настройки ключей подписи JWT:
+//
+//	JWT_KEY_FILE        - путь к JSON-файлу со связкой ключей (сохраняется при ротации)
+//	JWT_SECRET          - текущий секрет (если файл не задан)
+//	JWT_KEY_ID          - kid текущего секрета (по умолчанию "default")
+//	JWT_PREVIOUS_SECRET - предыдущий секрет, принимается в течение grace-периода
+//	JWT_PREVIOUS_KEY_ID - kid предыдущего секрета (по умолчанию "previous")
+//	JWT_PREVIOUS_RETIRED_AT - когда предыдущий секрет перестал быть текущим (RFC 3339),
+//	                      обязателен вместе с JWT_PREVIOUS_SECRET
+//	JWT_KEY_GRACE       - длительность grace-периода, например "24h"
+const defaultKeyGrace = 24 * time.Hour
+
+var ErrUnknownKey = errors.New("неизвестный ключ подписи")
+
+// SigningKey - один ключ подписи в связке
+type SigningKey struct {
+	ID        string    `json:"kid"`
+	Secret    string    `json:"secret"`
+	RetiredAt time.Time `json:"retired_at,omitempty"` // когда ключ перестал быть текущим
+}
+
+// Keyring - связка ключей: текущим подписываем, предыдущие принимаем до конца grace-периода
+type Keyring struct {
+	mu       sync.RWMutex
+	current  SigningKey
+	previous []SigningKey
+	grace    time.Duration
+	path     string // файл, в который сохраняется связка после ротации
+}
+
+type keyringFile struct {
+	Current  SigningKey   `json:"current"`
+	Previous []SigningKey `json:"previous"`
+}
+
+var (
+	keyring     *Keyring
+	keyringOnce sync.Once
+)
+
+// Keys - возвращает связку ключей, при первом вызове загружает её из окружения
+func Keys() *Keyring {
+	keyringOnce.Do(func() {
+		kr, err := LoadKeyring()
+		if err != nil {
+			log.Fatal("Ошибка загрузки ключей JWT:", err)
+		}
+		keyring = kr
+	})
+	return keyring
+}
+
+// LoadKeyring - загружает ключи из файла JWT_KEY_FILE или из переменных окружения.
+// Если ничего не задано, генерирует случайный ключ (сессии не переживут перезапуск)
+func LoadKeyring() (*Keyring, error) {
+	kr := &Keyring{grace: defaultKeyGrace}
+
+	if g := os.Getenv("JWT_KEY_GRACE"); g != "" {
+		d, err := time.ParseDuration(g)
+		if err != nil {
+			return nil, fmt.Errorf("неверный JWT_KEY_GRACE: %w", err)
+		}
+		kr.grace = d
+	}
+
+	if path := os.Getenv("JWT_KEY_FILE"); path != "" {
+		kr.path = path
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			var f keyringFile
+			if err := json.Unmarshal(data, &f); err != nil {
+				return nil, fmt.Errorf("ошибка чтения %s: %w", path, err)
+			}
+			if f.Current.ID == "" || f.Current.Secret == "" {
+				return nil, fmt.Errorf("в %s нет текущего ключа", path)
+			}
+			kr.current = f.Current
+			kr.previous = f.Previous
+			return kr, nil
+		case os.IsNotExist(err):
+			// Файла ещё нет - создадим его с новым ключом
+			key, err := newSigningKey()
+			if err != nil {
+				return nil, err
+			}
+			kr.current = key
+			return kr, kr.save(kr.current, kr.previous)
+		default:
+			return nil, err
+		}
+	}
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		kr.current = SigningKey{ID: envOr("JWT_KEY_ID", "default"), Secret: secret}
+		if prev := os.Getenv("JWT_PREVIOUS_SECRET"); prev != "" {
+			// Время вывода берём из конфигурации: иначе grace-период
+			// начинался бы заново при каждом перезапуске и не истекал никогда
+			retiredAt, err := time.Parse(time.RFC3339, os.Getenv("JWT_PREVIOUS_RETIRED_AT"))
+			if err != nil {
+				return nil, fmt.Errorf("JWT_PREVIOUS_SECRET задан без корректного JWT_PREVIOUS_RETIRED_AT: %w", err)
+			}
+			if time.Since(retiredAt) >= kr.grace {
+				log.Printf("⚠️ grace-период JWT_PREVIOUS_SECRET истёк, предыдущий ключ больше не принимается")
+			}
+			kr.previous = []SigningKey{{
+				ID:        envOr("JWT_PREVIOUS_KEY_ID", "previous"),
+				Secret:    prev,
+				RetiredAt: retiredAt,
+			}}
+		}
+		return kr, nil
+	}
+
+	log.Printf("⚠️ JWT_SECRET и JWT_KEY_FILE не заданы, используется временный ключ")
+	key, err := newSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	kr.current = key
+	return kr, nil
+}
+
+// Current - ключ, которым подписываются новые токены
+func (kr *Keyring) Current() SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.current
+}
+
+// Lookup - ищет ключ по kid; предыдущие ключи принимаются только в grace-период
+func (kr *Keyring) Lookup(kid string) ([]byte, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	if kid == kr.current.ID {
+		return []byte(kr.current.Secret), nil
+	}
+	for _, k := range kr.previous {
+		if k.ID == kid && time.Since(k.RetiredAt) < kr.grace {
+			return []byte(k.Secret), nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// Rotate - выпускает новый текущий ключ. Старый остаётся действительным
+// на grace-период, чтобы пользователей не разлогинило разом
+func (kr *Keyring) Rotate() (SigningKey, error) {
+	key, err := newSigningKey()
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	retired := kr.current
+	retired.RetiredAt = time.Now()
+
+	// Выбрасываем ключи, у которых grace-период уже истёк
+	previous := []SigningKey{retired}
+	for _, k := range kr.previous {
+		if time.Since(k.RetiredAt) < kr.grace {
+			previous = append(previous, k)
+		}
+	}
+
+	// Сначала сохраняем новую связку и только после успешной записи
+	// подменяем ключи в памяти, чтобы при ошибке ничего не потерять
+	if err := kr.save(key, previous); err != nil {
+		return SigningKey{}, err
+	}
+	kr.current = key
+	kr.previous = previous
+
+	log.Printf("Ключ JWT заменён: %s -> %s", retired.ID, key.ID)
+	return key, nil
+}
+
+// save - сохраняет связку с указанными ключами в файл, если он настроен
+func (kr *Keyring) save(current SigningKey, previous []SigningKey) error {
+	if kr.path == "" {
+		log.Printf("⚠️ JWT_KEY_FILE не задан, новый ключ не сохранится после перезапуска")
+		return nil
+	}
+	data, err := json.MarshalIndent(keyringFile{Current: current, Previous: previous}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(kr.path, data, 0600)
+}
+
+func newSigningKey() (SigningKey, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return SigningKey{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return SigningKey{}, err
+	}
+	return SigningKey{ID: hex.EncodeToString(id), Secret: hex.EncodeToString(secret)}, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
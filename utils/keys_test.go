@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useKeyEnv - окружение только с JWT_SECRET и предыдущим ключом
+func useKeyEnv(t *testing.T, retiredAt string) {
+	t.Helper()
+	t.Setenv("JWT_KEY_FILE", "")
+	t.Setenv("JWT_KEY_GRACE", "1h")
+	t.Setenv("JWT_SECRET", "current-secret")
+	t.Setenv("JWT_KEY_ID", "cur")
+	t.Setenv("JWT_PREVIOUS_SECRET", "previous-secret")
+	t.Setenv("JWT_PREVIOUS_KEY_ID", "prev")
+	t.Setenv("JWT_PREVIOUS_RETIRED_AT", retiredAt)
+}
+
+func TestLoadKeyringPreviousRetiredAt(t *testing.T) {
+	cases := []struct {
+		name      string
+		retiredAt string
+		accepted  bool
+	}{
+		{"grace-период идёт", time.Now().Add(-30 * time.Minute).Format(time.RFC3339), true},
+		{"grace-период истёк", time.Now().Add(-2 * time.Hour).Format(time.RFC3339), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			useKeyEnv(t, c.retiredAt)
+			kr, err := LoadKeyring()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = kr.Lookup("prev")
+			if c.accepted && err != nil {
+				t.Fatalf("предыдущий ключ не принят: %v", err)
+			}
+			if !c.accepted && err != ErrUnknownKey {
+				t.Fatalf("предыдущий ключ принят после grace-периода: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadKeyringPreviousWithoutRetiredAt(t *testing.T) {
+	for _, v := range []string{"", "вчера"} {
+		useKeyEnv(t, v)
+		if _, err := LoadKeyring(); err == nil {
+			t.Errorf("JWT_PREVIOUS_RETIRED_AT=%q принят", v)
+		}
+	}
+}
+
+func TestRotateKeepsKeysWhenSaveFails(t *testing.T) {
+	useKeyEnv(t, time.Now().Format(time.RFC3339))
+	t.Setenv("JWT_KEY_FILE", filepath.Join(t.TempDir(), "keys.json"))
+	kr, err := LoadKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := kr.Current()
+
+	kr.path = filepath.Join(t.TempDir(), "нет", "keys.json")
+	if _, err := kr.Rotate(); err == nil {
+		t.Fatal("ротация без записи файла прошла успешно")
+	}
+	if kr.Current() != before {
+		t.Fatal("после неудачной ротации сменился текущий ключ")
+	}
+	if _, err := kr.Lookup(before.ID); err != nil {
+		t.Fatalf("после неудачной ротации не принимается текущий ключ: %v", err)
+	}
+}
+
+func TestRotatePersistsKeyring(t *testing.T) {
+	useKeyEnv(t, time.Now().Format(time.RFC3339))
+	t.Setenv("JWT_KEY_FILE", filepath.Join(t.TempDir(), "keys.json"))
+	kr, err := LoadKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := kr.Current()
+	key, err := kr.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Current() != key {
+		t.Fatal("в файле не новый текущий ключ")
+	}
+	if _, err := reloaded.Lookup(old.ID); err != nil {
+		t.Fatalf("старый ключ не принимается после перезагрузки: %v", err)
+	}
+}
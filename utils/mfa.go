@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// MFACookieName - cookie промежуточного шага входа: пароль проверен, код 2FA ещё нет
+const MFACookieName = "mfa_pending"
+
+const mfaTTL = 5 * time.Minute
+
+const mfaPurpose = "mfa"
+
+// MFAClaims - токен промежуточного шага; сессией не является
+type MFAClaims struct {
+	UserID  uint   `json:"user_id"`
+	Purpose string `json:"purpose"`
+	jwt.StandardClaims
+}
+
+// SetMFACookie - запоминает, что пользователь прошёл проверку пароля
+func SetMFACookie(w http.ResponseWriter, userID uint) error {
+	claims := &MFAClaims{
+		UserID:  userID,
+		Purpose: mfaPurpose,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(mfaTTL).Unix(),
+		},
+	}
+
+	key := Keys().Current()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString([]byte(key.Secret))
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     MFACookieName,
+		Value:    tokenString,
+		Expires:  time.Now().Add(mfaTTL),
+		HttpOnly: true,
+		Secure:   false, // true в production
+		Path:     "/",
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+// GetMFAUserID - ID пользователя, ожидающего ввода кода 2FA
+func GetMFAUserID(r *http.Request) (uint, error) {
+	cookie, err := r.Cookie(MFACookieName)
+	if err != nil {
+		return 0, err
+	}
+
+	token, err := jwt.ParseWithClaims(cookie.Value, &MFAClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return Keys().Lookup(kid)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	claims, ok := token.Claims.(*MFAClaims)
+	if !ok || !token.Valid || claims.Purpose != mfaPurpose || claims.UserID == 0 {
+		return 0, errors.New("invalid mfa token")
+	}
+	return claims.UserID, nil
+}
+
+func ClearMFACookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     MFACookieName,
+		Value:    "",
+		Expires:  time.Now().Add(-time.Hour),
+		HttpOnly: true,
+		Secure:   false,
+		Path:     "/",
+	})
+}
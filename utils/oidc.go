@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// OIDCCookieName - cookie с параметрами начатого входа через провайдера
+const OIDCCookieName = "oidc_state"
+
+const oidcStateTTL = 10 * time.Minute
+
+const oidcPurpose = "oidc"
+
+// OIDCState - state, nonce и PKCE verifier одного входа
+type OIDCState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Purpose  string `json:"purpose"`
+	jwt.StandardClaims
+}
+
+// SetOIDCCookie - подписывает параметры входа и сохраняет их до возврата от провайдера
+func SetOIDCCookie(w http.ResponseWriter, state *OIDCState) error {
+	state.Purpose = oidcPurpose
+	state.ExpiresAt = time.Now().Add(oidcStateTTL).Unix()
+
+	key := Keys().Current()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, state)
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString([]byte(key.Secret))
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     OIDCCookieName,
+		Value:    tokenString,
+		Expires:  time.Now().Add(oidcStateTTL),
+		HttpOnly: true,
+		Secure:   false, // true в production
+		Path:     "/login/oidc",
+		// Lax: cookie должна прийти при переходе с сайта провайдера
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// GetOIDCState - параметры начатого входа
+func GetOIDCState(r *http.Request) (*OIDCState, error) {
+	cookie, err := r.Cookie(OIDCCookieName)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.ParseWithClaims(cookie.Value, &OIDCState{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return Keys().Lookup(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	state, ok := token.Claims.(*OIDCState)
+	if !ok || !token.Valid || state.Purpose != oidcPurpose || state.State == "" || state.Verifier == "" {
+		return nil, errors.New("invalid oidc state")
+	}
+	return state, nil
+}
+
+func ClearOIDCCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     OIDCCookieName,
+		Value:    "",
+		Expires:  time.Now().Add(-time.Hour),
+		HttpOnly: true,
+		Secure:   false,
+		Path:     "/login/oidc",
+	})
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TRUSTED_PROXIES - адреса и подсети обратных прокси через запятую, например "127.0.0.1, 10.0.0.0/8".
+// Заголовкам X-Forwarded-For и X-Real-IP верим только от них, иначе клиент подставил бы
+// любой IP и обошёл блокировку попыток входа
+var (
+	trustedProxies     []*net.IPNet
+	trustedProxiesOnce sync.Once
+)
+
+// TrustedProxies - доверенные прокси, при первом вызове читаются из TRUSTED_PROXIES
+func TrustedProxies() []*net.IPNet {
+	trustedProxiesOnce.Do(func() {
+		list, err := ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+		if err != nil {
+			log.Fatal("Ошибка TRUSTED_PROXIES: ", err)
+		}
+		trustedProxies = list
+	})
+	return trustedProxies
+}
+
+// ParseTrustedProxies - список IP и подсетей CIDR через запятую или пробел
+func ParseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("неверный адрес %q", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("неверная подсеть %q", item)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, n := range TrustedProxies() {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP - IP клиента. Адрес соединения заменяется на X-Forwarded-For / X-Real-IP,
+// только если соединение пришло от доверенного прокси. В цепочке X-Forwarded-For
+// берётся последний адрес перед доверенными прокси: начало цепочки присылает клиент
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer == nil || !isTrustedProxy(peer) {
+		return host
+	}
+
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		hops := strings.Split(fwd, ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			client = ip
+			if !isTrustedProxy(ip) {
+				break
+			}
+		}
+		return client.String()
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// ErrNoBaseURL - адрес сайта не настроен, письма со ссылками не отправляются
+var ErrNoBaseURL = errors.New("APP_BASE_URL не задан")
+
+// BaseURL - адрес сайта для ссылок в письмах. Берётся только из APP_BASE_URL:
+// заголовок Host присылает клиент, и ссылка на сброс пароля могла бы увести на чужой сайт
+func BaseURL() (string, error) {
+	base := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	if base == "" {
+		return "", ErrNoBaseURL
+	}
+	return base, nil
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// useTrustedProxies - список доверенных прокси на время теста вместо TRUSTED_PROXIES
+func useTrustedProxies(t *testing.T, list string) {
+	t.Helper()
+	nets, err := ParseTrustedProxies(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trustedProxiesOnce.Do(func() {})
+	saved := trustedProxies
+	trustedProxies = nets
+	t.Cleanup(func() { trustedProxies = saved })
+}
+
+func TestClientIP(t *testing.T) {
+	useTrustedProxies(t, "127.0.0.1, 10.0.0.0/8")
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{"без прокси", "203.0.113.7:5000", "", "", "203.0.113.7"},
+		{"подделанный XFF от клиента", "203.0.113.7:5000", "1.2.3.4", "", "203.0.113.7"},
+		{"подделанный X-Real-IP от клиента", "203.0.113.7:5000", "", "1.2.3.4", "203.0.113.7"},
+		{"XFF от прокси", "127.0.0.1:40000", "198.51.100.2", "", "198.51.100.2"},
+		{"X-Real-IP от прокси", "127.0.0.1:40000", "", "198.51.100.2", "198.51.100.2"},
+		{"цепочка прокси", "127.0.0.1:40000", "198.51.100.2, 10.1.2.3", "", "198.51.100.2"},
+		{"клиент дописал начало цепочки", "127.0.0.1:40000", "1.2.3.4, 198.51.100.2", "", "198.51.100.2"},
+		{"мусор в XFF", "127.0.0.1:40000", "not-an-ip", "", "127.0.0.1"},
+		{"прокси без заголовков", "10.0.0.5:40000", "", "", "10.0.0.5"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/login/", nil)
+			r.RemoteAddr = c.remoteAddr
+			if c.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", c.forwarded)
+			}
+			if c.realIP != "" {
+				r.Header.Set("X-Real-IP", c.realIP)
+			}
+			if got := ClientIP(r); got != c.want {
+				t.Fatalf("ClientIP = %s, ожидался %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	useTrustedProxies(t, "")
+
+	r := httptest.NewRequest("GET", "/login/", nil)
+	r.RemoteAddr = "127.0.0.1:40000"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4")
+	if got := ClientIP(r); got != "127.0.0.1" {
+		t.Fatalf("без TRUSTED_PROXIES учтён X-Forwarded-For: %s", got)
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	nets, err := ParseTrustedProxies("127.0.0.1,::1 10.0.0.0/8")
+	if err != nil || len(nets) != 3 {
+		t.Fatalf("разбор списка: %v %v", nets, err)
+	}
+	for _, bad := range []string{"localhost", "10.0.0.0/33"} {
+		if _, err := ParseTrustedProxies(bad); err == nil {
+			t.Errorf("принят неверный элемент %q", bad)
+		}
+	}
+}